@@ -25,6 +25,9 @@ platforms=(
   "darwin arm64"
 )
 
+BUILDINFO_PKG="github.com/syltek/oncall-incident-reporter/pkg/buildinfo"
+LDFLAGS="-s -w -X $BUILDINFO_PKG.Version=$VERSION_TAG -X $BUILDINFO_PKG.Commit=$(git rev-parse HEAD) -X $BUILDINFO_PKG.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+
 echo "Building binaries for version: $VERSION_TAG"
 
 # Build binaries
@@ -35,7 +38,7 @@ for platform in "${platforms[@]}"; do
   OUTPUT_FILE="${BINARY_NAME}-${OS}-${ARCH}"
 
   echo "Building for $OS/$ARCH..."
-  CGO_ENABLED=0 GOOS=$OS GOARCH=$ARCH go build -ldflags="-s -w" -o $OUTPUT_DIR/$OUTPUT_FILE ./cmd
+  CGO_ENABLED=0 GOOS=$OS GOARCH=$ARCH go build -ldflags="$LDFLAGS" -o $OUTPUT_DIR/$OUTPUT_FILE ./cmd
 
   # Package binaries
   echo "Packaging $OUTPUT_FILE..."
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/syltek/oncall-incident-reporter/internal/app"
+	"github.com/syltek/oncall-incident-reporter/internal/audit"
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+	"github.com/syltek/oncall-incident-reporter/internal/incident"
+	"github.com/syltek/oncall-incident-reporter/internal/installation"
+	"github.com/syltek/oncall-incident-reporter/internal/metrics"
+	"github.com/syltek/oncall-incident-reporter/internal/service"
+	"github.com/syltek/oncall-incident-reporter/internal/service/fake"
+	"go.uber.org/zap"
+)
+
+// serveCommand runs the application. It is the command run without arguments, e.g. in Lambda.
+const serveCommand = "serve"
+
+// command is a subcommand of the binary. It returns the exit code: 0 on success, 1 on failure
+// and 2 on usage errors.
+type command struct {
+	name        string
+	description string
+	run         func(args []string, stdout, stderr io.Writer) int
+}
+
+var commands = []command{
+	{serveCommand, "run the application in Lambda, as a server or locally, as configured", runServe},
+	{validateConfigCommand, "check the configuration and report every problem in it", runValidateConfig},
+	{renderModalCommand, "print the Block Kit JSON of the incident modal", runRenderModal},
+	{renderMessageCommand, "print the Slack announcement and the Datadog event of an incident", runRenderMessage},
+	{simulateSubmitCommand, "submit an incident to the handler, with fake Slack and Datadog clients", runSimulateSubmit},
+	{incidentsCommand, "list, show and resolve the stored incidents", runIncidents},
+}
+
+// runCommand runs the subcommand named by the first argument, or serves the application without
+// arguments
+func runCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		return runServe(nil, stdout, stderr)
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:], stdout, stderr)
+		}
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(stdout)
+		return 0
+	}
+	fmt.Fprintf(stderr, "Unknown command %q\n\n", args[0])
+	printUsage(stderr)
+	return 2
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s [command] [flags]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-16s %s\n", c.name, c.description)
+	}
+	fmt.Fprintf(w, "\nWithout a command, the application is served. Run a command with -h for its flags.\n")
+}
+
+func runServe(args []string, stdout, stderr io.Writer) int {
+	if len(args) > 0 {
+		fmt.Fprintf(stderr, "Usage: %s %s\n", os.Args[0], serveCommand)
+		return 2
+	}
+	return serve(stdout, stderr)
+}
+
+// newFlagSet creates the flags of a command, with the -config flag giving the location of the
+// configuration
+func newFlagSet(name, arguments string, stderr io.Writer) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	location := flags.String("config", config.ConfigLocation(), "configuration file or s3:// or http(s):// URL")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s %s [flags]%s\n", os.Args[0], name, arguments)
+		flags.PrintDefaults()
+	}
+	return flags, location
+}
+
+// loadToolConfig loads the configuration of the commands that do not call Slack or Datadog:
+// neither the environment nor the secrets are needed
+func loadToolConfig(location string, stderr io.Writer) (*config.Config, bool) {
+	cfg, err := config.LoadFile(context.Background(), location, nil)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", location, err)
+		return nil, false
+	}
+	return cfg, true
+}
+
+// offlineApp is the application calling fake Slack and Datadog clients, to preview or simulate
+// what it sends without credentials
+type offlineApp struct {
+	*app.App
+	slack   *fake.SlackClient
+	datadog *fake.DatadogClient
+}
+
+// newOfflineApp builds the application with fake Slack and Datadog clients and no metrics. The
+// stores and the audit log left unset in opts are the configured ones.
+func newOfflineApp(cfg *config.Config, opts app.Options) (*offlineApp, error) {
+	slackClient, datadogClient := fake.NewSlackClient(), fake.NewDatadogClient()
+	retryPolicy := service.NoRetryPolicy()
+	opts.Config = cfg
+	opts.Logger = zap.NewNop()
+	opts.SlackClient = slackClient
+	opts.NewSlackClient = func(string) service.ISlackClient { return slackClient }
+	opts.DatadogClient = datadogClient
+	opts.RetryPolicy = &retryPolicy
+	opts.Metrics = metrics.NewNoopRecorder()
+	a, err := app.New(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &offlineApp{App: a, slack: slackClient, datadog: datadogClient}, nil
+}
+
+// memoryStores keep the incidents, the audit trail and the installations of an offline app in
+// memory, leaving the configured stores untouched
+func memoryStores() app.Options {
+	return app.Options{
+		IncidentStore:     incident.NewMemoryStore(),
+		AuditLog:          audit.NewMemoryLog(),
+		InstallationStore: installation.NewMemoryStore(),
+	}
+}
+
+// fieldsFlag collects the incident fields given as key=value, the key being the block ID of
+// the modal input
+type fieldsFlag map[string]string
+
+func (f fieldsFlag) String() string {
+	var pairs []string
+	for _, key := range slices.Sorted(maps.Keys(f)) {
+		pairs = append(pairs, key+"="+f[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f fieldsFlag) Set(value string) error {
+	key, fieldValue, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	f[key] = fieldValue
+	return nil
+}
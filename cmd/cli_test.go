@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syltek/oncall-incident-reporter/internal/incident"
+)
+
+// configPlaceholder is replaced in the arguments by the path of the test configuration
+const configPlaceholder = "$CONFIG"
+
+const testConfig = `
+metadata:
+  service: "test-service"
+slack_config:
+  channel_id: "C123456"
+  message_format: "{{severity}} incident in {{domains_affected}}"
+endpoints:
+  slack_command: "/incident"
+  slack_modal_parser: "/incident/submit"
+modal:
+  title: "Report incident"
+  inputs:
+    - key: "input_severity"
+      label: "Severity"
+      type: "select"
+      options:
+        - text: "High"
+        - text: "Low"
+    - key: "input_domains_affected"
+      label: "Domain"
+      type: "select"
+      options:
+        - text: "payments"
+        - text: "bookings"
+incidents:
+  store: "file"
+  store_path: "%DIR%/incidents.json"
+audit:
+  store: "file"
+  store_path: "%DIR%/audit.jsonl"
+`
+
+// writeTestConfig writes the test configuration to a temporary directory, with a file store
+// holding an open incident, INC-open, and a resolved one, INC-resolved
+func writeTestConfig(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(strings.ReplaceAll(testConfig, "%DIR%", dir)), 0o600))
+
+	store, err := incident.NewFileStore(filepath.Join(dir, "incidents.json"))
+	require.NoError(t, err)
+	open := incident.New("V1", incident.Reporter{ID: "U1"}, map[string]string{"input_severity": "High"})
+	open.ID = "INC-open"
+	require.NoError(t, store.Create(context.Background(), open))
+	resolvedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	resolved := incident.New("V2", incident.Reporter{ID: "U1"}, nil)
+	resolved.ID, resolved.ResolvedBy, resolved.ResolvedAt = "INC-resolved", "U2", &resolvedAt
+	require.NoError(t, store.Create(context.Background(), resolved))
+	return path
+}
+
+func TestRunCommand(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		config     string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{
+			name:       "valid configuration",
+			args:       []string{"validate-config", configPlaceholder},
+			wantStdout: "configuration is valid",
+		},
+		{
+			name:       "invalid configuration",
+			args:       []string{"validate-config", configPlaceholder},
+			config:     "metadata:\n  service: \"test-service\"\nendpoints:\n  slack_command: \"incident\"\n",
+			wantCode:   1,
+			wantStderr: `endpoints.slack_command: "incident" must start with /`,
+		},
+		{
+			name:       "missing configuration",
+			args:       []string{"validate-config", "missing.yaml"},
+			wantCode:   1,
+			wantStderr: "missing.yaml: ",
+		},
+		{
+			name:     "several configurations",
+			args:     []string{"validate-config", configPlaceholder, configPlaceholder},
+			wantCode: 2,
+		},
+		{
+			name:       "unknown command",
+			args:       []string{"deploy"},
+			wantCode:   2,
+			wantStderr: `Unknown command "deploy"`,
+		},
+		{
+			name:       "render message with fields",
+			args:       []string{"render-message", "-config", configPlaceholder, "-fields", "input_severity=High", "-fields", "input_domains_affected=payments"},
+			wantStdout: "High incident in payments",
+		},
+		{
+			name:       "render message with a field without value",
+			args:       []string{"render-message", "-config", configPlaceholder, "-fields", "input_severity"},
+			wantCode:   2,
+			wantStderr: `expected key=value, got "input_severity"`,
+		},
+		{
+			name:     "incidents without subcommand",
+			args:     []string{"incidents"},
+			wantCode: 2,
+		},
+		{
+			name:       "show incident",
+			args:       []string{"incidents", "show", "-config", configPlaceholder, "INC-open"},
+			wantStdout: `"id": "INC-open"`,
+		},
+		{
+			name:       "show missing incident",
+			args:       []string{"incidents", "show", "-config", configPlaceholder, "INC-missing"},
+			wantCode:   1,
+			wantStderr: "Failed to get incident INC-missing",
+		},
+		{
+			name:     "show without incident ID",
+			args:     []string{"incidents", "show", "-config", configPlaceholder},
+			wantCode: 2,
+		},
+		{
+			name:       "resolve incident",
+			args:       []string{"incidents", "resolve", "-config", configPlaceholder, "-by", "U3", "INC-open"},
+			wantStdout: "Incident INC-open resolved",
+		},
+		{
+			name:       "resolve resolved incident",
+			args:       []string{"incidents", "resolve", "-config", configPlaceholder, "INC-resolved"},
+			wantCode:   1,
+			wantStderr: "Incident INC-resolved was already resolved by U2 at 2024-01-02 03:04:05",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestConfig(t)
+			if tt.config != "" {
+				require.NoError(t, os.WriteFile(path, []byte(tt.config), 0o600))
+			}
+			args := make([]string, len(tt.args))
+			for i, arg := range tt.args {
+				args[i] = strings.ReplaceAll(arg, configPlaceholder, path)
+			}
+
+			var stdout, stderr bytes.Buffer
+			code := runCommand(args, &stdout, &stderr)
+			assert.Equal(t, tt.wantCode, code, "stderr: %s", stderr.String())
+			assert.Contains(t, stdout.String(), tt.wantStdout)
+			assert.Contains(t, stderr.String(), tt.wantStderr)
+		})
+	}
+}
+
+func TestResolveIncidentIsStored(t *testing.T) {
+	path := writeTestConfig(t)
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 0, runCommand([]string{"incidents", "resolve", "-config", path, "-by", "U3", "INC-open"}, &stdout, &stderr), stderr.String())
+
+	store, err := incident.NewFileStore(filepath.Join(filepath.Dir(path), "incidents.json"))
+	require.NoError(t, err)
+	inc, err := store.Get(context.Background(), "INC-open")
+	require.NoError(t, err)
+	assert.Equal(t, "U3", inc.ResolvedBy)
+
+	audit, err := os.ReadFile(filepath.Join(filepath.Dir(path), "audit.jsonl"))
+	require.NoError(t, err)
+	assert.Contains(t, string(audit), `"incident_id":"INC-open"`)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/syltek/oncall-incident-reporter/internal/app"
+	"github.com/syltek/oncall-incident-reporter/internal/audit"
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+	"github.com/syltek/oncall-incident-reporter/internal/incident"
+	"github.com/syltek/oncall-incident-reporter/internal/installation"
+	"go.uber.org/zap"
+)
+
+// incidentsCommand manages the incidents of the configured store
+const incidentsCommand = "incidents"
+
+// runIncidents runs the list, show and resolve subcommands against the incident store
+func runIncidents(args []string, stdout, stderr io.Writer) int {
+	usage := func() int {
+		fmt.Fprintf(stderr, "Usage: %s %s list|show|resolve [flags]\n", os.Args[0], incidentsCommand)
+		return 2
+	}
+	if len(args) == 0 {
+		return usage()
+	}
+	switch args[0] {
+	case "list":
+		return runIncidentsList(args[1:], stdout, stderr)
+	case "show":
+		return runIncidentsShow(args[1:], stdout, stderr)
+	case "resolve":
+		return runIncidentsResolve(args[1:], stdout, stderr)
+	default:
+		return usage()
+	}
+}
+
+func runIncidentsList(args []string, stdout, stderr io.Writer) int {
+	flags, location := newFlagSet(incidentsCommand+" list", "", stderr)
+	all := flags.Bool("all", false, "also list the resolved incidents")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+	store, ok := openIncidentStore(*location, stderr)
+	if !ok {
+		return 1
+	}
+
+	incidents, err := store.List(context.Background())
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to list incidents: %v\n", err)
+		return 1
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tREPORTED AT\tSEVERITY\tDOMAIN\tSTATUS\tREPORTER\tFAILED SINKS")
+	for _, inc := range incidents {
+		if inc.IsResolved() && !*all {
+			continue
+		}
+		failed := inc.FailedSinks()
+		slices.Sort(failed)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			inc.ID,
+			inc.CreatedAt.Format(time.DateTime),
+			inc.Fields[config.SEVERITY_INPUT_KEY],
+			inc.Fields[config.DOMAINS_INPUT_KEY],
+			incidentStatus(inc),
+			inc.Reporter.ID,
+			joinOrDash(failed))
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(stderr, "Failed to write incidents: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runIncidentsShow(args []string, stdout, stderr io.Writer) int {
+	flags, location := newFlagSet(incidentsCommand+" show", " <incident ID>", stderr)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	store, ok := openIncidentStore(*location, stderr)
+	if !ok {
+		return 1
+	}
+
+	inc, err := store.Get(context.Background(), flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to get incident %s: %v\n", flags.Arg(0), err)
+		return 1
+	}
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(inc); err != nil {
+		fmt.Fprintf(stderr, "Failed to write incident: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runIncidentsResolve marks an incident as resolved and records it in the audit trail, the way
+// the Resolve button does. The Slack announcement is not updated. The incident store and the
+// audit trail lock their files, the application may be running meanwhile.
+func runIncidentsResolve(args []string, stdout, stderr io.Writer) int {
+	flags, location := newFlagSet(incidentsCommand+" resolve", " <incident ID>", stderr)
+	actor := flags.String("by", audit.ActorSystem, "Slack user ID of who resolved the incident")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	cfg, ok := loadIncidentsConfig(*location, stderr)
+	if !ok {
+		return 1
+	}
+	// The incidents and the audit trail are the configured ones, the installations are not needed
+	a, err := newOfflineApp(cfg, app.Options{InstallationStore: installation.NewMemoryStore()})
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to open the incident store or the audit trail: %v\n", err)
+		return 1
+	}
+	ctx := context.Background()
+	id := flags.Arg(0)
+
+	inc, err := a.Incidents.Get(ctx, id)
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to get incident %s: %v\n", id, err)
+		return 1
+	}
+	if inc.IsResolved() {
+		fmt.Fprintf(stderr, "Incident %s was already resolved by %s at %s\n", id, inc.ResolvedBy, inc.ResolvedAt.Format(time.DateTime))
+		return 1
+	}
+	if a.AuditLog != nil && cfg.Audit.Store != config.STORE_FILE {
+		fmt.Fprintln(stderr, "The audit trail is kept in memory, the resolution is not recorded in it")
+	}
+
+	if _, err := a.Handler.ResolveIncident(ctx, id, *actor); err != nil {
+		fmt.Fprintf(stderr, "Failed to resolve incident %s: %v\n", id, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Incident %s resolved\n", id)
+	return 0
+}
+
+// loadIncidentsConfig loads the configuration, which must keep the incidents in a file: incidents
+// kept in memory only live in the running application
+func loadIncidentsConfig(location string, stderr io.Writer) (*config.Config, bool) {
+	cfg, ok := loadToolConfig(location, stderr)
+	if !ok {
+		return nil, false
+	}
+	if cfg.Incidents == nil || cfg.Incidents.Store != config.STORE_FILE {
+		fmt.Fprintf(stderr, "The incidents are kept in memory by the running application, set incidents.store to %q to manage them\n", config.STORE_FILE)
+		return nil, false
+	}
+	return cfg, true
+}
+
+// openIncidentStore opens the incident store of the configuration
+func openIncidentStore(location string, stderr io.Writer) (incident.Store, bool) {
+	cfg, ok := loadIncidentsConfig(location, stderr)
+	if !ok {
+		return nil, false
+	}
+	store, err := app.NewIncidentStore(cfg, zap.NewNop())
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to open the incident store: %v\n", err)
+		return nil, false
+	}
+	return store, true
+}
+
+// incidentStatus is the stage the incident is at
+func incidentStatus(inc *incident.Incident) string {
+	switch {
+	case inc.IsResolved():
+		return "resolved"
+	case inc.AcknowledgedAt != nil:
+		return "acknowledged"
+	default:
+		return "open"
+	}
+}
+
+// sortedSinks returns the names of the sinks the incident was delivered to, sorted
+func sortedSinks(inc *incident.Incident) []string {
+	return slices.Sorted(maps.Keys(inc.Deliveries))
+}
+
+func joinOrDash(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	return strings.Join(values, ",")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Commands previewing what the configuration renders
+const (
+	renderModalCommand   = "render-modal"
+	renderMessageCommand = "render-message"
+)
+
+// runRenderModal prints the incident modal of a workspace as Block Kit JSON, to be pasted in the
+// Block Kit Builder
+func runRenderModal(args []string, stdout, stderr io.Writer) int {
+	flags, location := newFlagSet(renderModalCommand, "", stderr)
+	teamID := flags.String("team", "", "team ID of the workspace, to render its modal")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+	cfg, ok := loadToolConfig(*location, stderr)
+	if !ok {
+		return 1
+	}
+	a, err := newOfflineApp(cfg, memoryStores())
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to initialize the application: %v\n", err)
+		return 1
+	}
+
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(a.Handler.RenderModal(*teamID, "").View); err != nil {
+		fmt.Fprintf(stderr, "Failed to render the modal: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runRenderMessage prints the Slack announcement and the Datadog event of an incident reported
+// with the fields, as the message format and the scrubbing render them
+func runRenderMessage(args []string, stdout, stderr io.Writer) int {
+	flags, location := newFlagSet(renderMessageCommand, "", stderr)
+	fields := fieldsFlag{}
+	flags.Var(fields, "fields", "incident field as key=value, the key being the block ID of the modal input, e.g. input_severity=High (repeatable)")
+	username := flags.String("username", "U0123456789", "Slack user ID of the reporter")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+	cfg, ok := loadToolConfig(*location, stderr)
+	if !ok {
+		return 1
+	}
+	a, err := newOfflineApp(cfg, memoryStores())
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to initialize the application: %v\n", err)
+		return 1
+	}
+
+	announcement, eventText := a.Handler.PreviewIncident(context.Background(), fields, *username)
+	fmt.Fprintf(stdout, "Slack announcement:\n%s\n\nDatadog event:\n%s\n", announcement, eventText)
+	return 0
+}
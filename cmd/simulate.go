@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/syltek/oncall-incident-reporter/internal/slackmodal"
+)
+
+// simulateSubmitCommand submits an incident to the handler, without Slack or Datadog
+const simulateSubmitCommand = "simulate-submit"
+
+// simulatedViewID is the ID of the view of the simulated submission
+const simulatedViewID = "V0SIMULATED"
+
+// runSimulateSubmit submits the modal filled in with the fields to the handler, as Slack would,
+// then prints the response and what the sinks were sent. Slack and Datadog are faked and the
+// incident is kept in memory, the configured stores are left untouched.
+func runSimulateSubmit(args []string, stdout, stderr io.Writer) int {
+	flags, location := newFlagSet(simulateSubmitCommand, "", stderr)
+	fields := fieldsFlag{}
+	flags.Var(fields, "fields", "incident field as key=value, the key being the block ID of the modal input, e.g. input_severity=High (repeatable)")
+	submitter := slackmodal.Submitter{}
+	flags.StringVar(&submitter.UserID, "user", "U0123456789", "Slack user ID of the reporter")
+	flags.StringVar(&submitter.Username, "username", "reporter", "Slack username of the reporter")
+	flags.StringVar(&submitter.TeamID, "team", "T0123456789", "team ID of the workspace the modal is submitted from")
+	channelID := flags.String("channel", "", "channel ID the slash command is run in")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+	cfg, ok := loadToolConfig(*location, stderr)
+	if !ok {
+		return 1
+	}
+	a, err := newOfflineApp(cfg, memoryStores())
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to initialize the application: %v\n", err)
+		return 1
+	}
+
+	payload, err := a.Handler.RenderModal(submitter.TeamID, *channelID).SubmissionPayload(submitter, simulatedViewID, fields)
+	if err != nil {
+		fmt.Fprintf(stderr, "Invalid fields: %v\n", err)
+		return 2
+	}
+
+	req := httptest.NewRequest(http.MethodPost, cfg.Endpoints.SlackModalParser, strings.NewReader(url.Values{"payload": {payload}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	a.Handler.HandleModalSubmission(rec, req)
+	a.Handler.WaitForDeliveries()
+
+	fmt.Fprintf(stdout, "Response: %d %s\n", rec.Code, strings.TrimSpace(rec.Body.String()))
+	for _, message := range a.slack.Messages() {
+		fmt.Fprintf(stdout, "\nSlack message to %s:\n%s\n", message.Channel, message.Text)
+	}
+	for _, message := range a.slack.Ephemerals() {
+		fmt.Fprintf(stdout, "\nSlack ephemeral message to %s in %s:\n%s\n", message.User, message.Channel, message.Text)
+	}
+	for _, event := range a.datadog.Events() {
+		fmt.Fprintf(stdout, "\nDatadog event %q, tags %s:\n%s\n", event.Title, strings.Join(event.Tags, ", "), event.Text)
+	}
+
+	inc, err := a.Incidents.FindByViewID(context.Background(), simulatedViewID)
+	if err != nil {
+		fmt.Fprintln(stdout, "\nNo incident was recorded")
+		return 1
+	}
+	fmt.Fprintf(stdout, "\nIncident %s recorded\n", inc.ID)
+	for _, sink := range sortedSinks(inc) {
+		delivery := inc.Deliveries[sink]
+		fmt.Fprintf(stdout, "  %s: %s %s\n", sink, delivery.Status, delivery.LastError)
+	}
+	if len(inc.FailedSinks()) > 0 {
+		return 1
+	}
+	return 0
+}
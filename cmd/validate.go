@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+)
+
+// validateConfigCommand checks the configuration and exits, e.g. in CI before deploying it
+const validateConfigCommand = "validate-config"
+
+// runValidateConfig checks the configuration at the location given as argument, or with the
+// -config flag, and prints its problems and warnings. Warnings do not fail the check.
+func runValidateConfig(args []string, stdout, stderr io.Writer) int {
+	flags, location := newFlagSet(validateConfigCommand, " [config file or URL]", stderr)
+	withSecrets := flags.Bool("secrets", false, "resolve the secret references and require the Slack tokens and signing secrets, as at startup")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+	if flags.NArg() == 1 {
+		*location = flags.Arg(0)
+	}
+	var resolver *config.SecretResolver
+	if *withSecrets {
+		resolver = config.DefaultSecretResolver()
+	}
+
+	cfg, err := config.LoadFile(context.Background(), *location, resolver)
+	var validationErr *config.ValidationError
+	switch {
+	case err == nil:
+		for _, warning := range cfg.Warnings() {
+			fmt.Fprintf(stderr, "%s: warning: %s\n", *location, warning)
+		}
+		fmt.Fprintf(stdout, "%s: configuration is valid\n", *location)
+		return 0
+	case errors.As(err, &validationErr):
+		for _, problem := range validationErr.Problems {
+			fmt.Fprintf(stderr, "%s: %s\n", *location, problem)
+		}
+		fmt.Fprintf(stderr, "%s: %d problem(s) found\n", *location, len(validationErr.Problems))
+	default:
+		fmt.Fprintf(stderr, "%s: %v\n", *location, err)
+	}
+	return 1
+}
@@ -0,0 +1,382 @@
+// Package app builds the application from its configuration and explicit dependencies: the
+// logger, the Slack and Datadog services, the stores, the handler and the router.
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"github.com/slack-go/slack"
+	"github.com/syltek/oncall-incident-reporter/internal/audit"
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+	handlers "github.com/syltek/oncall-incident-reporter/internal/handlers/slack"
+	"github.com/syltek/oncall-incident-reporter/internal/health"
+	"github.com/syltek/oncall-incident-reporter/internal/incident"
+	"github.com/syltek/oncall-incident-reporter/internal/installation"
+	"github.com/syltek/oncall-incident-reporter/internal/metrics"
+	"github.com/syltek/oncall-incident-reporter/internal/router"
+	"github.com/syltek/oncall-incident-reporter/internal/service"
+	"github.com/syltek/oncall-incident-reporter/internal/tracing"
+	"github.com/syltek/oncall-incident-reporter/pkg/logutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// DatadogClient calls the Datadog events, monitors and authentication APIs
+type DatadogClient interface {
+	service.IDatadogEventsAPI
+	service.IDatadogMonitorsAPI
+	service.IDatadogAuthenticationAPI
+}
+
+// Options are the configuration and the dependencies of the application. The dependencies left
+// unset are created from the configuration, e.g. the clients calling the Slack and Datadog APIs.
+type Options struct {
+	// Config is the configuration, loaded with config.LoadConfig if nil
+	Config *config.Config
+	// Logger is the application logger, built for the log level of the configuration if nil.
+	// The packages logging through logutil log with it when handling the requests and the
+	// background work of the application, it is passed in their context.
+	Logger *zap.Logger
+
+	// SlackClient calls Slack with the configured token
+	SlackClient service.ISlackClient
+	// NewSlackClient creates the client of a workspace installed through OAuth from its bot token
+	NewSlackClient func(token string) service.ISlackClient
+	DatadogClient  DatadogClient
+	// RetryPolicy of the calls to Slack and Datadog, the configured one if nil
+	RetryPolicy *service.RetryPolicy
+	// Metrics records the application metrics instead of the configured Datadog recorder. They
+	// are also exposed to Prometheus when serving HTTP.
+	Metrics metrics.Recorder
+
+	IncidentStore     incident.Store
+	AuditLog          audit.Log
+	InstallationStore installation.Store
+
+	// LambdaClient invokes the function to deliver the reported incidents in Lambda
+	LambdaClient ILambdaAPI
+}
+
+// App is the application wired from its options, ready to be run or to serve requests in-process
+type App struct {
+	Config *config.Config
+	Logger *zap.Logger
+
+	Slack   *service.SlackService
+	Datadog *service.DatadogService
+	Metrics metrics.Recorder
+
+	Incidents incident.Store
+	// AuditLog is nil when the audit trail is disabled
+	AuditLog audit.Log
+	// Installations is nil when OAuth is disabled
+	Installations installation.Store
+
+	Handler  *handlers.SlackHandler
+	Router   *router.Router
+	Health   *health.Handler
+	Reloader *config.Reloader
+
+	prometheus  *metrics.PrometheusRecorder
+	auditExport http.Handler
+	// logLevel and redactor are those of the Logger, changed when the configuration is reloaded
+	logLevel zap.AtomicLevel
+	redactor *logutil.Redactor
+	// tracerProvider records the spans of the application once it runs
+	tracerProvider tracing.Provider
+	// lambdaClient is nil until the first delivery in Lambda, unless given
+	lambdaClient ILambdaAPI
+}
+
+// New builds the application from the options
+func New(opts Options) (*App, error) {
+	cfg := opts.Config
+	if cfg == nil {
+		var err error
+		if cfg, err = config.LoadConfig(); err != nil {
+			return nil, fmt.Errorf("load configuration: %w", err)
+		}
+	}
+	a := &App{Config: cfg, logLevel: zap.NewAtomicLevelAt(logLevel(cfg)), lambdaClient: opts.LambdaClient}
+	logger, err := a.newLogger(opts.Logger)
+	if err != nil {
+		return nil, err
+	}
+	a.Logger = logger
+	for _, warning := range cfg.Warnings() {
+		logger.Warn("Configuration warning", zap.String("path", warning.Path), zap.String("warning", warning.Message))
+	}
+
+	retryPolicy := RetryPolicy(cfg)
+	if opts.RetryPolicy != nil {
+		retryPolicy = *opts.RetryPolicy
+	}
+
+	// Without a Datadog client, the APIs are called with the keys of the environment
+	var apiClient *datadog.APIClient
+	datadogClient := opts.DatadogClient
+	if datadogClient == nil {
+		apiClient = datadog.NewAPIClient(datadog.NewConfiguration())
+		datadogClient = datadogAPI{
+			EventsApi:         datadogV1.NewEventsApi(apiClient),
+			MonitorsApi:       datadogV1.NewMonitorsApi(apiClient),
+			AuthenticationApi: datadogV1.NewAuthenticationApi(apiClient),
+		}
+	}
+	a.Datadog = service.NewDatadogService(datadogClient, datadogClient, retryPolicy).
+		WithAuthentication(datadogClient)
+
+	// With OAuth, workspaces are served with the token of their installation and the
+	// configured token, if any, serves the others
+	slackClient := opts.SlackClient
+	if slackClient == nil && cfg.SlackConfig.Token != "" {
+		slackClient = slack.New(cfg.SlackConfig.Token)
+	}
+	a.Slack = service.NewSlackService(slackClient, retryPolicy)
+	if cfg.OAuthEnabled() {
+		if a.Installations = opts.InstallationStore; a.Installations == nil {
+			if a.Installations, err = NewInstallationStore(cfg, logger); err != nil {
+				return nil, fmt.Errorf("create installation store: %w", err)
+			}
+		}
+		newSlackClient := opts.NewSlackClient
+		if newSlackClient == nil {
+			newSlackClient = func(token string) service.ISlackClient {
+				return slack.New(token)
+			}
+		}
+		a.Slack.WithInstallations(a.Installations, newSlackClient)
+	}
+
+	// When serving HTTP, metrics are also exposed to Prometheus
+	if a.Metrics = opts.Metrics; a.Metrics == nil {
+		a.Metrics = newMetricsRecorder(cfg, logger, apiClient)
+	}
+	if cfg.ServerEnabled() || (cfg.Local != nil && cfg.Local.Enabled && !cfg.SocketModeEnabled()) {
+		a.prometheus = metrics.NewPrometheusRecorder(metricsPrefix(cfg))
+		a.Metrics = metrics.NewMultiRecorder(a.prometheus, a.Metrics)
+	}
+
+	if a.Incidents = opts.IncidentStore; a.Incidents == nil {
+		if a.Incidents, err = NewIncidentStore(cfg, logger); err != nil {
+			return nil, fmt.Errorf("create incident store: %w", err)
+		}
+	}
+	if a.AuditLog = opts.AuditLog; a.AuditLog == nil {
+		if a.AuditLog, err = NewAuditLog(cfg, logger); err != nil {
+			return nil, fmt.Errorf("create audit log: %w", err)
+		}
+	}
+	if a.AuditLog != nil && cfg.Audit != nil && cfg.Audit.ExportEnabled() {
+		a.auditExport = http.HandlerFunc(handlers.NewAuditExportHandler(a.AuditLog, cfg.Audit.ExportToken).HandleExport)
+	}
+
+	a.Handler = handlers.NewSlackHandler(a.Slack, a.Datadog, a.Metrics, a.Incidents, cfg)
+	if a.AuditLog != nil {
+		a.Handler.WithAuditLog(a.AuditLog)
+	}
+	a.Router = router.NewRouter(a.Handler, cfg)
+	a.Router.UseLogger(logger)
+	a.Router.UseMetrics(a.Metrics)
+	if cfg.OAuthEnabled() {
+		a.Router.HandleInstallation(handlers.NewInstallHandler(cfg.OAuth, a.Installations, nil))
+	}
+	a.Health = a.newHealthHandler()
+	a.Reloader = a.newConfigReloader()
+
+	logger.Info("Application initialization completed")
+	return a, nil
+}
+
+// Close flushes the logs
+func (a *App) Close() {
+	_ = a.Logger.Sync()
+}
+
+// datadogAPI calls the Datadog APIs used by the application
+type datadogAPI struct {
+	*datadogV1.EventsApi
+	*datadogV1.MonitorsApi
+	*datadogV1.AuthenticationApi
+}
+
+// newLogger creates the redactor of the application and returns the logger redacted by it,
+// built for the log level of the configuration unless given. Each application has its own, so
+// that applications built side by side do not change each other's logs.
+func (a *App) newLogger(logger *zap.Logger) (*zap.Logger, error) {
+	patterns, fields := redactionRules(a.Config)
+	redactor, err := logutil.NewRedactor(patterns, fields)
+	if err != nil {
+		return nil, fmt.Errorf("configure log redaction: %w", err)
+	}
+	a.redactor = redactor
+	if logger != nil {
+		return logger.WithOptions(zap.WrapCore(redactor.Wrap)), nil
+	}
+	if logger, err = logutil.NewLogger(a.Config.LogLevel == config.DEBUG_LOG_LEVEL, a.logLevel, redactor); err != nil {
+		return nil, fmt.Errorf("create logger: %w", err)
+	}
+	return logger, nil
+}
+
+// context returns a context carrying the logger and the tracer provider of the application, for
+// the work done outside of a request
+func (a *App) context() context.Context {
+	ctx := logutil.WithLogger(context.Background(), a.Logger)
+	if a.tracerProvider != nil {
+		ctx = tracing.WithProvider(ctx, a.tracerProvider)
+	}
+	return ctx
+}
+
+// logLevel is the level of the logs in the configuration
+func logLevel(c *config.Config) zapcore.Level {
+	if c.LogLevel == config.DEBUG_LOG_LEVEL {
+		return zapcore.DebugLevel
+	}
+	return zapcore.InfoLevel
+}
+
+// redactionRules returns the redaction patterns and fields of the configuration
+func redactionRules(c *config.Config) ([]string, []string) {
+	if c.Redaction == nil {
+		return nil, nil
+	}
+	return c.Redaction.Patterns, c.Redaction.Fields
+}
+
+// RetryPolicy is the retry policy of the outbound calls in the configuration
+func RetryPolicy(cfg *config.Config) service.RetryPolicy {
+	if cfg.Retry == nil {
+		return service.DefaultRetryPolicy()
+	}
+	return service.RetryPolicy{
+		MaxAttempts:    cfg.Retry.MaxAttempts,
+		InitialBackoff: time.Duration(cfg.Retry.InitialBackoff) * time.Millisecond,
+		MaxBackoff:     time.Duration(cfg.Retry.MaxBackoff) * time.Millisecond,
+	}
+}
+
+// metricsPrefix is the prefix of the names of the metrics
+func metricsPrefix(cfg *config.Config) string {
+	if cfg.Metrics == nil || cfg.Metrics.Prefix == "" {
+		return config.DEFAULT_METRICS_PREFIX
+	}
+	return cfg.Metrics.Prefix
+}
+
+// newMetricsRecorder creates the Datadog metrics recorder, or a no-op one if metrics are disabled
+func newMetricsRecorder(cfg *config.Config, logger *zap.Logger, apiClient *datadog.APIClient) metrics.Recorder {
+	if cfg.Metrics == nil || !cfg.Metrics.Enabled {
+		logger.Info("Datadog metrics are disabled")
+		return metrics.NewNoopRecorder()
+	}
+	if apiClient == nil {
+		apiClient = datadog.NewAPIClient(datadog.NewConfiguration())
+	}
+
+	return metrics.NewDatadogRecorder(
+		datadogV2.NewMetricsApi(apiClient),
+		datadogV1.NewMetricsApi(apiClient),
+		cfg.Metrics.Prefix,
+		"env:"+cfg.Metadata.Environment,
+		"service:"+cfg.Metadata.Service,
+		"team:"+cfg.Metadata.Team,
+	)
+}
+
+// NewIncidentStore creates the configured incident store
+func NewIncidentStore(cfg *config.Config, logger *zap.Logger) (incident.Store, error) {
+	var store string
+	if cfg.Incidents != nil {
+		store = cfg.Incidents.Store
+	}
+	switch store {
+	case config.STORE_FILE:
+		logger.Info("Using file incident store", zap.String("path", cfg.Incidents.StorePath))
+		return incident.NewFileStore(cfg.Incidents.StorePath)
+	case config.STORE_MEMORY, "":
+		logger.Info("Using in-memory incident store")
+		return incident.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown incident store %q", store)
+	}
+}
+
+// NewAuditLog creates the configured audit log, or nil if the audit trail is disabled
+func NewAuditLog(cfg *config.Config, logger *zap.Logger) (audit.Log, error) {
+	if cfg.Audit == nil || !cfg.Audit.Enabled {
+		return nil, nil
+	}
+	switch cfg.Audit.Store {
+	case config.STORE_FILE:
+		logger.Info("Recording the audit trail in a file", zap.String("path", cfg.Audit.StorePath))
+		return audit.NewFileLog(cfg.Audit.StorePath)
+	case config.STORE_MEMORY:
+		logger.Info("Recording the audit trail in memory, it is lost on restart")
+		return audit.NewMemoryLog(), nil
+	default:
+		return nil, fmt.Errorf("unknown audit store %q", cfg.Audit.Store)
+	}
+}
+
+// NewInstallationStore creates the configured store of the OAuth installations
+func NewInstallationStore(cfg *config.Config, logger *zap.Logger) (installation.Store, error) {
+	switch cfg.OAuth.Store {
+	case config.STORE_FILE:
+		logger.Info("Using file installation store", zap.String("path", cfg.OAuth.StorePath))
+		return installation.NewFileStore(cfg.OAuth.StorePath)
+	case config.STORE_MEMORY, "":
+		logger.Info("Using in-memory installation store")
+		return installation.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown installation store %q", cfg.OAuth.Store)
+	}
+}
+
+// newHealthHandler creates the health endpoints, ready once Slack, Datadog and the stores are
+func (a *App) newHealthHandler() *health.Handler {
+	h := health.NewHandler().
+		AddCheck("datadog", a.Datadog.Validate).
+		AddCheck("incident_store", func(ctx context.Context) error {
+			_, err := a.Incidents.List(ctx)
+			return err
+		})
+	// Without a configured token, Slack is called with the tokens of the installations
+	if a.Config.SlackConfig.Token != "" {
+		h.AddCheck("slack", a.Slack.AuthTest)
+	}
+	if a.Installations != nil {
+		h.AddCheck("installation_store", func(ctx context.Context) error {
+			_, err := a.Installations.List(ctx)
+			return err
+		})
+	}
+	return h
+}
+
+// newConfigReloader creates the reloader applying the reloaded configurations to the router, the
+// handler and the logs. The settings of the server, the stores and the clients need a restart.
+func (a *App) newConfigReloader() *config.Reloader {
+	reloader := config.NewReloader(a.Config, config.DefaultLoadFunc)
+	reloader.OnReload("router", a.Router.ApplyConfig)
+	reloader.OnReload("handler", a.Handler.ApplyConfig)
+	reloader.OnReload("logging", a.applyLogging)
+	return reloader
+}
+
+// applyLogging applies the log level and the log redaction of the configuration to the logger
+// of the application
+func (a *App) applyLogging(c *config.Config) error {
+	if err := a.redactor.Configure(redactionRules(c)); err != nil {
+		return fmt.Errorf("configure log redaction: %w", err)
+	}
+	a.logLevel.SetLevel(logLevel(c))
+	return nil
+}
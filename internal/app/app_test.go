@@ -0,0 +1,164 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	awslambda "github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syltek/oncall-incident-reporter/internal/app/apptest"
+	"github.com/syltek/oncall-incident-reporter/internal/audit"
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+	"github.com/syltek/oncall-incident-reporter/internal/incident"
+	"github.com/syltek/oncall-incident-reporter/internal/slackmodal"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var reporter = slackmodal.Submitter{UserID: "U1", Username: "jane", TeamID: apptest.TeamID}
+
+func TestReportIncident(t *testing.T) {
+	cfg := apptest.Config()
+	cfg.Scrubbing = &config.Scrubbing{Enabled: true}
+	h := apptest.New(t, cfg)
+
+	rec := h.Command(t, apptest.TeamID, apptest.ChannelID, reporter.UserID, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Len(t, h.Slack.Views(), 1)
+	assert.Equal(t, "Report incident", h.Slack.Views()[0].Title.Text)
+
+	rec = h.Submit(t, "V1", reporter, map[string]string{
+		config.SEVERITY_INPUT_KEY:    "High",
+		config.DOMAINS_INPUT_KEY:     "Payments",
+		config.DESCRIPTION_INPUT_KEY: "Checkout fails for jane@example.com",
+	})
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"response_action":"clear"}`, rec.Body.String())
+
+	messages := h.Slack.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, apptest.ChannelID, messages[0].Channel)
+	assert.Contains(t, messages[0].Text, "*Description:* Checkout fails for jane@example.com")
+
+	// Personal data is scrubbed from the Datadog event
+	events := h.Datadog.Events()
+	require.Len(t, events, 1)
+	assert.Contains(t, events[0].Text, "*Description:* Checkout fails for [email]")
+	assert.Contains(t, events[0].Tags, "severity:High")
+
+	inc := h.Incident(t, "V1")
+	assert.Equal(t, "U1", inc.Reporter.ID)
+	assert.Empty(t, inc.FailedSinks())
+
+	entries, err := h.AuditLog.Query(context.Background(), audit.Filter{IncidentID: inc.ID})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, audit.ActionReported, entries[0].Action)
+}
+
+func TestReportIncidentSinkFails(t *testing.T) {
+	h := apptest.New(t, nil)
+	h.Datadog.Err = errors.New("datadog is down")
+
+	rec := h.Submit(t, "V1", reporter, map[string]string{config.SEVERITY_INPUT_KEY: "Low"})
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// The incident is recorded and announced, the reporter is told Datadog is retried later
+	inc := h.Incident(t, "V1")
+	assert.Equal(t, []string{"datadog"}, inc.FailedSinks())
+	assert.Equal(t, incident.DeliveryDelivered, inc.Deliveries["slack"].Status)
+	messages := h.Slack.Messages()
+	require.Len(t, messages, 2)
+	assert.Equal(t, apptest.ChannelID, messages[0].Channel)
+	assert.Equal(t, "U1", messages[1].Channel)
+	assert.Contains(t, messages[1].Text, "could not be delivered to: datadog")
+}
+
+// fakeLambda records the asynchronous invocations of the function
+type fakeLambda struct {
+	payloads [][]byte
+}
+
+func (l *fakeLambda) Invoke(_ context.Context, params *awslambda.InvokeInput, _ ...func(*awslambda.Options)) (*awslambda.InvokeOutput, error) {
+	if params.InvocationType != types.InvocationTypeEvent {
+		return nil, fmt.Errorf("unexpected invocation type %s", params.InvocationType)
+	}
+	l.payloads = append(l.payloads, params.Payload)
+	return &awslambda.InvokeOutput{StatusCode: http.StatusAccepted}, nil
+}
+
+func TestLambdaDeliversInOwnInvocation(t *testing.T) {
+	h := apptest.New(t, nil)
+	invoker := &fakeLambda{}
+	handle := h.LambdaHandler(invoker)
+
+	// Slack is answered before the incident is delivered
+	rec := h.Submit(t, "V1", reporter, map[string]string{config.SEVERITY_INPUT_KEY: "High"})
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, h.Slack.Messages())
+	assert.Empty(t, h.Datadog.Events())
+	require.Len(t, invoker.payloads, 1)
+
+	_, err := handle(context.Background(), invoker.payloads[0])
+	require.NoError(t, err)
+	assert.Len(t, h.Slack.Messages(), 1)
+	assert.Len(t, h.Datadog.Events(), 1)
+	assert.Empty(t, h.Incident(t, "V1").FailedSinks())
+
+	// Scheduled events retry the failed deliveries and answer nothing
+	response, err := handle(context.Background(), []byte(`{"source":"aws.events","detail-type":"Scheduled Event"}`))
+	require.NoError(t, err)
+	assert.Nil(t, response)
+}
+
+func TestBadSignatureIsRejected(t *testing.T) {
+	h := apptest.New(t, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/incident", strings.NewReader("command=%2Fincident&trigger_id=123"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Slack-Request-Timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+	req.Header.Set("X-Slack-Signature", "v0=bad")
+
+	assert.Equal(t, http.StatusUnauthorized, h.Do(t, req).Code)
+	assert.Empty(t, h.Slack.Views())
+}
+
+func TestAppsLogSideBySide(t *testing.T) {
+	redacted := apptest.Config()
+	redacted.Redaction = &config.Redaction{Patterns: []string{`jane@example\.com`}}
+	first, second := apptest.New(t, redacted), apptest.New(t, nil)
+
+	values := map[string]string{
+		config.SEVERITY_INPUT_KEY:    "High",
+		config.DOMAINS_INPUT_KEY:     "Payments",
+		config.DESCRIPTION_INPUT_KEY: "Checkout fails for jane@example.com",
+	}
+	require.Equal(t, http.StatusOK, first.Submit(t, "V1", reporter, values).Code)
+	require.Equal(t, http.StatusOK, second.Submit(t, "V2", reporter, values).Code)
+
+	// Each application logs its own requests, with its own redaction
+	logged := func(logs *observer.ObservedLogs) string {
+		var lines strings.Builder
+		for _, entry := range logs.All() {
+			lines.WriteString(entry.Message)
+			fmt.Fprint(&lines, entry.ContextMap())
+			lines.WriteString("\n")
+		}
+		return lines.String()
+	}
+	firstLogs, secondLogs := logged(first.Logs), logged(second.Logs)
+	assert.Contains(t, firstLogs, "V1")
+	assert.NotContains(t, firstLogs, "V2")
+	assert.NotContains(t, firstLogs, "jane@example.com")
+	assert.Contains(t, secondLogs, "V2")
+	assert.NotContains(t, secondLogs, "V1")
+	assert.Contains(t, secondLogs, "jane@example.com")
+}
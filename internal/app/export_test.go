@@ -0,0 +1,16 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/syltek/oncall-incident-reporter/internal/tracing"
+)
+
+// LambdaHandler returns the handler of the Lambda invocations, the incidents being delivered in
+// invocations made with the client
+func (a *App) LambdaHandler(client ILambdaAPI) func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	a.Handler.WithDeliveryQueue(&lambdaDeliveryQueue{functionName: "oncall-incident-reporter", client: client})
+	provider, _ := tracing.Setup(context.Background(), nil, a.Config.Metadata)
+	return a.lambdaHandler(provider)
+}
@@ -0,0 +1,192 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	awslambda "github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+	"github.com/syltek/oncall-incident-reporter/internal/incident"
+	"github.com/syltek/oncall-incident-reporter/internal/tracing"
+	"github.com/syltek/oncall-incident-reporter/pkg/logutil"
+	"go.uber.org/zap"
+)
+
+// ILambdaAPI is the part of the AWS Lambda client used to invoke the function asynchronously
+type ILambdaAPI interface {
+	Invoke(ctx context.Context, params *awslambda.InvokeInput, optFns ...func(*awslambda.Options)) (*awslambda.InvokeOutput, error)
+}
+
+// lambdaEvent is an invocation of the function that is not an HTTP request: the delivery of an
+// incident queued by the invocation that recorded it, or an EventBridge scheduled event
+type lambdaEvent struct {
+	Incident *incident.Incident `json:"incident_delivery,omitempty"`
+	// Source is "aws.events" for the scheduled events
+	Source string `json:"source,omitempty"`
+}
+
+// scheduledEventSource is the source of the EventBridge scheduled events
+const scheduledEventSource = "aws.events"
+
+// startLambda serves the Lambda invocations
+func (a *App) startLambda(tracerProvider tracing.Provider) {
+	cfg := a.Config
+	a.Router.HandleLivenessChecks(a.Health)
+	if a.auditExport != nil {
+		a.Router.HandleAuditExport(cfg.Audit.ExportPath, a.auditExport)
+	}
+	if lambdacontext.FunctionName != "" {
+		a.Handler.WithDeliveryQueue(&lambdaDeliveryQueue{functionName: lambdacontext.FunctionName, client: a.lambdaClient})
+	}
+
+	a.Logger.Info("Starting lambda handler")
+	lambda.Start(a.lambdaHandler(tracerProvider))
+}
+
+// lambdaHandler returns the handler of the Lambda invocations. The Slack requests are answered
+// once handled, only the metrics and the traces are flushed before: the incidents they report
+// are delivered in invocations of their own. The failed deliveries are retried, and a remote
+// configuration fetched again, at the end of these and of the scheduled invocations, since the
+// execution environment may be frozen or discarded between invocations.
+func (a *App) lambdaHandler(tracerProvider tracing.Provider) lambdaHandler {
+	cfg := a.Config
+	// The incidents that could not be queued are delivered before the environment is frozen
+	flush := []func(){
+		a.Handler.WaitForDeliveries,
+		a.flushMetrics,
+		func() { a.flushTraces(tracerProvider) },
+	}
+	retry := atMostEvery(time.Duration(cfg.Incidents.RetryInterval)*time.Second, a.retryFailedDeliveries)
+	// The configuration packaged with the function cannot change, only a remote one or the
+	// secrets it refers to are fetched again
+	var reload []func()
+	if cfg.Reload != nil && cfg.Reload.Enabled {
+		if interval := reloadInterval(cfg, config.ConfigLocation()); interval > 0 {
+			reload = append(reload, atMostEvery(interval, func() {
+				a.reportReload(a.Reloader.Reload(a.context()))
+			}))
+		}
+	}
+
+	serveRequest := withAfterInvocation(a.Router.LambdaHandler, flush...)
+	deliver := withAfterInvocation(func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+		var event lambdaEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, fmt.Errorf("decode incident delivery: %w", err)
+		}
+		a.Handler.DeliverIncident(a.invocationContext(ctx), event.Incident)
+		return nil, nil
+	}, slices.Concat([]func(){retry}, reload, flush)...)
+	// Every scheduled invocation retries the failed deliveries, however recent the last retry
+	maintain := withAfterInvocation(func(context.Context, json.RawMessage) (interface{}, error) {
+		a.retryFailedDeliveries()
+		return nil, nil
+	}, slices.Concat(reload, flush)...)
+
+	return func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+		// The HTTP requests have neither field, they are decoded by the router
+		var event lambdaEvent
+		_ = json.Unmarshal(payload, &event)
+		switch {
+		case event.Incident != nil:
+			return deliver(ctx, payload)
+		case event.Source == scheduledEventSource:
+			return maintain(ctx, payload)
+		default:
+			return serveRequest(ctx, payload)
+		}
+	}
+}
+
+// invocationContext returns the context of a Lambda invocation that is not an HTTP request,
+// carrying the logger and the tracer provider of the application and the Lambda request ID
+func (a *App) invocationContext(ctx context.Context) context.Context {
+	ctx = logutil.WithLogger(ctx, a.Logger)
+	if a.tracerProvider != nil {
+		ctx = tracing.WithProvider(ctx, a.tracerProvider)
+	}
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		ctx = logutil.WithFields(ctx, zap.String(logutil.FieldRequestID, lc.AwsRequestID))
+	}
+	return ctx
+}
+
+// lambdaDeliveryQueue delivers the incidents in asynchronous invocations of the function, so
+// that the invocation answering Slack does not wait for Slack and Datadog. Without a client,
+// one is created from the default AWS configuration on first use.
+type lambdaDeliveryQueue struct {
+	functionName string
+	client       ILambdaAPI
+	mu           sync.Mutex
+}
+
+func (q *lambdaDeliveryQueue) Enqueue(ctx context.Context, inc *incident.Incident) error {
+	payload, err := json.Marshal(lambdaEvent{Incident: inc})
+	if err != nil {
+		return fmt.Errorf("encode incident delivery: %w", err)
+	}
+	client, err := q.getClient(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := client.Invoke(ctx, &awslambda.InvokeInput{
+		FunctionName:   aws.String(q.functionName),
+		InvocationType: types.InvocationTypeEvent,
+		Payload:        payload,
+	}); err != nil {
+		return fmt.Errorf("invoke %s: %w", q.functionName, err)
+	}
+	return nil
+}
+
+// getClient returns the Lambda client, creating it if there is none. A failure to load the AWS
+// configuration is not kept, the next delivery tries again.
+func (q *lambdaDeliveryQueue) getClient(ctx context.Context) (ILambdaAPI, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.client == nil {
+		cfg, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("load AWS configuration: %w", err)
+		}
+		q.client = awslambda.NewFromConfig(cfg)
+	}
+	return q.client, nil
+}
+
+// lambdaHandler handles a Lambda event of any of the shapes supported by the router
+type lambdaHandler func(ctx context.Context, payload json.RawMessage) (interface{}, error)
+
+// withAfterInvocation runs the hooks at the end of the Lambda invocations of the handler, since
+// the execution environment may be frozen or discarded between invocations.
+func withAfterInvocation(handler lambdaHandler, hooks ...func()) lambdaHandler {
+	return func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+		defer func() {
+			for _, hook := range hooks {
+				hook()
+			}
+		}()
+		return handler(ctx, payload)
+	}
+}
+
+// atMostEvery returns a function that calls fn unless it was called less than interval ago
+func atMostEvery(interval time.Duration, fn func()) func() {
+	var last time.Time
+	return func() {
+		if time.Since(last) < interval {
+			return
+		}
+		last = time.Now()
+		fn()
+	}
+}
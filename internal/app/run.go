@@ -0,0 +1,212 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+	"github.com/syltek/oncall-incident-reporter/internal/router"
+	"github.com/syltek/oncall-incident-reporter/internal/server"
+	"github.com/syltek/oncall-incident-reporter/internal/socket"
+	"github.com/syltek/oncall-incident-reporter/internal/tracing"
+	"github.com/syltek/oncall-incident-reporter/pkg/logutil"
+	"go.uber.org/zap"
+)
+
+// Run serves the application as configured: as a server, locally, over Socket Mode or in
+// Lambda. It returns once ctx is done, except in Lambda where it never returns.
+func (a *App) Run(ctx context.Context) error {
+	cfg := a.Config
+	tracerProvider, err := tracing.Setup(ctx, cfg.Tracing, cfg.Metadata)
+	if err != nil {
+		return fmt.Errorf("set up tracing: %w", err)
+	}
+	a.tracerProvider = tracerProvider
+	a.Router.UseTracerProvider(tracerProvider)
+	ctx = tracing.WithProvider(logutil.WithLogger(ctx, a.Logger), tracerProvider)
+	defer func() {
+		if err := tracerProvider.Shutdown(context.Background()); err != nil {
+			a.Logger.Error("Failed to flush traces", zap.Error(err))
+		}
+	}()
+
+	if cfg.LambdaEnabled() {
+		a.startLambda(tracerProvider)
+		return nil
+	}
+
+	stopFlusher := runPeriodically(time.Duration(cfg.Metrics.FlushInterval)*time.Second, a.flushMetrics)
+	defer stopFlusher()
+
+	stopRetrier := runPeriodically(time.Duration(cfg.Incidents.RetryInterval)*time.Second, a.retryFailedDeliveries)
+	defer stopRetrier()
+
+	stopReload := a.watchConfig()
+	defer stopReload()
+
+	// Finish delivering the reported incidents before the final retry and flush
+	defer a.Handler.WaitForDeliveries()
+
+	if cfg.SocketModeEnabled() {
+		if err := a.runSocketMode(ctx); err != nil {
+			return fmt.Errorf("socket mode: %w", err)
+		}
+		return nil
+	}
+
+	serverCfg := cfg.Server
+	if !cfg.ServerEnabled() {
+		serverCfg = localServerConfig(cfg.Local)
+	}
+	if err := a.runServer(ctx, serverCfg); err != nil {
+		return fmt.Errorf("server: %w", err)
+	}
+	return nil
+}
+
+// localServerConfig is the server configuration of local development
+func localServerConfig(local *config.Local) *config.Server {
+	return &config.Server{
+		Address:         fmt.Sprintf(":%d", local.Port),
+		ReadTimeout:     config.DEFAULT_SERVER_READ_TIMEOUT,
+		WriteTimeout:    config.DEFAULT_SERVER_WRITE_TIMEOUT,
+		IdleTimeout:     config.DEFAULT_SERVER_IDLE_TIMEOUT,
+		ShutdownTimeout: local.ShutdownTimeout,
+	}
+}
+
+// runServer serves HTTP until ctx is done. With an admin address, the health checks, the metrics
+// and the audit export, if any, are served on their own listener instead of with the Slack
+// routes.
+func (a *App) runServer(ctx context.Context, serverCfg *config.Server) error {
+	var admin http.Handler
+	if serverCfg.AdminAddress != "" {
+		adminRouter := router.NewAdminRouter(a.Health, a.prometheus.Handler(), a.Logger)
+		if a.auditExport != nil {
+			adminRouter.Handle(a.Config.Audit.ExportPath, a.auditExport).Methods(http.MethodGet)
+		}
+		admin = adminRouter
+	} else {
+		a.Router.HandleHealthChecks(a.Health)
+		a.Router.HandleMetrics(a.prometheus.Handler())
+		if a.auditExport != nil {
+			a.Router.HandleAuditExport(a.Config.Audit.ExportPath, a.auditExport)
+		}
+	}
+
+	srv, err := server.New(serverCfg, a.Router, admin)
+	if err != nil {
+		return err
+	}
+	srv.OnReload(func() error {
+		a.reportReload(a.Reloader.Reload(a.context()))
+		return nil
+	})
+	return srv.Run(ctx)
+}
+
+// runSocketMode receives Slack requests over Socket Mode until ctx is done
+func (a *App) runSocketMode(ctx context.Context) error {
+	a.Logger.Info("Starting Socket Mode runner")
+	runner := socket.NewRunner(a.Config.SlackConfig.AppToken, a.Config.SlackConfig.Token, a.Handler, a.Config.Endpoints).
+		WithMetrics(a.Metrics)
+	return runner.Run(ctx)
+}
+
+// reportReload logs the outcome of a configuration reload
+func (a *App) reportReload(changed bool, err error) {
+	switch {
+	case err != nil:
+		a.Logger.Error("Failed to reload configuration, keeping the current one", zap.Error(err))
+	case changed:
+		a.Logger.Info("Configuration reloaded", zap.String("log_level", a.Reloader.Current().LogLevel))
+	}
+}
+
+// watchConfig reloads the configuration while serving: a local file whenever it changes, one
+// kept in S3 or served over HTTP every reload interval. It returns the function stopping the
+// periodic reload.
+func (a *App) watchConfig() func() {
+	cfg := a.Config
+	if cfg.Reload == nil || !cfg.Reload.Enabled {
+		return func() {}
+	}
+	location := config.ConfigLocation()
+	if !config.IsRemoteLocation(location) {
+		a.Logger.Info("Watching the configuration file", zap.String("path", location))
+		a.Reloader.Watch(location, a.reportReload)
+	}
+	interval := reloadInterval(cfg, location)
+	if interval <= 0 {
+		return func() {}
+	}
+	a.Logger.Info("Fetching the configuration periodically", zap.Duration("interval", interval))
+	return runPeriodically(interval, func() {
+		a.reportReload(a.Reloader.Reload(a.context()))
+	})
+}
+
+// reloadInterval is how often the configuration is fetched again: every reload interval when it
+// is remote, and once its secrets expire from the cache when it refers to a secret store, since
+// rotated secrets do not change the configuration file. Zero means never.
+func reloadInterval(cfg *config.Config, location string) time.Duration {
+	var interval time.Duration
+	if config.IsRemoteLocation(location) {
+		interval = time.Duration(cfg.Reload.Interval) * time.Second
+	}
+	if ttl := cfg.SecretsCacheTTL(); cfg.HasSecretReferences() && ttl > 0 && (interval <= 0 || ttl < interval) {
+		interval = ttl
+	}
+	return interval
+}
+
+func (a *App) retryFailedDeliveries() {
+	if err := a.Handler.RetryFailedDeliveries(a.context()); err != nil {
+		a.Logger.Error("Failed to retry incident deliveries", zap.Error(err))
+	}
+}
+
+func (a *App) flushMetrics() {
+	if err := a.Metrics.Flush(a.context()); err != nil {
+		a.Logger.Error("Failed to flush metrics", zap.Error(err))
+	}
+}
+
+func (a *App) flushTraces(provider tracing.Provider) {
+	if err := provider.ForceFlush(context.Background()); err != nil {
+		a.Logger.Error("Failed to flush traces", zap.Error(err))
+	}
+}
+
+// runPeriodically calls fn every interval until the returned function is called, which also
+// makes a final call to fn. A non-positive interval disables the periodic calls.
+func runPeriodically(interval time.Duration, fn func()) func() {
+	if interval <= 0 {
+		return fn
+	}
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ticker.C:
+				fn()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
+		fn()
+	}
+}
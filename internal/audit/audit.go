@@ -0,0 +1,144 @@
+// Package audit provides the append-only trail of who reported and changed incidents.
+package audit
+
+import (
+	"context"
+	"iter"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Actions recorded in the trail
+const (
+	ActionReported     = "incident.reported"
+	ActionJoined       = "incident.joined"
+	ActionAcknowledged = "incident.acknowledged"
+	ActionResolved     = "incident.resolved"
+)
+
+// ActorSystem is the actor of the actions not taken by a Slack user
+const ActorSystem = "system"
+
+// Entry records an action on an incident
+type Entry struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Actor is the Slack user ID of who took the action, or ActorSystem
+	Actor      string `json:"actor"`
+	Action     string `json:"action"`
+	IncidentID string `json:"incident_id,omitempty"`
+	// Before and After hold the incident fields changed by the action, as they were before and
+	// after it
+	Before map[string]string `json:"before,omitempty"`
+	After  map[string]string `json:"after,omitempty"`
+	// RequestID identifies the request the action was taken in
+	RequestID string `json:"request_id,omitempty"`
+	// TeamID and EnterpriseID are the workspace and organization the incident was reported in
+	TeamID       string `json:"team_id,omitempty"`
+	EnterpriseID string `json:"enterprise_id,omitempty"`
+}
+
+// Filter selects entries. Empty criteria match every entry.
+type Filter struct {
+	IncidentID string
+	Actor      string
+	Action     string
+	Since      time.Time
+	// TeamID and EnterpriseID select the entries of the incidents reported in a workspace
+	TeamID       string
+	EnterpriseID string
+	// Limit keeps the most recent entries only, when positive
+	Limit int
+}
+
+// Matches reports whether the entry meets the criteria of the filter
+func (f Filter) Matches(entry Entry) bool {
+	return (f.IncidentID == "" || entry.IncidentID == f.IncidentID) &&
+		(f.Actor == "" || entry.Actor == f.Actor) &&
+		(f.Action == "" || entry.Action == f.Action) &&
+		(f.Since.IsZero() || !entry.Timestamp.Before(f.Since)) &&
+		(f.TeamID == "" || entry.TeamID == f.TeamID) &&
+		(f.EnterpriseID == "" || entry.EnterpriseID == f.EnterpriseID)
+}
+
+// Log is an append-only audit trail. Entries cannot be changed or removed.
+type Log interface {
+	// Append records the entry, setting its timestamp if it has none
+	Append(ctx context.Context, entry Entry) error
+	// Query returns the entries matching the filter, oldest first
+	Query(ctx context.Context, filter Filter) ([]Entry, error)
+}
+
+// Changes returns the values that differ between the before and after states, as they were
+// before and after
+func Changes(before, after map[string]string) (map[string]string, map[string]string) {
+	changedBefore := make(map[string]string)
+	changedAfter := make(map[string]string)
+	for key, value := range after {
+		if previous, ok := before[key]; !ok || previous != value {
+			changedAfter[key] = value
+			if ok {
+				changedBefore[key] = previous
+			}
+		}
+	}
+	for key, value := range before {
+		if _, ok := after[key]; !ok {
+			changedBefore[key] = value
+		}
+	}
+	return changedBefore, changedAfter
+}
+
+// MemoryLog keeps the trail in memory. Entries are lost when the process exits.
+type MemoryLog struct {
+	mu      sync.RWMutex
+	entries []Entry
+	now     func() time.Time
+}
+
+// NewMemoryLog creates an empty MemoryLog
+func NewMemoryLog() *MemoryLog {
+	return &MemoryLog{now: time.Now}
+}
+
+func (l *MemoryLog) Append(_ context.Context, entry Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, prepare(entry, l.now))
+	return nil
+}
+
+func (l *MemoryLog) Query(_ context.Context, filter Filter) ([]Entry, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return selectEntries(slices.Values(l.entries), filter), nil
+}
+
+// prepare timestamps the entry and copies its maps, so that the caller cannot change the
+// recorded entry
+func prepare(entry Entry, now func() time.Time) Entry {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = now()
+	}
+	entry.Timestamp = entry.Timestamp.UTC()
+	entry.Before = maps.Clone(entry.Before)
+	entry.After = maps.Clone(entry.After)
+	return entry
+}
+
+// selectEntries returns the entries matching the filter, keeping the most recent ones up to
+// its limit
+func selectEntries(entries iter.Seq[Entry], filter Filter) []Entry {
+	var selected []Entry
+	for entry := range entries {
+		if filter.Matches(entry) {
+			selected = append(selected, prepare(entry, time.Now))
+		}
+	}
+	if filter.Limit > 0 && len(selected) > filter.Limit {
+		selected = selected[len(selected)-filter.Limit:]
+	}
+	return selected
+}
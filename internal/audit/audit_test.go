@@ -0,0 +1,128 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChanges(t *testing.T) {
+	before := map[string]string{"fields.title": "Checkout down", "acknowledged_by": "U1", "note": "old"}
+	after := map[string]string{"fields.title": "Checkout down", "acknowledged_by": "U2", "resolved_by": "U3"}
+
+	changedBefore, changedAfter := Changes(before, after)
+	assert.Equal(t, map[string]string{"acknowledged_by": "U1", "note": "old"}, changedBefore)
+	assert.Equal(t, map[string]string{"acknowledged_by": "U2", "resolved_by": "U3"}, changedAfter)
+}
+
+func TestLogs(t *testing.T) {
+	fileLog, err := NewFileLog(filepath.Join(t.TempDir(), "audit.jsonl"))
+	require.NoError(t, err)
+
+	for name, log := range map[string]Log{"memory": NewMemoryLog(), "file": fileLog} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+			entries := []Entry{
+				{Timestamp: start, Actor: "U1", Action: ActionReported, IncidentID: "INC-1", After: map[string]string{"fields.title": "Checkout down"}},
+				{Timestamp: start.Add(time.Minute), Actor: "U2", Action: ActionJoined, IncidentID: "INC-1"},
+				{Timestamp: start.Add(2 * time.Minute), Actor: "U1", Action: ActionReported, IncidentID: "INC-2"},
+				{Timestamp: start.Add(3 * time.Minute), Actor: "U2", Action: ActionResolved, IncidentID: "INC-1",
+					Before: map[string]string{}, After: map[string]string{"resolved_by": "U2"}, RequestID: "req-1"},
+			}
+			for _, entry := range entries {
+				require.NoError(t, log.Append(ctx, entry))
+			}
+
+			all, err := log.Query(ctx, Filter{})
+			require.NoError(t, err)
+			require.Len(t, all, 4)
+			assert.Equal(t, "U2", all[3].Actor)
+			assert.Equal(t, map[string]string{"resolved_by": "U2"}, all[3].After)
+			assert.Equal(t, "req-1", all[3].RequestID)
+
+			byIncident, err := log.Query(ctx, Filter{IncidentID: "INC-1", Actor: "U2"})
+			require.NoError(t, err)
+			assert.Len(t, byIncident, 2)
+
+			since, err := log.Query(ctx, Filter{Since: start.Add(2 * time.Minute)})
+			require.NoError(t, err)
+			assert.Len(t, since, 2)
+
+			// The limit keeps the most recent entries
+			latest, err := log.Query(ctx, Filter{Action: ActionReported, Limit: 1})
+			require.NoError(t, err)
+			require.Len(t, latest, 1)
+			assert.Equal(t, "INC-2", latest[0].IncidentID)
+		})
+	}
+}
+
+func TestAppendTimestampsAndCopiesEntries(t *testing.T) {
+	log := NewMemoryLog()
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.FixedZone("CET", 3600))
+	log.now = func() time.Time { return now }
+
+	after := map[string]string{"acknowledged_by": "U1"}
+	require.NoError(t, log.Append(context.Background(), Entry{Actor: "U1", Action: ActionAcknowledged, After: after}))
+	after["acknowledged_by"] = "U2"
+
+	entries, err := log.Query(context.Background(), Filter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, now.UTC(), entries[0].Timestamp)
+	assert.Equal(t, "U1", entries[0].After["acknowledged_by"])
+}
+
+func TestFileLogReportsCorruptEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log, err := NewFileLog(path)
+	require.NoError(t, err)
+	require.NoError(t, log.Append(context.Background(), Entry{Actor: "U1", Action: ActionReported}))
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	_, err = file.WriteString("{not json\n")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	_, err = log.Query(context.Background(), Filter{})
+	assert.ErrorContains(t, err, "line 2")
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestFileLogSharedBetweenProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	first, err := NewFileLog(path)
+	require.NoError(t, err)
+	second, err := NewFileLog(path)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		log := first
+		if i%2 == 1 {
+			log = second
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, log.Append(context.Background(), Entry{Actor: "U1", Action: ActionReported, IncidentID: fmt.Sprint(i)}))
+		}()
+	}
+	wg.Wait()
+
+	entries, err := second.Query(context.Background(), Filter{})
+	require.NoError(t, err)
+	assert.Len(t, entries, 20)
+}
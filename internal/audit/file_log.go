@@ -0,0 +1,130 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"iter"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/syltek/oncall-incident-reporter/pkg/fileutil"
+)
+
+// maxEntrySize bounds the size of a line of the file
+const maxEntrySize = 1 << 20
+
+// FileLog appends the trail to a file, one JSON entry per line. The file is only ever appended
+// to, it can be shipped by a log collector or rotated by moving it away. Appends and queries hold
+// a file lock, so the file can be shared by several processes, e.g. the Lambda execution
+// environments mounting the same EFS file system.
+type FileLog struct {
+	path string
+	// mu serializes the accesses of the process, the file lock those of the other processes
+	mu  sync.Mutex
+	now func() time.Time
+}
+
+// NewFileLog creates a FileLog appending to the file at path, created if missing
+func NewFileLog(path string) (*FileLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("close audit log: %w", err)
+	}
+	return &FileLog{path: path, now: time.Now}, nil
+}
+
+func (l *FileLog) Append(_ context.Context, entry Entry) error {
+	line, err := json.Marshal(prepare(entry, l.now))
+	if err != nil {
+		return fmt.Errorf("encode audit entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	unlock, err := l.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	if _, err := file.Write(line); err != nil {
+		file.Close()
+		return fmt.Errorf("write audit entry: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("sync audit log: %w", err)
+	}
+	return file.Close()
+}
+
+func (l *FileLog) Query(_ context.Context, filter Filter) ([]Entry, error) {
+	// Without the lock a line being appended by another process could be read half written
+	unlock, err := l.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	file, err := os.Open(l.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	defer file.Close()
+
+	var decodeErr error
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxEntrySize)
+	var entries iter.Seq[Entry] = func(yield func(Entry) bool) {
+		for line := 1; scanner.Scan(); line++ {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+			var entry Entry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				decodeErr = fmt.Errorf("decode audit entry at line %d: %w", line, err)
+				return
+			}
+			if !yield(entry) {
+				return
+			}
+		}
+	}
+
+	selected := selectEntries(entries, filter)
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+	return selected, nil
+}
+
+// lock takes the lock of the process and the file lock, and returns the function releasing them
+func (l *FileLog) lock() (func(), error) {
+	l.mu.Lock()
+	unlock, err := fileutil.Lock(l.path + ".lock")
+	if err != nil {
+		l.mu.Unlock()
+		return nil, fmt.Errorf("lock audit log: %w", err)
+	}
+	return func() {
+		unlock()
+		l.mu.Unlock()
+	}, nil
+}
@@ -0,0 +1,202 @@
+// Package authorization decides who is allowed to report and change incidents, based on the
+// rules of the configuration.
+package authorization
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+	"github.com/syltek/oncall-incident-reporter/pkg/logutil"
+	"go.uber.org/zap"
+)
+
+// Actions subject to authorization
+const (
+	ActionOpenModal   = "open_modal"
+	ActionReport      = "report_incident"
+	ActionAcknowledge = "acknowledge_incident"
+	ActionResolve     = "resolve_incident"
+	ActionViewAudit   = "view_audit"
+)
+
+// groupMembersTTL is how long the members of a Slack user group are cached
+const groupMembersTTL = 5 * time.Minute
+
+// IUserGroupsAPI lists the members of the Slack user groups of a workspace
+type IUserGroupsAPI interface {
+	GetUserGroupMembers(ctx context.Context, enterpriseID, teamID, userGroup string) ([]string, error)
+}
+
+// Request describes who is trying to do what
+type Request struct {
+	Action       string
+	UserID       string
+	ChannelID    string
+	TeamID       string
+	EnterpriseID string
+	// Severity is the severity of the incident being reported, if known
+	Severity string
+}
+
+// Decision is the outcome of an authorization request
+type Decision struct {
+	Allowed bool
+	// Reason explains a denial to the user
+	Reason string
+}
+
+// Authorizer evaluates requests against the authorization rules
+type Authorizer struct {
+	rules  *config.Authorization
+	groups IUserGroupsAPI
+
+	mu      sync.Mutex
+	members map[string]cachedMembers
+	now     func() time.Time
+}
+
+type cachedMembers struct {
+	users     []string
+	fetchedAt time.Time
+}
+
+// NewAuthorizer creates an Authorizer. Without rules every request is allowed, except reading the
+// audit trail.
+func NewAuthorizer(rules *config.Authorization, groups IUserGroupsAPI) *Authorizer {
+	return &Authorizer{
+		rules:   rules,
+		groups:  groups,
+		members: make(map[string]cachedMembers),
+		now:     time.Now,
+	}
+}
+
+// Authorize decides whether the request is allowed. Denials are logged as audit entries.
+func (a *Authorizer) Authorize(ctx context.Context, req Request) Decision {
+	decision := a.decide(ctx, req)
+	if !decision.Allowed {
+		logutil.InfoCtx(ctx, "Audit: authorization denied",
+			zap.String("audit_action", req.Action),
+			zap.String("user_id", req.UserID),
+			zap.String("team_id", req.TeamID),
+			zap.String("channel_id", req.ChannelID),
+			zap.String("severity", req.Severity),
+			zap.String("reason", decision.Reason))
+	}
+	return decision
+}
+
+func (a *Authorizer) decide(ctx context.Context, req Request) Decision {
+	if req.Action == ActionViewAudit {
+		return a.decideViewAudit(ctx, req)
+	}
+	if a.rules == nil {
+		return Decision{Allowed: true}
+	}
+
+	switch req.Action {
+	case ActionOpenModal, ActionReport:
+		if !a.allowedChannel(a.rules.AccessRule, req.ChannelID) {
+			return Decision{Reason: "Incidents cannot be reported from this channel."}
+		}
+		if !a.allowedUser(ctx, a.rules.AccessRule, req) {
+			return Decision{Reason: "You are not allowed to report incidents."}
+		}
+	case ActionAcknowledge, ActionResolve:
+		// Incident actions happen in the announcement channel, only the user is checked
+		if !a.allowedUser(ctx, a.rules.AccessRule, req) {
+			return Decision{Reason: "You are not allowed to change incidents."}
+		}
+		return Decision{Allowed: true}
+	}
+
+	if req.Action == ActionReport && req.Severity != "" {
+		if rule, ok := a.rules.SeverityRule(req.Severity); ok {
+			if !a.allowedChannel(rule, req.ChannelID) {
+				return Decision{Reason: "*" + req.Severity + "* incidents cannot be reported from this channel."}
+			}
+			if !a.allowedUser(ctx, rule, req) {
+				return Decision{Reason: "You are not allowed to report *" + req.Severity + "* incidents, please pick a lower severity or ask the on-call team."}
+			}
+		}
+	}
+
+	return Decision{Allowed: true}
+}
+
+// decideViewAudit decides whether the user can read the audit trail. Unlike the other actions,
+// it is denied unless a rule grants it.
+func (a *Authorizer) decideViewAudit(ctx context.Context, req Request) Decision {
+	denied := Decision{Reason: "You are not allowed to view the audit trail."}
+	if a.rules == nil {
+		return denied
+	}
+	rule := a.rules.ViewAudit
+	if len(rule.AllowedUsers) == 0 && len(rule.AllowedUserGroups) == 0 {
+		return denied
+	}
+	if !a.allowedChannel(rule, req.ChannelID) || !a.allowedUser(ctx, rule, req) {
+		return denied
+	}
+	return Decision{Allowed: true}
+}
+
+// allowedChannel reports whether the rule allows the channel. The channel of a modal submission
+// is unknown when the modal was opened before the rules were configured, it is then allowed.
+func (a *Authorizer) allowedChannel(rule config.AccessRule, channelID string) bool {
+	if len(rule.AllowedChannels) == 0 || channelID == "" {
+		return true
+	}
+	return slices.Contains(rule.AllowedChannels, channelID)
+}
+
+// allowedUser reports whether the rule allows the user, directly or through a user group
+func (a *Authorizer) allowedUser(ctx context.Context, rule config.AccessRule, req Request) bool {
+	if len(rule.AllowedUsers) == 0 && len(rule.AllowedUserGroups) == 0 {
+		return true
+	}
+	if slices.Contains(rule.AllowedUsers, req.UserID) {
+		return true
+	}
+	for _, group := range rule.AllowedUserGroups {
+		if ctx.Err() != nil {
+			return false
+		}
+		members, err := a.groupMembers(ctx, req.EnterpriseID, req.TeamID, group)
+		if err != nil {
+			// Fail closed, a user group that cannot be read grants nothing
+			logutil.ErrorCtx(ctx, "Failed to list user group members", zap.String("user_group", group), zap.Error(err))
+			continue
+		}
+		if slices.Contains(members, req.UserID) {
+			return true
+		}
+	}
+	return false
+}
+
+// groupMembers returns the members of a user group, cached for groupMembersTTL. The lock is not
+// held while Slack is called, so a slow call does not hold up the requests of other groups.
+func (a *Authorizer) groupMembers(ctx context.Context, enterpriseID, teamID, group string) ([]string, error) {
+	// Members are read through the token of the workspace, cache them per workspace
+	key := teamID + "/" + group
+	now := a.now()
+	a.mu.Lock()
+	cached, ok := a.members[key]
+	a.mu.Unlock()
+	if ok && now.Sub(cached.fetchedAt) < groupMembersTTL {
+		return cached.users, nil
+	}
+
+	users, err := a.groups.GetUserGroupMembers(ctx, enterpriseID, teamID, group)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	a.members[key] = cachedMembers{users: users, fetchedAt: now}
+	a.mu.Unlock()
+	return users, nil
+}
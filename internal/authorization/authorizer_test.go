@@ -0,0 +1,143 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+)
+
+// fakeUserGroups serves user group members from memory and counts the lookups
+type fakeUserGroups struct {
+	members map[string][]string
+	calls   int
+}
+
+func (f *fakeUserGroups) GetUserGroupMembers(_ context.Context, _, _, userGroup string) ([]string, error) {
+	f.calls++
+	members, ok := f.members[userGroup]
+	if !ok {
+		return nil, errors.New("no_such_subteam")
+	}
+	return members, nil
+}
+
+func TestAuthorize(t *testing.T) {
+	rules := &config.Authorization{
+		AccessRule: config.AccessRule{
+			AllowedUsers:      []string{"U_ALICE"},
+			AllowedUserGroups: []string{"S_ENGINEERS", "S_MISSING"},
+			AllowedChannels:   []string{"C_INCIDENTS"},
+		},
+		Severities: map[string]config.AccessRule{
+			"high": {AllowedUserGroups: []string{"S_ONCALL"}},
+		},
+		ViewAudit: config.AccessRule{AllowedUserGroups: []string{"S_ONCALL"}},
+	}
+	groups := &fakeUserGroups{members: map[string][]string{
+		"S_ENGINEERS": {"U_BOB", "U_CAROL"},
+		"S_ONCALL":    {"U_CAROL"},
+	}}
+	authorizer := NewAuthorizer(rules, groups)
+
+	tests := []struct {
+		name    string
+		req     Request
+		allowed bool
+	}{
+		{"allowed user", Request{Action: ActionOpenModal, UserID: "U_ALICE", ChannelID: "C_INCIDENTS"}, true},
+		{"allowed through user group", Request{Action: ActionOpenModal, UserID: "U_BOB", ChannelID: "C_INCIDENTS"}, true},
+		{"unknown user", Request{Action: ActionOpenModal, UserID: "U_MALLORY", ChannelID: "C_INCIDENTS"}, false},
+		{"other channel", Request{Action: ActionOpenModal, UserID: "U_ALICE", ChannelID: "C_RANDOM"}, false},
+		{"unknown channel of an old modal", Request{Action: ActionReport, UserID: "U_ALICE", Severity: "Low"}, true},
+		{"severity without rule", Request{Action: ActionReport, UserID: "U_BOB", ChannelID: "C_INCIDENTS", Severity: "Low"}, true},
+		{"restricted severity", Request{Action: ActionReport, UserID: "U_BOB", ChannelID: "C_INCIDENTS", Severity: "High"}, false},
+		{"restricted severity, allowed group", Request{Action: ActionReport, UserID: "U_CAROL", ChannelID: "C_INCIDENTS", Severity: "High"}, true},
+		{"incident action outside the report channels", Request{Action: ActionResolve, UserID: "U_BOB", ChannelID: "C_ANNOUNCEMENTS"}, true},
+		{"incident action by unknown user", Request{Action: ActionAcknowledge, UserID: "U_MALLORY", ChannelID: "C_ANNOUNCEMENTS"}, false},
+		{"audit trail viewer", Request{Action: ActionViewAudit, UserID: "U_CAROL", ChannelID: "C_RANDOM"}, true},
+		{"audit trail read by a reporter", Request{Action: ActionViewAudit, UserID: "U_ALICE", ChannelID: "C_INCIDENTS"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := authorizer.Authorize(context.Background(), tt.req)
+			assert.Equal(t, tt.allowed, decision.Allowed)
+			if !tt.allowed {
+				assert.NotEmpty(t, decision.Reason)
+			}
+		})
+	}
+}
+
+func TestAuthorizeWithoutRules(t *testing.T) {
+	authorizer := NewAuthorizer(nil, nil)
+	decision := authorizer.Authorize(context.Background(), Request{Action: ActionReport, UserID: "U_ANYONE", Severity: "High"})
+	assert.True(t, decision.Allowed)
+
+	// The audit trail must be explicitly granted
+	decision = authorizer.Authorize(context.Background(), Request{Action: ActionViewAudit, UserID: "U_ANYONE"})
+	assert.False(t, decision.Allowed)
+}
+
+func TestUserGroupMembersAreCached(t *testing.T) {
+	rules := &config.Authorization{AccessRule: config.AccessRule{AllowedUserGroups: []string{"S_ENGINEERS"}}}
+	groups := &fakeUserGroups{members: map[string][]string{"S_ENGINEERS": {"U_BOB"}}}
+	authorizer := NewAuthorizer(rules, groups)
+	now := time.Unix(1_700_000_000, 0)
+	authorizer.now = func() time.Time { return now }
+
+	req := Request{Action: ActionOpenModal, UserID: "U_BOB"}
+	assert.True(t, authorizer.Authorize(context.Background(), req).Allowed)
+	assert.True(t, authorizer.Authorize(context.Background(), req).Allowed)
+	assert.Equal(t, 1, groups.calls)
+
+	groups.members["S_ENGINEERS"] = nil
+	now = now.Add(groupMembersTTL)
+	assert.False(t, authorizer.Authorize(context.Background(), req).Allowed)
+	assert.Equal(t, 2, groups.calls)
+}
+
+// blockingUserGroups blocks the lookups of one workspace until released
+type blockingUserGroups struct {
+	blockedTeam string
+	started     chan struct{}
+	release     chan struct{}
+}
+
+func (b *blockingUserGroups) GetUserGroupMembers(_ context.Context, _, teamID, _ string) ([]string, error) {
+	if teamID == b.blockedTeam {
+		close(b.started)
+		<-b.release
+	}
+	return []string{"U_BOB"}, nil
+}
+
+func TestUserGroupLookupDoesNotBlockOthers(t *testing.T) {
+	rules := &config.Authorization{AccessRule: config.AccessRule{AllowedUserGroups: []string{"S_ENGINEERS"}}}
+	groups := &blockingUserGroups{blockedTeam: "T1", started: make(chan struct{}), release: make(chan struct{})}
+	authorizer := NewAuthorizer(rules, groups)
+
+	blocked := make(chan bool)
+	go func() {
+		blocked <- authorizer.Authorize(context.Background(), Request{Action: ActionOpenModal, UserID: "U_BOB", TeamID: "T1"}).Allowed
+	}()
+	<-groups.started
+
+	done := make(chan bool)
+	go func() {
+		done <- authorizer.Authorize(context.Background(), Request{Action: ActionOpenModal, UserID: "U_BOB", TeamID: "T2"}).Allowed
+	}()
+	select {
+	case allowed := <-done:
+		assert.True(t, allowed)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the lookup of another workspace waited for the blocked one")
+	}
+
+	close(groups.release)
+	assert.True(t, <-blocked)
+}
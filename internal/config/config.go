@@ -2,18 +2,31 @@
 package config
 
 import (
+	"bytes"
+	"context"
 	"fmt"
-	"os"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 )
 
 const (
 	slackTokenEnv           = "SLACK_TOKEN"
 	slackSigningSecretEnv   = "SLACK_SIGNING_SECRET"
+	slackPreviousSecretEnv  = "SLACK_SIGNING_SECRET_PREVIOUS"
+	slackAppTokenEnv        = "SLACK_APP_TOKEN"
+	slackClientIDEnv        = "SLACK_CLIENT_ID"
+	slackClientSecretEnv    = "SLACK_CLIENT_SECRET"
 	logLevelEnv             = "LOG_LEVEL"
 	localPortEnv            = "LOCAL_PORT"
 	localShutdownTimeoutEnv = "LOCAL_SHUTDOWN_TIMEOUT"
+	serverAddressEnv        = "SERVER_ADDRESS"
+	serverAdminAddressEnv   = "SERVER_ADMIN_ADDRESS"
+	auditExportTokenEnv     = "AUDIT_EXPORT_TOKEN"
 	configFileEnv           = "CONFIG_FILE"
 )
 
@@ -22,29 +35,204 @@ const (
 )
 
 const (
-	DEFAULT_LOCAL_PORT             = 8080
-	DEFAULT_LOCAL_SHUTDOWN_TIMEOUT = 5
-	DEFAULT_LOG_LEVEL              = "INFO"
+	DEFAULT_LOCAL_PORT              = 8080
+	DEFAULT_LOCAL_SHUTDOWN_TIMEOUT  = 5
+	DEFAULT_LOG_LEVEL               = "INFO"
+	DEFAULT_DATADOG_APP_URL         = "https://app.datadoghq.com"
+	DEFAULT_METRICS_PREFIX          = "oncall_incident_reporter"
+	DEFAULT_METRICS_FLUSH_INTERVAL  = 10
+	DEFAULT_RETRY_MAX_ATTEMPTS      = 3
+	DEFAULT_RETRY_INITIAL_BACKOFF   = 200
+	DEFAULT_RETRY_MAX_BACKOFF       = 5000
+	DEFAULT_INCIDENTS_STORE         = STORE_MEMORY
+	DEFAULT_INCIDENTS_STORE_PATH    = "incidents.json"
+	DEFAULT_MAX_DELIVERY_ATTEMPTS   = 5
+	DEFAULT_DELIVERY_RETRY_INTERVAL = 60
+	DEFAULT_DEDUPLICATION_WINDOW    = 900
+	DEFAULT_SLACK_REQUEST_MAX_AGE   = 300
+	DEFAULT_SECRETS_CACHE_TTL       = 300
+	DEFAULT_OAUTH_INSTALL_PATH      = "/slack/install"
+	DEFAULT_OAUTH_CALLBACK_PATH     = "/slack/oauth/callback"
+	DEFAULT_OAUTH_EVENTS_PATH       = "/slack/events"
+	DEFAULT_OAUTH_STORE             = STORE_FILE
+	DEFAULT_OAUTH_STORE_PATH        = "installations.json"
+	DEFAULT_SERVER_ADDRESS          = ":8080"
+	DEFAULT_SERVER_READ_TIMEOUT     = 5
+	DEFAULT_SERVER_WRITE_TIMEOUT    = 10
+	DEFAULT_SERVER_IDLE_TIMEOUT     = 120
+	DEFAULT_SERVER_SHUTDOWN_TIMEOUT = 20
+	DEFAULT_TLS_RELOAD_INTERVAL     = 60
+	DEFAULT_TRACING_EXPORTER        = TRACING_EXPORTER_OTLP
+	DEFAULT_TRACING_SAMPLE_RATIO    = 1.0
+	DEFAULT_AUDIT_STORE             = STORE_MEMORY
+	DEFAULT_AUDIT_STORE_PATH        = "audit.jsonl"
+	DEFAULT_AUDIT_EXPORT_PATH       = "/audit/export"
+	DEFAULT_RELOAD_INTERVAL         = 60
 )
 
+// DEFAULT_OAUTH_SCOPES are the bot scopes requested when installing the app
+var DEFAULT_OAUTH_SCOPES = []string{"commands", "chat:write", "channels:history", "groups:history", "usergroups:read"}
+
 const (
 	DEBUG_LOG_LEVEL = "DEBUG"
 )
 
+const (
+	STORE_MEMORY = "memory"
+	STORE_FILE   = "file"
+)
+
+const (
+	TRACING_EXPORTER_OTLP   = "otlp"
+	TRACING_EXPORTER_STDOUT = "stdout"
+)
+
+// Personal data detected by the scrubbing of incidents
+const (
+	SCRUB_DETECTOR_EMAIL = "email"
+	SCRUB_DETECTOR_PHONE = "phone"
+	SCRUB_DETECTOR_IBAN  = "iban"
+	SCRUB_DETECTOR_PAN   = "pan"
+)
+
+// Policies of the sinks receiving incidents
+const (
+	// SCRUB_POLICY_FULL sends the incident as reported
+	SCRUB_POLICY_FULL = "full"
+	// SCRUB_POLICY_SCRUBBED masks the personal data detected in the incident
+	SCRUB_POLICY_SCRUBBED = "scrubbed"
+)
+
+// SCRUB_DETECTORS are all the detectors, enabled when none is configured
+var SCRUB_DETECTORS = []string{SCRUB_DETECTOR_EMAIL, SCRUB_DETECTOR_PHONE, SCRUB_DETECTOR_IBAN, SCRUB_DETECTOR_PAN}
+
+// DEFAULT_SCRUB_POLICIES are the policies of the sinks not configured. Slack is where the
+// incident is handled and gets the full text, third parties get it scrubbed.
+var DEFAULT_SCRUB_POLICIES = map[string]string{
+	"slack":   SCRUB_POLICY_FULL,
+	"datadog": SCRUB_POLICY_SCRUBBED,
+	"audit":   SCRUB_POLICY_SCRUBBED,
+}
+
 // Config holds the complete application configuration
 type Config struct {
-	Metadata    *Metadata    `mapstructure:"metadata"`
-	SlackConfig *SlackConfig `mapstructure:"slack_config"`
-	Endpoints   *Endpoints   `mapstructure:"endpoints"`
-	Modal       *Modal       `mapstructure:"modal"`
-	Local       *Local       `mapstructure:"local"`
-	LogLevel    string       `mapstructure:"log_level"`
+	Metadata      *Metadata      `mapstructure:"metadata"`
+	SlackConfig   *SlackConfig   `mapstructure:"slack_config"`
+	Endpoints     *Endpoints     `mapstructure:"endpoints"`
+	Modal         *Modal         `mapstructure:"modal"`
+	Local         *Local         `mapstructure:"local"`
+	Server        *Server        `mapstructure:"server"`
+	Datadog       *Datadog       `mapstructure:"datadog"`
+	Metrics       *Metrics       `mapstructure:"metrics"`
+	Retry         *Retry         `mapstructure:"retry"`
+	Incidents     *Incidents     `mapstructure:"incidents"`
+	Deduplication *Deduplication `mapstructure:"deduplication"`
+	Secrets       *Secrets       `mapstructure:"secrets"`
+	Authorization *Authorization `mapstructure:"authorization"`
+	OAuth         *OAuth         `mapstructure:"oauth"`
+	Tracing       *Tracing       `mapstructure:"tracing"`
+	Redaction     *Redaction     `mapstructure:"redaction"`
+	Scrubbing     *Scrubbing     `mapstructure:"scrubbing"`
+	Audit         *Audit         `mapstructure:"audit"`
+	Reload        *Reload        `mapstructure:"reload"`
+	// Workspaces overrides the channel and modal of the workspaces the app is installed to,
+	// keyed by team ID (case-insensitive)
+	Workspaces map[string]Workspace `mapstructure:"workspaces"`
+	LogLevel   string               `mapstructure:"log_level"`
+
+	// secretReferences counts the settings resolved from a secret store
+	secretReferences int
 }
 
 type Local struct {
 	Enabled         bool `mapstructure:"enabled"`
 	Port            int  `mapstructure:"port"`
 	ShutdownTimeout int  `mapstructure:"shutdown_timeout"`
+	// SocketMode receives Slack requests over a websocket opened with the app-level token
+	// instead of serving HTTP, so no public URL is needed
+	SocketMode bool `mapstructure:"socket_mode"`
+}
+
+// Server runs the application as a long-running HTTP server, for container deployments
+type Server struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Address string `mapstructure:"address"`
+	// Timeouts, in seconds. The read header timeout defaults to the read timeout.
+	ReadTimeout       int  `mapstructure:"read_timeout"`
+	ReadHeaderTimeout int  `mapstructure:"read_header_timeout"`
+	WriteTimeout      int  `mapstructure:"write_timeout"`
+	IdleTimeout       int  `mapstructure:"idle_timeout"`
+	ShutdownTimeout   int  `mapstructure:"shutdown_timeout"`
+	TLS               *TLS `mapstructure:"tls"`
+	// AdminAddress serves the health checks on a separate listener, kept off the public one.
+	// Empty serves them with the Slack routes.
+	AdminAddress string `mapstructure:"admin_address"`
+}
+
+// TLS serves HTTPS with a certificate reloaded when its files change, or on SIGHUP
+type TLS struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	// ReloadInterval is how often, in seconds, the files are checked for changes. 0 only
+	// reloads them on SIGHUP.
+	ReloadInterval int `mapstructure:"reload_interval"`
+}
+
+// Tracing exports OpenTelemetry traces of the requests and of the calls to Slack and Datadog
+type Tracing struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Exporter is "otlp", sending spans over OTLP/HTTP, or "stdout" to print them
+	Exporter string `mapstructure:"exporter"`
+	// Endpoint of the OTLP collector, e.g. "otel-collector:4318". Empty uses the
+	// OTEL_EXPORTER_OTLP_ENDPOINT environment variable, or localhost.
+	Endpoint string `mapstructure:"endpoint"`
+	Insecure bool   `mapstructure:"insecure"`
+	// SampleRatio is the share of the traces started by the application that are recorded
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+}
+
+// Redaction masks more data in the logs than the secrets always redacted
+type Redaction struct {
+	// Patterns are regular expressions, their matches are replaced by "[REDACTED]"
+	Patterns []string `mapstructure:"patterns"`
+	// Fields are the names of the log fields, and of the keys of logged objects, whose value is
+	// always redacted, e.g. "description" to keep what reporters type out of the logs
+	Fields []string `mapstructure:"fields"`
+}
+
+// Scrubbing masks the personal data reporters paste in incidents, e.g. customer emails, phone
+// numbers or card numbers, before the incidents are sent to third parties
+type Scrubbing struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Detectors are the personal data to mask: email, phone, iban and pan. Empty enables all.
+	Detectors []string `mapstructure:"detectors"`
+	// Sinks maps the name of a sink to its policy, "full" or "scrubbed". Sinks not listed get
+	// their default policy.
+	Sinks map[string]string `mapstructure:"sinks"`
+}
+
+// PolicyFor returns the scrubbing policy of the sink. Without scrubbing, every sink gets the full
+// incident. Unknown sinks are scrubbed.
+func (s *Scrubbing) PolicyFor(sink string) string {
+	if s == nil || !s.Enabled {
+		return SCRUB_POLICY_FULL
+	}
+	if policy, ok := s.Sinks[sink]; ok {
+		return policy
+	}
+	if policy, ok := DEFAULT_SCRUB_POLICIES[sink]; ok {
+		return policy
+	}
+	return SCRUB_POLICY_SCRUBBED
+}
+
+// EnabledDetectors returns the detectors to run
+func (s *Scrubbing) EnabledDetectors() []string {
+	if s == nil || len(s.Detectors) == 0 {
+		return SCRUB_DETECTORS
+	}
+	return s.Detectors
 }
 
 type Metadata struct {
@@ -57,8 +245,166 @@ type Metadata struct {
 type SlackConfig struct {
 	Token         string `mapstructure:"slack_token"`
 	SigningSecret string `mapstructure:"slack_signing_secret"`
-	ChannelID     string `mapstructure:"channel_id"`
-	MessageFormat string `mapstructure:"message_format"`
+	// AppToken is the app-level token (xapp-...) used to connect in Socket Mode
+	AppToken string `mapstructure:"slack_app_token"`
+	// PreviousSigningSecret is the secret being rotated out, accepted until it is removed
+	PreviousSigningSecret string `mapstructure:"slack_signing_secret_previous"`
+	// SigningSecrets lists additional active signing secrets identified by a key ID
+	SigningSecrets []SigningSecret `mapstructure:"signing_secrets"`
+	ChannelID      string          `mapstructure:"channel_id"`
+	MessageFormat  string          `mapstructure:"message_format"`
+	// RequestMaxAge is the maximum age, in seconds, of a signed request from Slack
+	RequestMaxAge int `mapstructure:"request_max_age"`
+}
+
+// SigningSecret is a Slack signing secret identified by a key ID, logged when it matches
+type SigningSecret struct {
+	ID     string `mapstructure:"id"`
+	Secret string `mapstructure:"secret"`
+}
+
+// Key IDs of the signing secrets set through environment variables
+const (
+	CURRENT_SIGNING_SECRET_ID  = "current"
+	PREVIOUS_SIGNING_SECRET_ID = "previous"
+)
+
+// ActiveSigningSecrets returns every signing secret a Slack request may be signed with. During a
+// rotation both the new and the old secret are active so requests are accepted without downtime.
+func (s *SlackConfig) ActiveSigningSecrets() []SigningSecret {
+	if s == nil {
+		return nil
+	}
+
+	var secrets []SigningSecret
+	if s.SigningSecret != "" {
+		secrets = append(secrets, SigningSecret{ID: CURRENT_SIGNING_SECRET_ID, Secret: s.SigningSecret})
+	}
+	if s.PreviousSigningSecret != "" {
+		secrets = append(secrets, SigningSecret{ID: PREVIOUS_SIGNING_SECRET_ID, Secret: s.PreviousSigningSecret})
+	}
+	for _, secret := range s.SigningSecrets {
+		if secret.Secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets
+}
+
+// Secrets holds the configuration of the secret references resolution
+type Secrets struct {
+	// CacheTTL is the time, in seconds, a fetched secret is reused before being fetched again
+	CacheTTL int `mapstructure:"cache_ttl"`
+}
+
+// OAuth holds the configuration of the OAuth v2 install flow, letting the app be installed to
+// several workspaces instead of using a single bot token
+type OAuth struct {
+	Enabled      bool   `mapstructure:"enabled"`
+	ClientID     string `mapstructure:"client_id"`
+	ClientSecret string `mapstructure:"client_secret"`
+	// RedirectURL is the public URL of the callback path, as registered in the Slack app
+	RedirectURL  string   `mapstructure:"redirect_url"`
+	Scopes       []string `mapstructure:"scopes"`
+	InstallPath  string   `mapstructure:"install_path"`
+	CallbackPath string   `mapstructure:"callback_path"`
+	// EventsPath receives the app_uninstalled and tokens_revoked events, the Request URL of the
+	// Event Subscriptions of the Slack app
+	EventsPath string `mapstructure:"events_path"`
+	// Store is where the bot tokens of the installations are kept: memory or file
+	Store     string `mapstructure:"store"`
+	StorePath string `mapstructure:"store_path"`
+	// AllowedTeams and AllowedEnterprises are the workspaces and Enterprise Grid organizations
+	// the app may be installed to
+	AllowedTeams       []string `mapstructure:"allowed_teams"`
+	AllowedEnterprises []string `mapstructure:"allowed_enterprises"`
+}
+
+// AllowsInstall reports whether the app may be installed to the workspace, or to the whole
+// organization for an enterprise install
+func (o *OAuth) AllowsInstall(enterpriseID, teamID string, enterpriseInstall bool) bool {
+	matches := func(ids []string, id string) bool {
+		return id != "" && slices.ContainsFunc(ids, func(allowed string) bool { return strings.EqualFold(allowed, id) })
+	}
+	if matches(o.AllowedEnterprises, enterpriseID) {
+		return true
+	}
+	return !enterpriseInstall && matches(o.AllowedTeams, teamID)
+}
+
+// Workspace overrides the configuration for a single workspace
+type Workspace struct {
+	ChannelID string `mapstructure:"channel_id"`
+	Modal     *Modal `mapstructure:"modal"`
+}
+
+// workspace returns the overrides of a workspace, if any
+func (c *Config) workspace(teamID string) (Workspace, bool) {
+	// Viper lowercases map keys
+	workspace, ok := c.Workspaces[strings.ToLower(teamID)]
+	return workspace, ok && teamID != ""
+}
+
+// ChannelIDFor returns the channel incidents reported from a workspace are announced in
+func (c *Config) ChannelIDFor(teamID string) string {
+	if workspace, ok := c.workspace(teamID); ok && workspace.ChannelID != "" {
+		return workspace.ChannelID
+	}
+	if c.SlackConfig == nil {
+		return ""
+	}
+	return c.SlackConfig.ChannelID
+}
+
+// ModalFor returns the incident modal shown in a workspace
+func (c *Config) ModalFor(teamID string) *Modal {
+	if workspace, ok := c.workspace(teamID); ok && workspace.Modal != nil {
+		return workspace.Modal
+	}
+	return c.Modal
+}
+
+// HasAnnouncementChannel reports whether incidents are announced in Slack in any workspace
+func (c *Config) HasAnnouncementChannel() bool {
+	if c.SlackConfig != nil && c.SlackConfig.ChannelID != "" {
+		return true
+	}
+	for _, workspace := range c.Workspaces {
+		if workspace.ChannelID != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorization restricts who can report and change incidents. Without it, anyone able to run
+// the slash command can report incidents of any severity.
+type Authorization struct {
+	AccessRule `mapstructure:",squash"`
+	// Severities holds additional rules for reporting incidents of a given severity, keyed by
+	// the severity option (case-insensitive)
+	Severities map[string]AccessRule `mapstructure:"severities"`
+	// ViewAudit lists who can read the audit trail in Slack. Nobody can unless it lists users
+	// or user groups.
+	ViewAudit AccessRule `mapstructure:"view_audit"`
+}
+
+// AccessRule lists who is allowed to do something. An empty list does not restrict anything.
+// A user is allowed if listed in AllowedUsers or member of one of AllowedUserGroups.
+type AccessRule struct {
+	AllowedUsers      []string `mapstructure:"allowed_users"`
+	AllowedUserGroups []string `mapstructure:"allowed_user_groups"`
+	AllowedChannels   []string `mapstructure:"allowed_channels"`
+}
+
+// SeverityRule returns the rule for reporting incidents of the given severity, if any
+func (a *Authorization) SeverityRule(severity string) (AccessRule, bool) {
+	if a == nil {
+		return AccessRule{}, false
+	}
+	// Viper lowercases map keys
+	rule, ok := a.Severities[strings.ToLower(severity)]
+	return rule, ok
 }
 
 // Endpoints holds API endpoint configurations
@@ -67,6 +413,99 @@ type Endpoints struct {
 	SlackModalParser string `mapstructure:"slack_modal_parser"`
 }
 
+// Datadog holds Datadog-specific configuration
+type Datadog struct {
+	// AppURL is the base URL of the Datadog web application, used to build monitor links
+	AppURL string `mapstructure:"app_url"`
+	// Domains maps an affected domain (as selected in the modal) to its Datadog context.
+	// Viper lowercases map keys, so lookups must go through DomainContext.
+	Domains map[string]DomainContext `mapstructure:"domains"`
+}
+
+// DomainContext holds the dashboards, monitors and alert lookup tag for a single domain
+type DomainContext struct {
+	// MonitorTag is the tag used to look up monitors in Alert state, e.g. "domain:payments"
+	MonitorTag string `mapstructure:"monitor_tag"`
+	Dashboards []Link `mapstructure:"dashboards"`
+	Monitors   []Link `mapstructure:"monitors"`
+}
+
+// Link represents a titled URL
+type Link struct {
+	Title string `mapstructure:"title"`
+	URL   string `mapstructure:"url"`
+}
+
+// DomainContext returns the Datadog context configured for the given domain, if any
+func (d *Datadog) DomainContext(domain string) (DomainContext, bool) {
+	if d == nil || domain == "" {
+		return DomainContext{}, false
+	}
+	domainContext, ok := d.Domains[strings.ToLower(domain)]
+	return domainContext, ok
+}
+
+// Metrics holds the custom metrics configuration
+type Metrics struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Prefix  string `mapstructure:"prefix"`
+	// FlushInterval is the interval, in seconds, between metric flushes when running a local server.
+	// In Lambda mode metrics are flushed at the end of every invocation.
+	FlushInterval int `mapstructure:"flush_interval"`
+}
+
+// Retry holds the retry policy for outbound calls to Slack and Datadog
+type Retry struct {
+	MaxAttempts    int `mapstructure:"max_attempts"`
+	InitialBackoff int `mapstructure:"initial_backoff"` // milliseconds
+	MaxBackoff     int `mapstructure:"max_backoff"`     // milliseconds
+}
+
+// Incidents holds the incident storage and delivery configuration
+type Incidents struct {
+	// Store is either "memory" or "file"
+	Store     string `mapstructure:"store"`
+	StorePath string `mapstructure:"store_path"`
+	// MaxDeliveryAttempts is the number of times delivering an incident to a sink is attempted
+	MaxDeliveryAttempts int `mapstructure:"max_delivery_attempts"`
+	// RetryInterval is the interval, in seconds, between retries of failed deliveries
+	RetryInterval int `mapstructure:"retry_interval"`
+}
+
+// Reload configures the reload of the configuration while running. A local file is watched in
+// server and local modes, a remote one is fetched again every interval.
+type Reload struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Interval is the number of seconds between two fetches of a configuration kept in S3 or
+	// served over HTTP
+	Interval int `mapstructure:"interval"`
+}
+
+// Audit records who reported and changed incidents in an append-only trail
+type Audit struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Store is either "memory" or "file", a file of JSON lines
+	Store     string `mapstructure:"store"`
+	StorePath string `mapstructure:"store_path"`
+	// ExportPath serves the trail as JSON lines to the holders of the export token. The
+	// endpoint is not served without a token.
+	ExportPath  string `mapstructure:"export_path"`
+	ExportToken string `mapstructure:"export_token"`
+}
+
+// ExportEnabled reports whether the audit trail can be exported over HTTP
+func (a *Audit) ExportEnabled() bool {
+	return a != nil && a.Enabled && a.ExportToken != "" && a.ExportPath != ""
+}
+
+// Deduplication holds the configuration of the similar incident check
+type Deduplication struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Window is the time, in seconds, during which an unresolved incident with the same domain
+	// and severity is considered a possible duplicate
+	Window int `mapstructure:"window"`
+}
+
 // Modal represents the modal dialog configuration
 type Modal struct {
 	Title  string  `mapstructure:"title"`
@@ -94,54 +533,129 @@ func LoadConfig() (*Config, error) {
 
 // LoadConfigWithViper configures the Viper instance with initial settings
 func LoadConfigWithViper(v *viper.Viper) (*Config, error) {
+	return LoadConfigWithSecrets(context.Background(), v, DefaultSecretResolver())
+}
+
+// LoadConfigWithSecrets loads the configuration, resolving secret references such as
+// secretsmanager://name#key, ssm:///path or file:///path through the given resolver
+func LoadConfigWithSecrets(ctx context.Context, v *viper.Viper, resolver *SecretResolver) (*Config, error) {
 	// Bind env variables before any other operations
-	v.BindEnv("slack_config.slack_token", slackTokenEnv)
-	v.BindEnv("slack_config.slack_signing_secret", slackSigningSecretEnv)
-	v.BindEnv("log_level", logLevelEnv)
-	v.BindEnv("local.port", localPortEnv)
-	v.BindEnv("local.shutdown_timeout", localShutdownTimeoutEnv)
+	bindEnv(v)
 
 	if err := setupViper(v); err != nil {
 		return nil, fmt.Errorf("setup viper: %w", err)
 	}
 
-	if err := readConfiguration(v); err != nil {
+	if err := readConfiguration(ctx, v); err != nil {
 		return nil, fmt.Errorf("read configuration: %w", err)
 	}
 
-	config, err := unmarshalConfig(v)
+	config, unknownKeys, err := unmarshalConfig(v)
 	if err != nil {
 		return nil, fmt.Errorf("unmarshal config: %w", err)
 	}
 
-	if err := config.validate(); err != nil {
+	if err := config.resolveSecrets(ctx, resolver); err != nil {
+		return nil, fmt.Errorf("resolve secrets: %w", err)
+	}
+
+	if err := config.check(unknownKeys, true); err != nil {
 		return nil, fmt.Errorf("validate config: %w", err)
 	}
 
 	return config, nil
 }
 
+// bindEnv binds the settings read from environment variables
+func bindEnv(v *viper.Viper) {
+	v.BindEnv("slack_config.slack_token", slackTokenEnv)
+	v.BindEnv("slack_config.slack_signing_secret", slackSigningSecretEnv)
+	v.BindEnv("slack_config.slack_signing_secret_previous", slackPreviousSecretEnv)
+	v.BindEnv("slack_config.slack_app_token", slackAppTokenEnv)
+	v.BindEnv("oauth.client_id", slackClientIDEnv)
+	v.BindEnv("oauth.client_secret", slackClientSecretEnv)
+	v.BindEnv("log_level", logLevelEnv)
+	v.BindEnv("local.port", localPortEnv)
+	v.BindEnv("local.shutdown_timeout", localShutdownTimeoutEnv)
+	v.BindEnv("server.address", serverAddressEnv)
+	v.BindEnv("server.admin_address", serverAdminAddressEnv)
+	v.BindEnv("audit.export_token", auditExportTokenEnv)
+}
+
 // setupViper configures the Viper instance with initial settings
 func setupViper(v *viper.Viper) error {
 	// Read config file from environment variable
-	configFile := os.Getenv(configFileEnv)
-
-	if configFile == "" {
-		configFile = defaultConfigFile
-	}
-	v.SetConfigFile(configFile)
+	v.SetConfigFile(ConfigLocation())
 
 	// Set default values
 	v.SetDefault("local.enabled", false)
 	v.SetDefault("local.port", DEFAULT_LOCAL_PORT)
 	v.SetDefault("local.shutdown_timeout", DEFAULT_LOCAL_SHUTDOWN_TIMEOUT)
+	v.SetDefault("local.socket_mode", false)
+	v.SetDefault("server.enabled", false)
+	v.SetDefault("server.address", DEFAULT_SERVER_ADDRESS)
+	v.SetDefault("server.read_timeout", DEFAULT_SERVER_READ_TIMEOUT)
+	v.SetDefault("server.write_timeout", DEFAULT_SERVER_WRITE_TIMEOUT)
+	v.SetDefault("server.idle_timeout", DEFAULT_SERVER_IDLE_TIMEOUT)
+	v.SetDefault("server.shutdown_timeout", DEFAULT_SERVER_SHUTDOWN_TIMEOUT)
+	v.SetDefault("server.tls.enabled", false)
+	v.SetDefault("server.tls.reload_interval", DEFAULT_TLS_RELOAD_INTERVAL)
+	v.SetDefault("tracing.enabled", false)
+	v.SetDefault("scrubbing.enabled", true)
+	v.SetDefault("tracing.exporter", DEFAULT_TRACING_EXPORTER)
+	v.SetDefault("tracing.sample_ratio", DEFAULT_TRACING_SAMPLE_RATIO)
 	v.SetDefault("log_level", DEFAULT_LOG_LEVEL)
+	v.SetDefault("slack_config.request_max_age", DEFAULT_SLACK_REQUEST_MAX_AGE)
+	v.SetDefault("datadog.app_url", DEFAULT_DATADOG_APP_URL)
+	v.SetDefault("metrics.enabled", false)
+	v.SetDefault("metrics.prefix", DEFAULT_METRICS_PREFIX)
+	v.SetDefault("metrics.flush_interval", DEFAULT_METRICS_FLUSH_INTERVAL)
+	v.SetDefault("retry.max_attempts", DEFAULT_RETRY_MAX_ATTEMPTS)
+	v.SetDefault("retry.initial_backoff", DEFAULT_RETRY_INITIAL_BACKOFF)
+	v.SetDefault("retry.max_backoff", DEFAULT_RETRY_MAX_BACKOFF)
+	v.SetDefault("incidents.store", DEFAULT_INCIDENTS_STORE)
+	v.SetDefault("incidents.store_path", DEFAULT_INCIDENTS_STORE_PATH)
+	v.SetDefault("incidents.max_delivery_attempts", DEFAULT_MAX_DELIVERY_ATTEMPTS)
+	v.SetDefault("incidents.retry_interval", DEFAULT_DELIVERY_RETRY_INTERVAL)
+	v.SetDefault("audit.enabled", true)
+	v.SetDefault("audit.store", DEFAULT_AUDIT_STORE)
+	v.SetDefault("audit.store_path", DEFAULT_AUDIT_STORE_PATH)
+	v.SetDefault("audit.export_path", DEFAULT_AUDIT_EXPORT_PATH)
+	v.SetDefault("reload.enabled", true)
+	v.SetDefault("reload.interval", DEFAULT_RELOAD_INTERVAL)
+	v.SetDefault("deduplication.enabled", true)
+	v.SetDefault("deduplication.window", DEFAULT_DEDUPLICATION_WINDOW)
+	v.SetDefault("secrets.cache_ttl", DEFAULT_SECRETS_CACHE_TTL)
+	v.SetDefault("oauth.enabled", false)
+	v.SetDefault("oauth.scopes", DEFAULT_OAUTH_SCOPES)
+	v.SetDefault("oauth.install_path", DEFAULT_OAUTH_INSTALL_PATH)
+	v.SetDefault("oauth.callback_path", DEFAULT_OAUTH_CALLBACK_PATH)
+	v.SetDefault("oauth.events_path", DEFAULT_OAUTH_EVENTS_PATH)
+	v.SetDefault("oauth.store", DEFAULT_OAUTH_STORE)
+	v.SetDefault("oauth.store_path", DEFAULT_OAUTH_STORE_PATH)
 
 	return nil
 }
 
-// readConfiguration attempts to read the configuration file
-func readConfiguration(v *viper.Viper) error {
+// readConfiguration attempts to read the configuration file, fetching it first if it is kept in
+// S3 or served over HTTP
+func readConfiguration(ctx context.Context, v *viper.Viper) error {
+	if location := v.ConfigFileUsed(); IsRemoteLocation(location) {
+		source, err := NewSource(location)
+		if err != nil {
+			return err
+		}
+		data, err := source.Read(ctx)
+		if err != nil {
+			return fmt.Errorf("fetch config file: %w", err)
+		}
+		v.SetConfigType(configType(location))
+		if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+			return fmt.Errorf("read config file: %w", err)
+		}
+		return nil
+	}
+
 	if err := v.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
 			return fmt.Errorf("read config file: %w", err)
@@ -152,42 +666,49 @@ func readConfiguration(v *viper.Viper) error {
 	return nil
 }
 
-// unmarshalConfig unmarshals the configuration into a Config struct
-func unmarshalConfig(v *viper.Viper) (*Config, error) {
-	var config Config
-	if err := v.Unmarshal(&config); err != nil {
-		return nil, fmt.Errorf("unmarshal config: %w", err)
+// configType returns the format of the configuration at the location from its extension, YAML
+// if it has none
+func configType(location string) string {
+	if u, err := url.Parse(location); err == nil {
+		location = u.Path
 	}
-	return &config, nil
-}
-
-// validate validates the configuration
-func (c *Config) validate() error {
-	if c.Metadata == nil {
-		return fmt.Errorf("metadata is required")
-	}
-
-	if c.SlackConfig == nil {
-		return fmt.Errorf("slack config is required")
+	if ext := strings.TrimPrefix(path.Ext(location), "."); ext != "" {
+		return ext
 	}
+	return "yaml"
+}
 
-	if c.Endpoints == nil {
-		return fmt.Errorf("endpoints are required")
+// unmarshalConfig unmarshals the configuration into a Config struct. It also returns the keys
+// that match no setting, usually misspelled or misindented.
+func unmarshalConfig(v *viper.Viper) (*Config, []string, error) {
+	var config Config
+	var metadata mapstructure.Metadata
+	if err := v.Unmarshal(&config, func(dc *mapstructure.DecoderConfig) { dc.Metadata = &metadata }); err != nil {
+		return nil, nil, fmt.Errorf("unmarshal config: %w", err)
 	}
+	slices.Sort(metadata.Unused)
+	return &config, metadata.Unused, nil
+}
 
-	if c.Modal == nil {
-		return fmt.Errorf("modal is required")
-	}
+// SocketModeEnabled reports whether Slack requests are received over Socket Mode instead of HTTP
+func (c *Config) SocketModeEnabled() bool {
+	return c.Local != nil && c.Local.Enabled && c.Local.SocketMode
+}
 
-	if c.SlackConfig.SigningSecret == "" {
-		return fmt.Errorf("slack signing secret is required, please set SLACK_SIGNING_SECRET environment variable")
-	}
+// ServerEnabled reports whether the application runs as a long-running HTTP server
+func (c *Config) ServerEnabled() bool {
+	return c.Server != nil && c.Server.Enabled
+}
 
-	if c.SlackConfig.Token == "" {
-		return fmt.Errorf("slack token is required, please set SLACK_TOKEN environment variable")
-	}
+// LambdaEnabled reports whether the application runs in AWS Lambda, i.e. neither as a server
+// nor locally
+func (c *Config) LambdaEnabled() bool {
+	return !c.ServerEnabled() && (c.Local == nil || !c.Local.Enabled)
+}
 
-	return nil
+// OAuthEnabled reports whether the app can be installed to several workspaces through OAuth
+func (c *Config) OAuthEnabled() bool {
+	return c.OAuth != nil && c.OAuth.Enabled
 }
 
 // Add these helper methods to Config struct for easier testing
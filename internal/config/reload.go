@@ -0,0 +1,121 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// ApplyFunc applies a new configuration to a component. It fails if the component cannot use
+// the configuration, e.g. when a setting only read at startup changed.
+type ApplyFunc func(*Config) error
+
+// LoadFunc loads the configuration from its source
+type LoadFunc func(ctx context.Context) (*Config, error)
+
+// Reloader holds the configuration in use and replaces it while running. A new configuration
+// is validated, then applied to every registered component in turn. If one of them rejects it,
+// the components it was already applied to get the previous configuration back, so that they
+// never run with different configurations.
+type Reloader struct {
+	load     LoadFunc
+	current  atomic.Pointer[Config]
+	mu       sync.Mutex
+	appliers []applier
+}
+
+type applier struct {
+	name  string
+	apply ApplyFunc
+}
+
+// NewReloader creates a Reloader starting with the initial configuration, already applied to
+// the components, and reloading it with load
+func NewReloader(initial *Config, load LoadFunc) *Reloader {
+	r := &Reloader{load: load}
+	r.current.Store(initial)
+	return r
+}
+
+// DefaultLoadFunc loads the configuration from its location with the default secret resolver
+func DefaultLoadFunc(ctx context.Context) (*Config, error) {
+	return LoadConfigWithSecrets(ctx, viper.New(), DefaultSecretResolver())
+}
+
+// OnReload registers a component the reloaded configurations are applied to, in the order of
+// registration
+func (r *Reloader) OnReload(name string, apply ApplyFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.appliers = append(r.appliers, applier{name: name, apply: apply})
+}
+
+// Current returns the configuration in use
+func (r *Reloader) Current() *Config {
+	return r.current.Load()
+}
+
+// Reload loads the configuration again and applies it. It reports whether the configuration
+// changed. On failure, the current configuration is kept.
+func (r *Reloader) Reload(ctx context.Context) (bool, error) {
+	next, err := r.load(ctx)
+	if err != nil {
+		return false, fmt.Errorf("load config: %w", err)
+	}
+	return r.Apply(next)
+}
+
+// Apply validates the configuration and applies it to the components, unless it is the one in
+// use. It reports whether the configuration changed. On failure, the current configuration is
+// kept.
+func (r *Reloader) Apply(next *Config) (bool, error) {
+	if err := next.validate(); err != nil {
+		return false, fmt.Errorf("validate config: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous := r.current.Load()
+	if reflect.DeepEqual(previous, next) {
+		return false, nil
+	}
+
+	for i, a := range r.appliers {
+		if err := a.apply(next); err != nil {
+			err = fmt.Errorf("apply config to %s: %w", a.name, err)
+			return false, errors.Join(err, r.rollback(r.appliers[:i], previous))
+		}
+	}
+	r.current.Store(next)
+	return true, nil
+}
+
+// rollback applies the previous configuration to the components, in reverse order
+func (r *Reloader) rollback(applied []applier, previous *Config) error {
+	var errs []error
+	for _, a := range slices.Backward(applied) {
+		if err := a.apply(previous); err != nil {
+			errs = append(errs, fmt.Errorf("roll back config of %s: %w", a.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Watch reloads the configuration whenever the local file at path is written or replaced, e.g.
+// when a Kubernetes ConfigMap is updated. onReload is called with the outcome of every reload.
+func (r *Reloader) Watch(path string, onReload func(changed bool, err error)) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.OnConfigChange(func(fsnotify.Event) {
+		onReload(r.Reload(context.Background()))
+	})
+	v.WatchConfig()
+}
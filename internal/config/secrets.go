@@ -0,0 +1,260 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schemes of the secret references resolved at load time
+const (
+	SECRET_SCHEME_SECRETS_MANAGER = "secretsmanager"
+	SECRET_SCHEME_SSM             = "ssm"
+	SECRET_SCHEME_FILE            = "file"
+)
+
+// SecretRef is a reference to a secret such as secretsmanager://name#key, ssm:///path or
+// file:///path. Key, when set, selects a field of a secret stored as a JSON object.
+type SecretRef struct {
+	Scheme string
+	Name   string
+	Key    string
+}
+
+func (r SecretRef) String() string {
+	ref := r.Scheme + "://" + r.Name
+	if r.Key != "" {
+		ref += "#" + r.Key
+	}
+	return ref
+}
+
+// ParseSecretRef parses a secret reference. It returns false if the value is not a reference,
+// i.e. a plain secret value.
+func ParseSecretRef(value string) (SecretRef, bool) {
+	scheme, rest, ok := strings.Cut(value, "://")
+	if !ok {
+		return SecretRef{}, false
+	}
+	switch scheme {
+	case SECRET_SCHEME_SECRETS_MANAGER, SECRET_SCHEME_SSM, SECRET_SCHEME_FILE:
+	default:
+		return SecretRef{}, false
+	}
+	name, key, _ := strings.Cut(rest, "#")
+	return SecretRef{Scheme: scheme, Name: name, Key: key}, true
+}
+
+// SecretProvider fetches the raw value of a secret from a secret store
+type SecretProvider interface {
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+// SecretResolver resolves secret references through the provider registered for their scheme.
+// Fetched secrets are cached so reloading the configuration does not hit the secret store
+// every time, and fetched again once older than the cache TTL. A secret is fetched once at a
+// time, the other lookups of the same secret wait for it.
+type SecretResolver struct {
+	mu        sync.Mutex
+	providers map[string]SecretProvider
+	cache     map[string]cachedSecret
+	fetching  map[string]*secretFetch
+	now       func() time.Time
+}
+
+type cachedSecret struct {
+	value     string
+	fetchedAt time.Time
+}
+
+// secretFetch is a secret being fetched from its provider, done is closed once it is fetched
+type secretFetch struct {
+	done  chan struct{}
+	value string
+	err   error
+}
+
+// NewSecretResolver creates a resolver with the given providers, keyed by scheme
+func NewSecretResolver(providers map[string]SecretProvider) *SecretResolver {
+	return &SecretResolver{
+		providers: providers,
+		cache:     make(map[string]cachedSecret),
+		fetching:  make(map[string]*secretFetch),
+		now:       time.Now,
+	}
+}
+
+var (
+	defaultResolver     *SecretResolver
+	defaultResolverOnce sync.Once
+)
+
+// DefaultSecretResolver returns the process-wide resolver for AWS Secrets Manager, SSM Parameter
+// Store and local files. AWS clients are only created when a reference needs them.
+func DefaultSecretResolver() *SecretResolver {
+	defaultResolverOnce.Do(func() {
+		defaultResolver = NewSecretResolver(map[string]SecretProvider{
+			SECRET_SCHEME_SECRETS_MANAGER: &SecretsManagerProvider{},
+			SECRET_SCHEME_SSM:             &SSMProvider{},
+			SECRET_SCHEME_FILE:            FileSecretProvider{},
+		})
+	})
+	return defaultResolver
+}
+
+// Resolve returns the secret a value refers to, or the value itself if it is not a reference.
+// A cached secret is reused while it is younger than ttl.
+func (r *SecretResolver) Resolve(ctx context.Context, value string, ttl time.Duration) (string, error) {
+	ref, ok := ParseSecretRef(value)
+	if !ok {
+		return value, nil
+	}
+
+	raw, err := r.fetch(ctx, ref, ttl)
+	if err != nil {
+		return "", err
+	}
+	if ref.Key == "" {
+		return raw, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &fields); err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object: %w", ref, err)
+	}
+	field, ok := fields[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %q", ref, ref.Key)
+	}
+	if s, ok := field.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(field), nil
+}
+
+// fetch returns the raw secret from the cache or its provider. The provider is called without
+// holding the lock, so a slow secret store only delays the lookups of the secret being fetched.
+func (r *SecretResolver) fetch(ctx context.Context, ref SecretRef, ttl time.Duration) (string, error) {
+	cacheKey := ref.Scheme + "://" + ref.Name
+
+	r.mu.Lock()
+	if cached, ok := r.cache[cacheKey]; ok && r.now().Sub(cached.fetchedAt) < ttl {
+		r.mu.Unlock()
+		return cached.value, nil
+	}
+	if pending, ok := r.fetching[cacheKey]; ok {
+		r.mu.Unlock()
+		select {
+		case <-pending.done:
+			return pending.value, pending.err
+		case <-ctx.Done():
+			return "", fmt.Errorf("fetch secret %s: %w", cacheKey, ctx.Err())
+		}
+	}
+	provider, ok := r.providers[ref.Scheme]
+	if !ok {
+		r.mu.Unlock()
+		return "", fmt.Errorf("no secret provider for scheme %q", ref.Scheme)
+	}
+	pending := &secretFetch{done: make(chan struct{})}
+	r.fetching[cacheKey] = pending
+	r.mu.Unlock()
+
+	value, err := provider.GetSecret(ctx, ref.Name)
+	if err != nil {
+		err = fmt.Errorf("fetch secret %s: %w", cacheKey, err)
+	}
+
+	r.mu.Lock()
+	delete(r.fetching, cacheKey)
+	if err == nil {
+		r.cache[cacheKey] = cachedSecret{value: value, fetchedAt: r.now()}
+	}
+	r.mu.Unlock()
+
+	pending.value, pending.err = value, err
+	close(pending.done)
+	return value, err
+}
+
+// FileSecretProvider reads secrets from local files, a stand-in for the AWS secret stores when
+// running locally
+type FileSecretProvider struct{}
+
+func (FileSecretProvider) GetSecret(_ context.Context, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// HasSecretReferences reports whether secrets of the configuration were fetched from a secret
+// store, and are only fetched again when the configuration is reloaded
+func (c *Config) HasSecretReferences() bool {
+	return c.secretReferences > 0
+}
+
+// SecretsCacheTTL is the time a fetched secret is reused before being fetched again
+func (c *Config) SecretsCacheTTL() time.Duration {
+	if c.Secrets == nil {
+		return DEFAULT_SECRETS_CACHE_TTL * time.Second
+	}
+	return time.Duration(c.Secrets.CacheTTL) * time.Second
+}
+
+// resolveSecrets replaces the secret references of the configuration with the secrets they
+// refer to
+func (c *Config) resolveSecrets(ctx context.Context, resolver *SecretResolver) error {
+	if c.SlackConfig == nil {
+		return nil
+	}
+
+	ttl := c.SecretsCacheTTL()
+
+	resolve := func(name string, value *string) error {
+		if _, ok := ParseSecretRef(*value); ok {
+			c.secretReferences++
+		}
+		resolved, err := resolver.Resolve(ctx, *value, ttl)
+		if err != nil {
+			return fmt.Errorf("resolve %s: %w", name, err)
+		}
+		*value = resolved
+		return nil
+	}
+
+	if err := resolve("slack_config.slack_token", &c.SlackConfig.Token); err != nil {
+		return err
+	}
+	if err := resolve("slack_config.slack_signing_secret", &c.SlackConfig.SigningSecret); err != nil {
+		return err
+	}
+	if err := resolve("slack_config.slack_signing_secret_previous", &c.SlackConfig.PreviousSigningSecret); err != nil {
+		return err
+	}
+	if err := resolve("slack_config.slack_app_token", &c.SlackConfig.AppToken); err != nil {
+		return err
+	}
+	if c.OAuth != nil {
+		if err := resolve("oauth.client_secret", &c.OAuth.ClientSecret); err != nil {
+			return err
+		}
+	}
+	if c.Audit != nil {
+		if err := resolve("audit.export_token", &c.Audit.ExportToken); err != nil {
+			return err
+		}
+	}
+	for i := range c.SlackConfig.SigningSecrets {
+		name := fmt.Sprintf("slack_config.signing_secrets[%d].secret", i)
+		if err := resolve(name, &c.SlackConfig.SigningSecrets[i].Secret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// ISecretsManagerAPI is the part of the AWS Secrets Manager client used to fetch secrets
+type ISecretsManagerAPI interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// ISSMAPI is the part of the AWS Systems Manager client used to fetch parameters
+type ISSMAPI interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+// SecretsManagerProvider fetches secrets from AWS Secrets Manager. Without a client, one is
+// created from the default AWS configuration on first use.
+type SecretsManagerProvider struct {
+	Client ISecretsManagerAPI
+	mu     sync.Mutex
+}
+
+func (p *SecretsManagerProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	client, err := p.client(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(name)})
+	if err != nil {
+		return "", err
+	}
+	if out.SecretString == nil {
+		return "", fmt.Errorf("secret %s has no string value", name)
+	}
+	return *out.SecretString, nil
+}
+
+// SSMProvider fetches secrets from AWS Systems Manager Parameter Store, decrypting SecureString
+// parameters. Without a client, one is created from the default AWS configuration on first use.
+type SSMProvider struct {
+	Client ISSMAPI
+	mu     sync.Mutex
+}
+
+func (p *SSMProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	client, err := p.client(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+	if out.Parameter == nil || out.Parameter.Value == nil {
+		return "", fmt.Errorf("parameter %s has no value", name)
+	}
+	return *out.Parameter.Value, nil
+}
+
+// client returns the Secrets Manager client, creating it if there is none. A failure to load the
+// AWS configuration is not kept, the next lookup tries again.
+func (p *SecretsManagerProvider) client(ctx context.Context) (ISecretsManagerAPI, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Client == nil {
+		cfg, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("load AWS configuration: %w", err)
+		}
+		p.Client = secretsmanager.NewFromConfig(cfg)
+	}
+	return p.Client, nil
+}
+
+// client returns the Parameter Store client, creating it if there is none. A failure to load the
+// AWS configuration is not kept, the next lookup tries again.
+func (p *SSMProvider) client(ctx context.Context) (ISSMAPI, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Client == nil {
+		cfg, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("load AWS configuration: %w", err)
+		}
+		p.Client = ssm.NewFromConfig(cfg)
+	}
+	return p.Client, nil
+}
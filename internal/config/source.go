@@ -0,0 +1,160 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Schemes of the remote configuration sources
+const (
+	CONFIG_SOURCE_S3    = "s3"
+	CONFIG_SOURCE_HTTP  = "http"
+	CONFIG_SOURCE_HTTPS = "https"
+)
+
+// maxConfigSize bounds the size of a configuration fetched from a remote source
+const maxConfigSize = 4 << 20
+
+// httpSourceTimeout bounds the time taken to fetch the configuration over HTTP
+const httpSourceTimeout = 10 * time.Second
+
+// Source reads the configuration file from where it is kept
+type Source interface {
+	// Read returns the content of the configuration file
+	Read(ctx context.Context) ([]byte, error)
+}
+
+// ConfigLocation returns where the configuration is read from: the CONFIG_FILE environment
+// variable, a path or an s3:// or http(s):// URL, or config.yaml
+func ConfigLocation() string {
+	if location := os.Getenv(configFileEnv); location != "" {
+		return location
+	}
+	return defaultConfigFile
+}
+
+// IsRemoteLocation reports whether the configuration location is an s3:// or http(s):// URL
+// rather than a local file
+func IsRemoteLocation(location string) bool {
+	scheme, _, ok := strings.Cut(location, "://")
+	return ok && (scheme == CONFIG_SOURCE_S3 || scheme == CONFIG_SOURCE_HTTP || scheme == CONFIG_SOURCE_HTTPS)
+}
+
+// NewSource returns the source of the configuration at the location
+func NewSource(location string) (Source, error) {
+	if !IsRemoteLocation(location) {
+		return FileSource{Path: location}, nil
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration location %q: %w", location, err)
+	}
+	if u.Scheme == CONFIG_SOURCE_S3 {
+		key := strings.TrimPrefix(u.Path, "/")
+		if u.Host == "" || key == "" {
+			return nil, fmt.Errorf("invalid configuration location %q, expected s3://bucket/key", location)
+		}
+		return &S3Source{Bucket: u.Host, Key: key}, nil
+	}
+	return &HTTPSource{URL: location}, nil
+}
+
+// FileSource reads the configuration from a local file
+type FileSource struct {
+	Path string
+}
+
+func (s FileSource) Read(_ context.Context) ([]byte, error) {
+	return os.ReadFile(s.Path)
+}
+
+// IS3API is the part of the AWS S3 client used to fetch the configuration
+type IS3API interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// S3Source reads the configuration from an S3 object. Without a client, one is created from the
+// default AWS configuration on first use.
+type S3Source struct {
+	Bucket string
+	Key    string
+	Client IS3API
+	mu     sync.Mutex
+}
+
+func (s *S3Source) Read(ctx context.Context) ([]byte, error) {
+	client, err := s.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.Bucket), Key: aws.String(s.Key)})
+	if err != nil {
+		return nil, fmt.Errorf("get s3://%s/%s: %w", s.Bucket, s.Key, err)
+	}
+	defer out.Body.Close()
+	return readLimited(out.Body)
+}
+
+// client returns the S3 client, creating it if there is none. A failure to load the AWS
+// configuration, e.g. credentials not available yet, is not kept: the next read tries again.
+func (s *S3Source) client(ctx context.Context) (IS3API, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Client == nil {
+		cfg, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("load AWS configuration: %w", err)
+		}
+		s.Client = s3.NewFromConfig(cfg)
+	}
+	return s.Client, nil
+}
+
+// HTTPSource reads the configuration from an HTTP(S) URL
+type HTTPSource struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s *HTTPSource) Read(ctx context.Context) ([]byte, error) {
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: httpSourceTimeout}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", s.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get %s: unexpected status %s", s.URL, resp.Status)
+	}
+	return readLimited(resp.Body)
+}
+
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxConfigSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read configuration: %w", err)
+	}
+	if len(data) > maxConfigSize {
+		return nil, fmt.Errorf("configuration is larger than %d bytes", maxConfigSize)
+	}
+	return data, nil
+}
@@ -0,0 +1,579 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Types of the modal inputs
+const (
+	INPUT_TYPE_SELECT = "select"
+	INPUT_TYPE_TEXT   = "text"
+)
+
+// INPUT_TYPES are the types of modal inputs the handler renders
+var INPUT_TYPES = []string{INPUT_TYPE_SELECT, INPUT_TYPE_TEXT}
+
+// Keys of the modal inputs the handler reads the incident severity and domain from
+const (
+	SEVERITY_INPUT_KEY    = "input_severity"
+	DOMAINS_INPUT_KEY     = "input_domains_affected"
+	DESCRIPTION_INPUT_KEY = "input_incident_description"
+)
+
+// MESSAGE_PLACEHOLDERS maps the placeholders of the message format, written {{name}}, to the
+// key of the modal input they are replaced with. The username is the reporter's and needs no
+// input.
+var MESSAGE_PLACEHOLDERS = map[string]string{
+	"severity":         SEVERITY_INPUT_KEY,
+	"domains_affected": DOMAINS_INPUT_KEY,
+	"description":      DESCRIPTION_INPUT_KEY,
+	"username":         "",
+}
+
+// maxModalTitleLength is the longest modal title Slack accepts
+const maxModalTitleLength = 24
+
+var placeholderPattern = regexp.MustCompile(`\{\{([^{}]*)\}\}`)
+
+// Problem is an invalid setting, located by its path in the configuration file, e.g.
+// "modal.inputs[2].type"
+type Problem struct {
+	Path    string
+	Message string
+}
+
+func (p Problem) String() string {
+	return p.Path + ": " + p.Message
+}
+
+// ValidationError lists every problem found in a configuration, so that they can all be fixed
+// at once
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return e.Problems[0].String()
+	}
+	problems := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		problems[i] = problem.String()
+	}
+	return fmt.Sprintf("%d problems: %s", len(e.Problems), strings.Join(problems, "; "))
+}
+
+// ValidateFile loads the configuration at the location, a path or an s3:// or http(s):// URL,
+// and reports every problem in it. Without a resolver, the environment is ignored and the
+// secrets are neither resolved nor required, so that the file can be checked in CI.
+func ValidateFile(ctx context.Context, location string, resolver *SecretResolver) error {
+	_, err := LoadFile(ctx, location, resolver)
+	return err
+}
+
+// LoadFile loads and validates the configuration at the location, a path or an s3:// or
+// http(s):// URL. Without a resolver, the environment is ignored and the secrets are neither
+// resolved nor required, e.g. for the tools that do not call Slack or Datadog.
+func LoadFile(ctx context.Context, location string, resolver *SecretResolver) (*Config, error) {
+	v := viper.New()
+	if resolver != nil {
+		bindEnv(v)
+	}
+	if err := setupViper(v); err != nil {
+		return nil, fmt.Errorf("setup viper: %w", err)
+	}
+	v.SetConfigFile(location)
+
+	if err := readConfiguration(ctx, v); err != nil {
+		return nil, fmt.Errorf("read configuration: %w", err)
+	}
+	config, unknownKeys, err := unmarshalConfig(v)
+	if err != nil {
+		return nil, err
+	}
+	if resolver != nil {
+		if err := config.resolveSecrets(ctx, resolver); err != nil {
+			return nil, fmt.Errorf("resolve secrets: %w", err)
+		}
+	}
+	if err := config.check(unknownKeys, resolver != nil); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// validator collects the problems of a configuration
+type validator struct {
+	problems []Problem
+}
+
+func (v *validator) addf(path, format string, args ...any) {
+	v.problems = append(v.problems, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
+
+// validate validates the configuration, secrets included
+func (c *Config) validate() error {
+	return c.check(nil, true)
+}
+
+// check reports the unknown keys and every invalid setting of the configuration. The tokens and
+// signing secrets are only required with requireSecrets.
+func (c *Config) check(unknownKeys []string, requireSecrets bool) error {
+	v := &validator{}
+	for _, key := range unknownKeys {
+		v.addf(key, "unknown setting, check its spelling and indentation")
+	}
+
+	if c.Metadata == nil {
+		v.addf("metadata", "is required")
+	}
+	if c.SlackConfig == nil {
+		v.addf("slack_config", "is required")
+	}
+	if c.Endpoints == nil {
+		v.addf("endpoints", "is required")
+	}
+	if c.Modal == nil {
+		v.addf("modal", "is required")
+	}
+
+	c.checkModals(v)
+	c.checkMessageFormat(v)
+	c.checkEndpoints(v)
+	c.checkServer(v)
+	c.checkStores(v)
+	c.checkOptionalSections(v)
+	c.checkOptionReferences(v)
+	if requireSecrets && c.SlackConfig != nil {
+		c.checkSecrets(v)
+	}
+	return v.err()
+}
+
+// checkModals checks the modal and the modals of the workspaces
+func (c *Config) checkModals(v *validator) {
+	if c.Modal != nil {
+		checkModal(v, "modal", c.Modal)
+	}
+	for _, teamID := range slices.Sorted(maps.Keys(c.Workspaces)) {
+		if modal := c.Workspaces[teamID].Modal; modal != nil {
+			checkModal(v, "workspaces."+teamID+".modal", modal)
+		}
+	}
+}
+
+func checkModal(v *validator, path string, modal *Modal) {
+	if modal.Title == "" {
+		v.addf(path+".title", "is required")
+	} else if len([]rune(modal.Title)) > maxModalTitleLength {
+		v.addf(path+".title", "is longer than the %d characters Slack accepts", maxModalTitleLength)
+	}
+
+	keys := make(map[string]int)
+	for i, input := range modal.Inputs {
+		inputPath := fmt.Sprintf("%s.inputs[%d]", path, i)
+		if input.Key == "" {
+			v.addf(inputPath+".key", "is required")
+		} else if first, ok := keys[input.Key]; ok {
+			v.addf(inputPath+".key", "duplicates the key %q of %s.inputs[%d], keys must be unique", input.Key, path, first)
+		} else {
+			keys[input.Key] = i
+		}
+		if input.Label == "" {
+			v.addf(inputPath+".label", "is required")
+		}
+
+		switch input.Type {
+		case INPUT_TYPE_SELECT:
+			if len(input.Options) == 0 {
+				v.addf(inputPath+".options", "a select input needs at least one option")
+			}
+			texts := make(map[string]bool)
+			for j, option := range input.Options {
+				optionPath := fmt.Sprintf("%s.options[%d].text", inputPath, j)
+				if option.Text == "" {
+					v.addf(optionPath, "is required")
+				} else if texts[option.Text] {
+					v.addf(optionPath, "duplicates the option %q", option.Text)
+				}
+				texts[option.Text] = true
+			}
+		case INPUT_TYPE_TEXT:
+			if len(input.Options) > 0 {
+				v.addf(inputPath+".options", "only select inputs have options, remove them or use type %q", INPUT_TYPE_SELECT)
+			}
+		case "":
+			v.addf(inputPath+".type", "is required, expected one of %s", strings.Join(INPUT_TYPES, ", "))
+		default:
+			v.addf(inputPath+".type", "unknown input type %q, expected one of %s", input.Type, strings.Join(INPUT_TYPES, ", "))
+		}
+	}
+}
+
+// checkMessageFormat checks the placeholders of the message format exist and the inputs they
+// are replaced with are in every modal
+func (c *Config) checkMessageFormat(v *validator) {
+	if c.SlackConfig == nil {
+		return
+	}
+	const path = "slack_config.message_format"
+	known := slices.Sorted(maps.Keys(MESSAGE_PLACEHOLDERS))
+
+	seen := make(map[string]bool)
+	for _, match := range placeholderPattern.FindAllStringSubmatch(c.SlackConfig.MessageFormat, -1) {
+		name := match[1]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		key, ok := MESSAGE_PLACEHOLDERS[name]
+		if !ok {
+			v.addf(path, "unknown placeholder {{%s}}, expected one of {{%s}}", name, strings.Join(known, "}}, {{"))
+			continue
+		}
+		if key == "" {
+			continue
+		}
+		modals := c.modals()
+		for _, modalPath := range slices.Sorted(maps.Keys(modals)) {
+			if !modals[modalPath].hasInput(key) {
+				v.addf(path, "placeholder {{%s}} needs an input with key %q in %s", name, key, modalPath)
+			}
+		}
+	}
+}
+
+// checkEndpoints checks the Slack routes are distinct paths, unless the requests are received
+// over Socket Mode
+func (c *Config) checkEndpoints(v *validator) {
+	if c.Endpoints == nil || c.SocketModeEnabled() {
+		return
+	}
+
+	routes := make(map[string]string)
+	if c.OAuthEnabled() {
+		routes[c.OAuth.InstallPath] = "oauth.install_path"
+		routes[c.OAuth.CallbackPath] = "oauth.callback_path"
+		routes[c.OAuth.EventsPath] = "oauth.events_path"
+	}
+	if c.Audit.ExportEnabled() {
+		routes[c.Audit.ExportPath] = "audit.export_path"
+	}
+
+	for _, endpoint := range []struct{ path, value string }{
+		{"endpoints.slack_command", c.Endpoints.SlackCommand},
+		{"endpoints.slack_modal_parser", c.Endpoints.SlackModalParser},
+	} {
+		if !checkRoutePath(v, endpoint.path, endpoint.value) {
+			continue
+		}
+		if other, ok := routes[endpoint.value]; ok {
+			v.addf(endpoint.path, "%q is already the path of %s", endpoint.value, other)
+			continue
+		}
+		routes[endpoint.value] = endpoint.path
+	}
+}
+
+// checkRoutePath reports whether the path of a route is set and starts with a slash
+func checkRoutePath(v *validator, path, value string) bool {
+	switch {
+	case value == "":
+		v.addf(path, "is required")
+	case !strings.HasPrefix(value, "/"):
+		v.addf(path, "%q must start with /", value)
+	default:
+		return true
+	}
+	return false
+}
+
+func (c *Config) checkServer(v *validator) {
+	if c.ServerEnabled() {
+		if c.Local != nil && c.Local.Enabled {
+			v.addf("server.enabled", "local and server modes cannot be enabled together")
+		}
+		if tls := c.Server.TLS; tls != nil && tls.Enabled {
+			if tls.CertFile == "" {
+				v.addf("server.tls.cert_file", "is required when TLS is enabled")
+			}
+			if tls.KeyFile == "" {
+				v.addf("server.tls.key_file", "is required when TLS is enabled")
+			}
+		}
+		for _, timeout := range []struct {
+			path  string
+			value int
+		}{
+			{"server.read_timeout", c.Server.ReadTimeout},
+			{"server.read_header_timeout", c.Server.ReadHeaderTimeout},
+			{"server.write_timeout", c.Server.WriteTimeout},
+			{"server.idle_timeout", c.Server.IdleTimeout},
+			{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+		} {
+			if timeout.value < 0 {
+				v.addf(timeout.path, "must not be negative")
+			}
+		}
+	}
+	if c.Local != nil && c.Local.Enabled && !c.Local.SocketMode && (c.Local.Port <= 0 || c.Local.Port > 65535) {
+		v.addf("local.port", "%d is not a valid port", c.Local.Port)
+	}
+}
+
+// checkStores checks the stores of the incidents, the audit trail and the installations
+func (c *Config) checkStores(v *validator) {
+	if c.Incidents != nil {
+		checkStore(v, "incidents", c.Incidents.Store, c.Incidents.StorePath)
+		if c.Incidents.MaxDeliveryAttempts < 0 {
+			v.addf("incidents.max_delivery_attempts", "must not be negative")
+		}
+		if c.Incidents.RetryInterval < 0 {
+			v.addf("incidents.retry_interval", "must not be negative")
+		}
+	}
+	if c.Audit != nil && c.Audit.Enabled {
+		checkStore(v, "audit", c.Audit.Store, c.Audit.StorePath)
+		if c.Audit.ExportToken != "" {
+			checkRoutePath(v, "audit.export_path", c.Audit.ExportPath)
+		}
+	}
+	if c.OAuthEnabled() {
+		checkStore(v, "oauth", c.OAuth.Store, c.OAuth.StorePath)
+		if c.OAuth.Store == STORE_MEMORY {
+			v.addf("oauth.store", "the %s store loses the installations on restart, use the %s store", STORE_MEMORY, STORE_FILE)
+		}
+		if len(c.OAuth.AllowedTeams) == 0 && len(c.OAuth.AllowedEnterprises) == 0 {
+			v.addf("oauth.allowed_teams", "list the workspaces, or the organizations in oauth.allowed_enterprises, the app may be installed to")
+		}
+		if c.OAuth.RedirectURL == "" {
+			v.addf("oauth.redirect_url", "is required")
+		} else if !isAbsoluteURL(c.OAuth.RedirectURL) {
+			v.addf("oauth.redirect_url", "%q is not an absolute URL", c.OAuth.RedirectURL)
+		}
+		checkRoutePath(v, "oauth.install_path", c.OAuth.InstallPath)
+		checkRoutePath(v, "oauth.callback_path", c.OAuth.CallbackPath)
+		checkRoutePath(v, "oauth.events_path", c.OAuth.EventsPath)
+	}
+}
+
+// Warnings lists the settings that are valid but probably not what is wanted, e.g. a store
+// lost between Lambda invocations. They are logged at startup and printed by validate-config.
+func (c *Config) Warnings() []Problem {
+	v := &validator{}
+	c.checkLambdaStores(v)
+	return v.problems
+}
+
+// checkLambdaStores warns about the memory stores in Lambda, where the execution environments
+// are discarded at any time with what they hold
+func (c *Config) checkLambdaStores(v *validator) {
+	if !c.LambdaEnabled() {
+		return
+	}
+	if c.Incidents != nil && c.Incidents.Store == STORE_MEMORY {
+		v.addf("incidents.store", "the %s store is lost when the Lambda environment is discarded, with the failed deliveries to retry; use the %s store on an EFS mount",
+			STORE_MEMORY, STORE_FILE)
+	}
+	if c.Audit != nil && c.Audit.Enabled && c.Audit.Store == STORE_MEMORY {
+		v.addf("audit.store", "the %s store is lost when the Lambda environment is discarded, with the audit trail; use the %s store on an EFS mount",
+			STORE_MEMORY, STORE_FILE)
+	}
+}
+
+func checkStore(v *validator, section, store, storePath string) {
+	switch store {
+	case STORE_MEMORY:
+	case STORE_FILE:
+		if storePath == "" {
+			v.addf(section+".store_path", "is required with the %s store", STORE_FILE)
+		}
+	default:
+		v.addf(section+".store", "unknown store %q, expected %s or %s", store, STORE_MEMORY, STORE_FILE)
+	}
+}
+
+// checkOptionalSections checks the sections that have defaults or may be left out
+func (c *Config) checkOptionalSections(v *validator) {
+	if c.Tracing != nil && c.Tracing.Enabled {
+		if c.Tracing.Exporter != TRACING_EXPORTER_OTLP && c.Tracing.Exporter != TRACING_EXPORTER_STDOUT {
+			v.addf("tracing.exporter", "unknown exporter %q, expected %s or %s", c.Tracing.Exporter, TRACING_EXPORTER_OTLP, TRACING_EXPORTER_STDOUT)
+		}
+		if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+			v.addf("tracing.sample_ratio", "%g is not between 0 and 1", c.Tracing.SampleRatio)
+		}
+	}
+
+	if c.Redaction != nil {
+		for i, pattern := range c.Redaction.Patterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				v.addf(fmt.Sprintf("redaction.patterns[%d]", i), "invalid regular expression %q: %v", pattern, err)
+			}
+		}
+	}
+
+	if c.Scrubbing != nil {
+		for i, detector := range c.Scrubbing.Detectors {
+			if !slices.Contains(SCRUB_DETECTORS, detector) {
+				v.addf(fmt.Sprintf("scrubbing.detectors[%d]", i), "unknown detector %q, expected one of %s", detector, strings.Join(SCRUB_DETECTORS, ", "))
+			}
+		}
+		for _, sink := range slices.Sorted(maps.Keys(c.Scrubbing.Sinks)) {
+			if policy := c.Scrubbing.Sinks[sink]; policy != SCRUB_POLICY_FULL && policy != SCRUB_POLICY_SCRUBBED {
+				v.addf("scrubbing.sinks."+sink, "unknown policy %q, expected %s or %s", policy, SCRUB_POLICY_FULL, SCRUB_POLICY_SCRUBBED)
+			}
+		}
+	}
+
+	if c.Reload != nil && c.Reload.Enabled && c.Reload.Interval <= 0 {
+		v.addf("reload.interval", "must be positive")
+	}
+	if c.Deduplication != nil && c.Deduplication.Enabled && c.Deduplication.Window <= 0 {
+		v.addf("deduplication.window", "must be positive")
+	}
+	if c.Metrics != nil && c.Metrics.Enabled && c.Metrics.FlushInterval <= 0 {
+		v.addf("metrics.flush_interval", "must be positive")
+	}
+
+	if c.Retry != nil {
+		if c.Retry.MaxAttempts < 1 {
+			v.addf("retry.max_attempts", "must be at least 1")
+		}
+		if c.Retry.InitialBackoff < 0 {
+			v.addf("retry.initial_backoff", "must not be negative")
+		}
+		if c.Retry.MaxBackoff < c.Retry.InitialBackoff {
+			v.addf("retry.max_backoff", "must not be lower than retry.initial_backoff")
+		}
+	}
+
+	if c.Datadog != nil {
+		if c.Datadog.AppURL != "" && !isAbsoluteURL(c.Datadog.AppURL) {
+			v.addf("datadog.app_url", "%q is not an absolute URL", c.Datadog.AppURL)
+		}
+		for _, domain := range slices.Sorted(maps.Keys(c.Datadog.Domains)) {
+			domainContext := c.Datadog.Domains[domain]
+			checkLinks(v, "datadog.domains."+domain+".dashboards", domainContext.Dashboards)
+			checkLinks(v, "datadog.domains."+domain+".monitors", domainContext.Monitors)
+		}
+	}
+}
+
+func checkLinks(v *validator, path string, links []Link) {
+	for i, link := range links {
+		linkPath := fmt.Sprintf("%s[%d]", path, i)
+		if link.Title == "" {
+			v.addf(linkPath+".title", "is required")
+		}
+		if !isAbsoluteURL(link.URL) {
+			v.addf(linkPath+".url", "%q is not an absolute URL", link.URL)
+		}
+	}
+}
+
+// checkOptionReferences checks the severities and domains configured elsewhere are options of
+// the modals, as they would never match otherwise
+func (c *Config) checkOptionReferences(v *validator) {
+	if c.Authorization != nil {
+		if severities, ok := c.options(SEVERITY_INPUT_KEY); ok {
+			for _, severity := range slices.Sorted(maps.Keys(c.Authorization.Severities)) {
+				if !severities[severity] {
+					v.addf("authorization.severities."+severity, "is not an option of the %s input", SEVERITY_INPUT_KEY)
+				}
+			}
+		}
+	}
+	if c.Datadog != nil {
+		if domains, ok := c.options(DOMAINS_INPUT_KEY); ok {
+			for _, domain := range slices.Sorted(maps.Keys(c.Datadog.Domains)) {
+				if !domains[domain] {
+					v.addf("datadog.domains."+domain, "is not an option of the %s input", DOMAINS_INPUT_KEY)
+				}
+			}
+		}
+	}
+}
+
+func (c *Config) checkSecrets(v *validator) {
+	if c.SocketModeEnabled() {
+		if !strings.HasPrefix(c.SlackConfig.AppToken, "xapp-") {
+			v.addf("slack_config.slack_app_token", "an app-level token (xapp-...) is required in socket mode, please set SLACK_APP_TOKEN environment variable")
+		}
+	} else if len(c.SlackConfig.ActiveSigningSecrets()) == 0 {
+		// Requests received over Socket Mode are not signed
+		v.addf("slack_config.slack_signing_secret", "is required, please set SLACK_SIGNING_SECRET environment variable")
+	}
+
+	if c.OAuthEnabled() {
+		if c.OAuth.ClientID == "" {
+			v.addf("oauth.client_id", "is required, please set SLACK_CLIENT_ID environment variable")
+		}
+		if c.OAuth.ClientSecret == "" {
+			v.addf("oauth.client_secret", "is required, please set SLACK_CLIENT_SECRET environment variable")
+		}
+		// The bot token is optional, it serves workspaces not installed through OAuth
+		return
+	}
+
+	if c.SlackConfig.Token == "" {
+		v.addf("slack_config.slack_token", "is required, please set SLACK_TOKEN environment variable")
+	}
+}
+
+// modals returns the modal and the modals of the workspaces, keyed by their path
+func (c *Config) modals() map[string]*Modal {
+	modals := make(map[string]*Modal)
+	if c.Modal != nil {
+		modals["modal"] = c.Modal
+	}
+	for teamID, workspace := range c.Workspaces {
+		if workspace.Modal != nil {
+			modals["workspaces."+teamID+".modal"] = workspace.Modal
+		}
+	}
+	return modals
+}
+
+// options returns the lowercased options of the select inputs with the key, in any modal. It
+// reports false if no modal has such an input.
+func (c *Config) options(key string) (map[string]bool, bool) {
+	options := make(map[string]bool)
+	found := false
+	for _, modal := range c.modals() {
+		for _, input := range modal.Inputs {
+			if input.Key != key || input.Type != INPUT_TYPE_SELECT {
+				continue
+			}
+			found = true
+			for _, option := range input.Options {
+				options[strings.ToLower(option.Text)] = true
+			}
+		}
+	}
+	return options, found
+}
+
+func (m *Modal) hasInput(key string) bool {
+	return slices.ContainsFunc(m.Inputs, func(input Input) bool { return input.Key == key })
+}
+
+func isAbsoluteURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
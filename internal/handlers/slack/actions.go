@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/syltek/oncall-incident-reporter/internal/authorization"
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+	"github.com/syltek/oncall-incident-reporter/internal/incident"
+	"github.com/syltek/oncall-incident-reporter/internal/metrics"
+	apperrors "github.com/syltek/oncall-incident-reporter/pkg/errors"
+	"github.com/syltek/oncall-incident-reporter/pkg/logutil"
+	"go.uber.org/zap"
+)
+
+// Block and action IDs of the incident announcement buttons
+const (
+	incidentActionsBlockID = "incident_actions"
+	incidentStatusBlockID  = "incident_status"
+	actionAcknowledge      = "incident_acknowledge"
+	actionResolve          = "incident_resolve"
+)
+
+// errActionApplied is returned when the incident was already acknowledged or resolved
+var errActionApplied = errors.New("incident action already applied")
+
+// authorizationActions maps the announcement buttons to the actions they are authorized as
+var authorizationActions = map[string]string{
+	actionAcknowledge: authorization.ActionAcknowledge,
+	actionResolve:     authorization.ActionResolve,
+}
+
+// Slack limits the text of a section block to 3000 characters
+const maxSectionTextLength = 3000
+
+// incidentRef is carried in the value of the announcement buttons so acknowledging or
+// resolving an incident does not require any server-side state.
+type incidentRef struct {
+	ID         string
+	ReportedAt time.Time
+	Severity   string
+	Domain     string
+}
+
+func (ref incidentRef) encode() string {
+	return url.Values{
+		"id":          {ref.ID},
+		"reported_at": {strconv.FormatInt(ref.ReportedAt.Unix(), 10)},
+		"severity":    {ref.Severity},
+		"domain":      {ref.Domain},
+	}.Encode()
+}
+
+func decodeIncidentRef(value string) (incidentRef, error) {
+	values, err := url.ParseQuery(value)
+	if err != nil {
+		return incidentRef{}, fmt.Errorf("invalid incident reference: %w", err)
+	}
+	reportedAt, err := strconv.ParseInt(values.Get("reported_at"), 10, 64)
+	if err != nil {
+		return incidentRef{}, fmt.Errorf("invalid incident report time: %w", err)
+	}
+	return incidentRef{
+		ID:         values.Get("id"),
+		ReportedAt: time.Unix(reportedAt, 0),
+		Severity:   values.Get("severity"),
+		Domain:     values.Get("domain"),
+	}, nil
+}
+
+// refFromIncident returns the reference to a stored incident
+func refFromIncident(inc *incident.Incident) incidentRef {
+	return incidentRef{
+		ID:         inc.ID,
+		ReportedAt: inc.CreatedAt,
+		Severity:   inc.Fields[config.SEVERITY_INPUT_KEY],
+		Domain:     inc.Fields[config.DOMAINS_INPUT_KEY],
+	}
+}
+
+// metricTags returns the tags attached to every metric about this incident
+func (ref incidentRef) metricTags() []string {
+	return []string{"severity:" + ref.Severity, "domain:" + ref.Domain}
+}
+
+// incidentMessageBlocks builds the announcement blocks: the message and the action buttons
+func incidentMessageBlocks(messageText string, ref incidentRef) []slack.Block {
+	if runes := []rune(messageText); len(runes) > maxSectionTextLength {
+		messageText = string(runes[:maxSectionTextLength-1]) + "…"
+	}
+	return []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, messageText, false, false), nil, nil),
+		incidentActionsBlock(ref, true),
+	}
+}
+
+func incidentActionsBlock(ref incidentRef, withAcknowledge bool) *slack.ActionBlock {
+	value := ref.encode()
+	var elements []slack.BlockElement
+	if withAcknowledge {
+		elements = append(elements, slack.NewButtonBlockElement(actionAcknowledge, value,
+			slack.NewTextBlockObject(slack.PlainTextType, "Acknowledge", false, false)).WithStyle(slack.StylePrimary))
+	}
+	elements = append(elements, slack.NewButtonBlockElement(actionResolve, value,
+		slack.NewTextBlockObject(slack.PlainTextType, "Resolve", false, false)))
+	return slack.NewActionBlock(incidentActionsBlockID, elements...)
+}
+
+// handleBlockActions processes clicks on the announcement buttons
+func (h *SlackHandler) handleBlockActions(ctx context.Context, w http.ResponseWriter, interaction *slack.InteractionCallback) {
+	for _, action := range interaction.ActionCallback.BlockActions {
+		if action.BlockID != incidentActionsBlockID {
+			logutil.DebugCtx(ctx, "Ignoring unknown block action", zap.String("action_id", action.ActionID))
+			continue
+		}
+
+		ref, err := decodeIncidentRef(action.Value)
+		if err != nil {
+			h.handleError(ctx, w, apperrors.New(http.StatusBadRequest, "Invalid incident action", apperrors.CategoryClient, err))
+			return
+		}
+		ctx := ctx
+		if ref.ID != "" {
+			ctx = logutil.WithFields(ctx, zap.String(logutil.FieldIncidentID, ref.ID))
+		}
+
+		decision := h.authorizer().Authorize(ctx, authorization.Request{
+			Action:       authorizationActions[action.ActionID],
+			UserID:       interaction.User.ID,
+			ChannelID:    interaction.Channel.ID,
+			TeamID:       interaction.Team.ID,
+			EnterpriseID: interaction.Enterprise.ID,
+			Severity:     ref.Severity,
+		})
+		if !decision.Allowed {
+			h.denyAction(ctx, interaction, decision)
+			continue
+		}
+
+		if err := h.applyIncidentAction(ctx, interaction, action.ActionID, ref); err != nil {
+			h.handleError(ctx, w, apperrors.New(http.StatusInternalServerError, "Failed to update incident", apperrors.CategoryServer, err))
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// applyIncidentAction records the time-to-ack or time-to-resolve metric and updates the
+// announcement to show who acknowledged or resolved the incident. An action already applied,
+// e.g. a double click or a click on a stale announcement, is ignored and only the buttons left
+// are updated.
+func (h *SlackHandler) applyIncidentAction(ctx context.Context, interaction *slack.InteractionCallback, actionID string, ref incidentRef) error {
+	if actionID != actionAcknowledge && actionID != actionResolve {
+		logutil.DebugCtx(ctx, "Ignoring unknown incident action", zap.String("action_id", actionID))
+		return nil
+	}
+
+	applied, err := h.recordIncidentAction(ctx, ref.ID, actionID, interaction.User.ID)
+	if errors.Is(err, errActionApplied) {
+		logutil.InfoCtx(ctx, "Ignoring incident action already applied", zap.String("action_id", actionID))
+		var actions *slack.ActionBlock
+		if !applied.IsResolved() {
+			actions = incidentActionsBlock(ref, false)
+		}
+		return h.updateAnnouncement(ctx, interaction, nil, actions)
+	}
+
+	elapsed := time.Since(ref.ReportedAt).Truncate(time.Second)
+	var status string
+	var actions *slack.ActionBlock
+	switch actionID {
+	case actionAcknowledge:
+		metrics.Duration(h.metrics, metrics.IncidentTimeToAck, elapsed, ref.metricTags()...)
+		status = fmt.Sprintf(":eyes: Acknowledged by <@%s> after %s", interaction.User.ID, elapsed)
+		actions = incidentActionsBlock(ref, false)
+	case actionResolve:
+		metrics.Duration(h.metrics, metrics.IncidentTimeToResolve, elapsed, ref.metricTags()...)
+		status = fmt.Sprintf(":white_check_mark: Resolved by <@%s> after %s", interaction.User.ID, elapsed)
+	}
+
+	logutil.InfoCtx(ctx, "Incident action applied",
+		zap.String("action_id", actionID),
+		zap.Duration("elapsed", elapsed))
+
+	statusBlock := slack.NewContextBlock(incidentStatusBlockID+"_"+actionID,
+		slack.NewTextBlockObject(slack.MarkdownType, status, false, false))
+	return h.updateAnnouncement(ctx, interaction, statusBlock, actions)
+}
+
+// updateAnnouncement replaces the buttons of the announcement with actions, if any, after adding
+// the status block, if any
+func (h *SlackHandler) updateAnnouncement(ctx context.Context, interaction *slack.InteractionCallback, status *slack.ContextBlock, actions *slack.ActionBlock) error {
+	var blocks []slack.Block
+	for _, block := range interaction.Message.Blocks.BlockSet {
+		if actionBlock, ok := block.(*slack.ActionBlock); ok && actionBlock.BlockID == incidentActionsBlockID {
+			continue
+		}
+		blocks = append(blocks, block)
+	}
+	if status != nil {
+		blocks = append(blocks, status)
+	}
+	if actions != nil {
+		blocks = append(blocks, actions)
+	}
+
+	slackService, err := h.slackService.ForTeam(ctx, interaction.Enterprise.ID, interaction.Team.ID)
+	if err != nil {
+		return err
+	}
+	_, _, _, err = slackService.UpdateMessage(ctx, interaction.Channel.ID, interaction.Message.Timestamp,
+		slack.MsgOptionText(interaction.Message.Text, false),
+		slack.MsgOptionBlocks(blocks...))
+	if err != nil {
+		return fmt.Errorf("failed to update incident message: %w", err)
+	}
+	return nil
+}
+
+// recordIncidentAction stores who acknowledged or resolved the incident. Announcements posted
+// before incidents were stored carry no ID and are only updated in Slack. Failing to store the
+// action is logged, only errActionApplied is returned, with the stored incident.
+func (h *SlackHandler) recordIncidentAction(ctx context.Context, incidentID, actionID, userID string) (*incident.Incident, error) {
+	if incidentID == "" {
+		return nil, nil
+	}
+	inc, err := h.updateIncident(ctx, incidentID, actionID, userID)
+	if errors.Is(err, errActionApplied) {
+		return inc, err
+	}
+	if err != nil {
+		logutil.ErrorCtx(ctx, "Failed to record incident action", zap.Error(err))
+	}
+	return inc, nil
+}
+
+// ResolveIncident marks the incident as resolved by the actor, a Slack user ID or
+// audit.ActorSystem, outside of Slack, e.g. from the command line. The announcement is not
+// updated.
+func (h *SlackHandler) ResolveIncident(ctx context.Context, incidentID, actor string) (*incident.Incident, error) {
+	return h.updateIncident(ctx, incidentID, actionResolve, actor)
+}
+
+// updateIncident stores who acknowledged or resolved the incident and records the action in the
+// audit trail. A resolved incident, or an acknowledged one for an acknowledgement, is returned
+// unchanged with errActionApplied.
+func (h *SlackHandler) updateIncident(ctx context.Context, incidentID, actionID, userID string) (*incident.Incident, error) {
+	// The incident is changed atomically, concurrent clicks cannot both see it open
+	var before *incident.Incident
+	inc, err := h.store.Modify(ctx, incidentID, func(inc *incident.Incident) error {
+		if inc.IsResolved() || actionID == actionAcknowledge && inc.AcknowledgedAt != nil {
+			return errActionApplied
+		}
+		before = inc.Clone()
+		now := time.Now().UTC()
+		switch actionID {
+		case actionAcknowledge:
+			inc.AcknowledgedAt, inc.AcknowledgedBy = &now, userID
+		case actionResolve:
+			inc.ResolvedAt, inc.ResolvedBy = &now, userID
+		}
+		return nil
+	})
+	if errors.Is(err, errActionApplied) {
+		return inc, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update incident: %w", err)
+	}
+	h.recordAudit(ctx, userID, auditActions[actionID], before, inc)
+	return inc, nil
+}
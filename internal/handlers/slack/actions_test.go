@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+	"github.com/syltek/oncall-incident-reporter/internal/incident"
+	"github.com/syltek/oncall-incident-reporter/internal/metrics"
+	"github.com/syltek/oncall-incident-reporter/internal/service"
+	"github.com/syltek/oncall-incident-reporter/internal/service/fake"
+)
+
+// announcementClick is a click on a button of the announcement of the incident
+func announcementClick(userID string, ref incidentRef) *slack.InteractionCallback {
+	interaction := &slack.InteractionCallback{}
+	interaction.User.ID = userID
+	interaction.Channel.ID = "C1"
+	interaction.Message.Timestamp = "1700000000.000001"
+	interaction.Message.Text = "New incident"
+	interaction.Message.Blocks = slack.Blocks{BlockSet: incidentMessageBlocks("New incident", ref)}
+	return interaction
+}
+
+func TestIncidentActionsAreIdempotent(t *testing.T) {
+	ctx := context.Background()
+	store := incident.NewMemoryStore()
+	inc := &incident.Incident{ID: "INC-1", CreatedAt: time.Now().Add(-time.Minute), Fields: map[string]string{"input_severity": "High"}}
+	require.NoError(t, store.Create(ctx, inc))
+	slackClient := fake.NewSlackClient()
+	recorder := metrics.NewMemoryRecorder()
+	h := NewSlackHandler(service.NewSlackService(slackClient, service.NoRetryPolicy()), nil, recorder, store,
+		&config.Config{SlackConfig: &config.SlackConfig{}, Modal: &config.Modal{Title: "Report incident"}})
+	ref := refFromIncident(inc)
+
+	require.NoError(t, h.applyIncidentAction(ctx, announcementClick("U1", ref), actionResolve, ref))
+	// A double click, or a click on the announcement before it was updated
+	require.NoError(t, h.applyIncidentAction(ctx, announcementClick("U2", ref), actionResolve, ref))
+	require.NoError(t, h.applyIncidentAction(ctx, announcementClick("U3", ref), actionAcknowledge, ref))
+
+	stored, err := store.Get(ctx, "INC-1")
+	require.NoError(t, err)
+	assert.Equal(t, "U1", stored.ResolvedBy)
+	assert.Nil(t, stored.AcknowledgedAt)
+	assert.Len(t, recorder.Find(metrics.IncidentTimeToResolve), 1)
+	assert.Empty(t, recorder.Find(metrics.IncidentTimeToAck))
+
+	// Every update of the announcement drops the buttons
+	updates := slackClient.Updates()
+	require.Len(t, updates, 3)
+	for _, update := range updates {
+		assert.NotContains(t, update.Blocks, incidentActionsBlockID)
+	}
+}
+
+func TestAcknowledgeTwiceKeepsResolve(t *testing.T) {
+	ctx := context.Background()
+	store := incident.NewMemoryStore()
+	inc := &incident.Incident{ID: "INC-1", CreatedAt: time.Now()}
+	require.NoError(t, store.Create(ctx, inc))
+	slackClient := fake.NewSlackClient()
+	h := NewSlackHandler(service.NewSlackService(slackClient, service.NoRetryPolicy()), nil, metrics.NewNoopRecorder(), store,
+		&config.Config{SlackConfig: &config.SlackConfig{}, Modal: &config.Modal{Title: "Report incident"}})
+	ref := refFromIncident(inc)
+
+	require.NoError(t, h.applyIncidentAction(ctx, announcementClick("U1", ref), actionAcknowledge, ref))
+	require.NoError(t, h.applyIncidentAction(ctx, announcementClick("U2", ref), actionAcknowledge, ref))
+
+	stored, err := store.Get(ctx, "INC-1")
+	require.NoError(t, err)
+	assert.Equal(t, "U1", stored.AcknowledgedBy)
+	updates := slackClient.Updates()
+	require.Len(t, updates, 2)
+	assert.Contains(t, updates[1].Blocks, actionResolve)
+	assert.NotContains(t, updates[1].Blocks, actionAcknowledge)
+}
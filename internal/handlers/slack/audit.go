@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/syltek/oncall-incident-reporter/internal/audit"
+	"github.com/syltek/oncall-incident-reporter/internal/authorization"
+	"github.com/syltek/oncall-incident-reporter/internal/incident"
+	"github.com/syltek/oncall-incident-reporter/internal/middleware"
+	apperrors "github.com/syltek/oncall-incident-reporter/pkg/errors"
+	"github.com/syltek/oncall-incident-reporter/pkg/logutil"
+	"go.uber.org/zap"
+)
+
+// subcommandAudit is the slash command text listing the audit trail, e.g. "/incident audit" or
+// "/incident audit INC-1a2b3c4d"
+const subcommandAudit = "audit"
+
+// auditCommandLimit is the number of entries listed by the audit subcommand
+const auditCommandLimit = 20
+
+// scrubAudit is the name of the audit trail in the scrubbing policies
+const scrubAudit = "audit"
+
+// auditActions maps the announcement buttons to the actions of the audit trail
+var auditActions = map[string]string{
+	actionAcknowledge: audit.ActionAcknowledged,
+	actionResolve:     audit.ActionResolved,
+}
+
+// WithAuditLog records the incident actions in the audit trail
+func (h *SlackHandler) WithAuditLog(log audit.Log) *SlackHandler {
+	h.audit = log
+	return h
+}
+
+// recordAudit appends the action to the audit trail with the incident fields it changed.
+// Before is nil for a new incident. Failing to record the action does not fail it.
+func (h *SlackHandler) recordAudit(ctx context.Context, actor, action string, before, after *incident.Incident) {
+	if h.audit == nil {
+		return
+	}
+
+	var beforeState map[string]string
+	if before != nil {
+		beforeState = h.auditState(before)
+	}
+	changedBefore, changedAfter := audit.Changes(beforeState, h.auditState(after))
+
+	err := h.audit.Append(ctx, audit.Entry{
+		Actor:        actor,
+		Action:       action,
+		IncidentID:   after.ID,
+		Before:       changedBefore,
+		After:        changedAfter,
+		RequestID:    middleware.RequestIDFromContext(ctx),
+		TeamID:       after.Reporter.TeamID,
+		EnterpriseID: after.Reporter.EnterpriseID,
+	})
+	if err != nil {
+		logutil.ErrorCtx(ctx, "Failed to record audit entry", zap.String("audit_action", action), zap.Error(err))
+	}
+}
+
+// auditState is the state of the incident recorded in the audit trail. The reported fields are
+// scrubbed as for a third party, the trail is kept and exported long after the incident.
+func (h *SlackHandler) auditState(inc *incident.Incident) map[string]string {
+	state := inc.AuditState()
+	for key, value := range h.fieldsFor(scrubAudit, inc.Fields) {
+		state["fields."+key] = value
+	}
+	return state
+}
+
+// handleAuditCommand answers the audit subcommand with the latest entries of the audit trail,
+// of a single incident if its ID is given, in a message only the user sees. Only the entries of
+// the incidents reported in the workspace of the user are listed.
+func (h *SlackHandler) handleAuditCommand(ctx context.Context, w http.ResponseWriter, r *http.Request, args []string) {
+	decision := h.authorizer().Authorize(ctx, authorization.Request{
+		Action:       authorization.ActionViewAudit,
+		UserID:       r.FormValue("user_id"),
+		ChannelID:    r.FormValue("channel_id"),
+		TeamID:       r.FormValue("team_id"),
+		EnterpriseID: r.FormValue("enterprise_id"),
+	})
+	if !decision.Allowed {
+		h.denyCommand(ctx, w, decision)
+		return
+	}
+
+	if h.audit == nil {
+		h.sendResponse(ctx, w, map[string]interface{}{
+			"response_type": slack.ResponseTypeEphemeral,
+			"text":          "The audit trail is disabled.",
+		})
+		return
+	}
+
+	// Without a workspace the filter would select the whole trail
+	if r.FormValue("team_id") == "" {
+		h.commandError(ctx, w, apperrors.ErrInvalidPayload.WithMessage("Missing team ID"))
+		return
+	}
+	filter := audit.Filter{
+		TeamID:       r.FormValue("team_id"),
+		EnterpriseID: r.FormValue("enterprise_id"),
+		Limit:        auditCommandLimit,
+	}
+	if len(args) > 0 {
+		filter.IncidentID = args[0]
+	}
+	entries, err := h.audit.Query(ctx, filter)
+	if err != nil {
+		h.commandError(ctx, w, apperrors.ErrStoreUnavailable.WithMessage("Failed to read the audit trail").Wrap(err))
+		return
+	}
+
+	h.sendResponse(ctx, w, map[string]interface{}{
+		"response_type": slack.ResponseTypeEphemeral,
+		"text":          formatAuditEntries(entries, filter.IncidentID),
+	})
+}
+
+// formatAuditEntries lists the entries as Slack mrkdwn, most recent first
+func formatAuditEntries(entries []audit.Entry, incidentID string) string {
+	if len(entries) == 0 {
+		if incidentID != "" {
+			return "No audit entries for *" + incidentID + "*."
+		}
+		return "The audit trail is empty."
+	}
+
+	var text strings.Builder
+	if incidentID != "" {
+		fmt.Fprintf(&text, "*Audit trail of %s*\n", incidentID)
+	} else {
+		fmt.Fprintf(&text, "*Latest %d audit entries*\n", len(entries))
+	}
+	for _, entry := range slices.Backward(entries) {
+		actor := entry.Actor
+		if actor != audit.ActorSystem {
+			actor = "<@" + actor + ">"
+		}
+		fmt.Fprintf(&text, "• %s %s `%s` %s", entry.Timestamp.Format(time.DateTime), actor, entry.Action, entry.IncidentID)
+		if changes := formatChanges(entry); changes != "" {
+			text.WriteString(" — " + changes)
+		}
+		text.WriteString("\n")
+	}
+	return text.String()
+}
+
+// formatChanges names the fields changed by the entry. Reported fields are not listed one by
+// one, they may be long.
+func formatChanges(entry audit.Entry) string {
+	var keys []string
+	for key := range entry.After {
+		if !strings.HasPrefix(key, "fields.") {
+			keys = append(keys, key)
+		}
+	}
+	for key := range entry.Before {
+		if _, ok := entry.After[key]; !ok && !strings.HasPrefix(key, "fields.") {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return strings.Join(keys, ", ")
+}
+
+// AuditExportHandler serves the audit trail as JSON lines to the holders of the export token
+type AuditExportHandler struct {
+	log   audit.Log
+	token string
+}
+
+// NewAuditExportHandler creates an AuditExportHandler requiring the token as bearer token
+func NewAuditExportHandler(log audit.Log, token string) *AuditExportHandler {
+	return &AuditExportHandler{log: log, token: token}
+}
+
+// HandleExport writes the entries matching the incident_id, actor, action, team_id and since
+// (RFC 3339) query parameters, oldest first. The limit parameter keeps the most recent entries only.
+func (h *AuditExportHandler) HandleExport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !validBearerToken(r, h.token) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := audit.Filter{
+		IncidentID: query.Get("incident_id"),
+		Actor:      query.Get("actor"),
+		Action:     query.Get("action"),
+		TeamID:     query.Get("team_id"),
+	}
+	if since := query.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			http.Error(w, "Invalid since, expected an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		filter.Since = t
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid limit, expected a positive number", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	entries, err := h.log.Query(ctx, filter)
+	if err != nil {
+		logutil.ErrorCtx(ctx, "Failed to export audit trail", zap.Error(err))
+		http.Error(w, "Failed to read audit trail", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-store")
+	enc := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			logutil.ErrorCtx(ctx, "Failed to write audit export", zap.Error(err))
+			return
+		}
+	}
+	logutil.InfoCtx(ctx, "Audit trail exported", zap.Int("entries", len(entries)))
+}
+
+// validBearerToken reports whether the request carries the token as bearer token. The tokens
+// are compared in constant time.
+func validBearerToken(r *http.Request, token string) bool {
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
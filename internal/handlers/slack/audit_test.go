@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syltek/oncall-incident-reporter/internal/audit"
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+	"github.com/syltek/oncall-incident-reporter/internal/incident"
+	"github.com/syltek/oncall-incident-reporter/internal/service/fake"
+)
+
+func TestAuditCommand(t *testing.T) {
+	ctx := context.Background()
+	store, log := incident.NewMemoryStore(), audit.NewMemoryLog()
+	h := newDedupeHandler(store, fake.NewSlackClient()).WithAuditLog(log)
+	h.config().Scrubbing = &config.Scrubbing{Enabled: true}
+	h.config().Authorization = &config.Authorization{ViewAudit: config.AccessRule{AllowedUsers: []string{"U1"}}}
+	require.NoError(t, h.ApplyConfig(h.config()))
+
+	require.NoError(t, h.reportIncident(ctx, "V1", incident.Reporter{ID: "U1", TeamID: "T1"}, map[string]string{
+		config.DESCRIPTION_INPUT_KEY: "Customer jane@example.com cannot pay",
+	}))
+	h.WaitForDeliveries()
+	require.NoError(t, log.Append(ctx, audit.Entry{Actor: "U9", Action: audit.ActionReported, IncidentID: "INC-other", TeamID: "T2"}))
+
+	// The trail holds the scrubbed fields
+	entries, err := log.Query(ctx, audit.Filter{Action: audit.ActionReported, TeamID: "T1"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	reported := entries[0]
+	assert.NotContains(t, reported.After["fields."+config.DESCRIPTION_INPUT_KEY], "jane@example.com")
+
+	command := func(userID, teamID string) string {
+		form := url.Values{"text": {"audit"}, "user_id": {userID}, "team_id": {teamID}}
+		req := httptest.NewRequest(http.MethodPost, "/incident", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		h.HandleCommand(rec, req)
+		return decodeResponse(t, rec)["text"].(string)
+	}
+
+	// Only the entries of the workspace of the user are listed
+	text := command("U1", "T1")
+	assert.Contains(t, text, reported.IncidentID)
+	assert.NotContains(t, text, "INC-other")
+
+	// Reading the trail must be granted, being allowed to report is not enough
+	assert.Contains(t, command("U2", "T1"), "not allowed to view the audit trail")
+}
+
+func TestAuditExport(t *testing.T) {
+	log := audit.NewMemoryLog()
+	ctx := context.Background()
+	require.NoError(t, log.Append(ctx, audit.Entry{Actor: "U1", Action: audit.ActionReported, IncidentID: "INC-1"}))
+	require.NoError(t, log.Append(ctx, audit.Entry{Actor: "U2", Action: audit.ActionResolved, IncidentID: "INC-1"}))
+	require.NoError(t, log.Append(ctx, audit.Entry{Actor: "U1", Action: audit.ActionReported, IncidentID: "INC-2"}))
+	h := NewAuditExportHandler(log, "export-token")
+
+	export := func(target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		h.HandleExport(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, export("/audit/export", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, export("/audit/export", "wrong-token").Code)
+	assert.Equal(t, http.StatusBadRequest, export("/audit/export?since=yesterday", "export-token").Code)
+
+	rec := export("/audit/export?incident_id=INC-1", "export-token")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/x-ndjson", rec.Header().Get("Content-Type"))
+
+	var actions []string
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var entry audit.Entry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		actions = append(actions, entry.Action)
+	}
+	assert.Equal(t, []string{audit.ActionReported, audit.ActionResolved}, actions)
+}
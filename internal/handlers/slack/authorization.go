@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/slack-go/slack"
+	"github.com/syltek/oncall-incident-reporter/internal/authorization"
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+	"github.com/syltek/oncall-incident-reporter/internal/service"
+	"github.com/syltek/oncall-incident-reporter/pkg/logutil"
+	"go.uber.org/zap"
+)
+
+// modalMetadata travels in the private metadata of the incident modal, so the submission knows
+// where the slash command was run
+type modalMetadata struct {
+	ChannelID string `json:"channel_id,omitempty"`
+}
+
+func (m modalMetadata) encode() string {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// decodeModalMetadata parses the private metadata of the incident modal. Modals opened before
+// the metadata existed have none.
+func decodeModalMetadata(ctx context.Context, value string) modalMetadata {
+	var metadata modalMetadata
+	if value == "" {
+		return metadata
+	}
+	if err := json.Unmarshal([]byte(value), &metadata); err != nil {
+		logutil.ErrorCtx(ctx, "Invalid modal metadata", zap.Error(err))
+	}
+	return metadata
+}
+
+// workspaceUserGroups reads user groups through the token of their workspace
+type workspaceUserGroups struct {
+	slackService *service.SlackService
+}
+
+func (g workspaceUserGroups) GetUserGroupMembers(ctx context.Context, enterpriseID, teamID, userGroup string) ([]string, error) {
+	slackService, err := g.slackService.ForTeam(ctx, enterpriseID, teamID)
+	if err != nil {
+		return nil, err
+	}
+	return slackService.GetUserGroupMembers(ctx, userGroup)
+}
+
+// denyCommand answers a slash command with a message only the user sees
+func (h *SlackHandler) denyCommand(ctx context.Context, w http.ResponseWriter, decision authorization.Decision) {
+	h.sendResponse(ctx, w, map[string]interface{}{
+		"response_type": slack.ResponseTypeEphemeral,
+		"text":          ":no_entry: " + decision.Reason,
+	})
+}
+
+// denySubmission keeps the modal open and shows the denial under the severity input
+func (h *SlackHandler) denySubmission(ctx context.Context, w http.ResponseWriter, decision authorization.Decision) {
+	h.sendResponse(ctx, w, map[string]interface{}{
+		"response_action": "errors",
+		"errors":          map[string]string{config.SEVERITY_INPUT_KEY: decision.Reason},
+	})
+}
+
+// denyAction tells the user who clicked an announcement button, and only them, that they
+// cannot change the incident
+func (h *SlackHandler) denyAction(ctx context.Context, interaction *slack.InteractionCallback, decision authorization.Decision) {
+	slackService, err := h.slackService.ForTeam(ctx, interaction.Enterprise.ID, interaction.Team.ID)
+	if err != nil {
+		logutil.ErrorCtx(ctx, "Failed to send authorization denial", zap.String("user_id", interaction.User.ID), zap.Error(err))
+		return
+	}
+	if _, err := slackService.PostEphemeral(ctx, interaction.Channel.ID, interaction.User.ID,
+		slack.MsgOptionText(":no_entry: "+decision.Reason, false)); err != nil {
+		logutil.ErrorCtx(ctx, "Failed to send authorization denial",
+			zap.String("user_id", interaction.User.ID),
+			zap.Error(err))
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+	"github.com/syltek/oncall-incident-reporter/pkg/logutil"
+	"go.uber.org/zap"
+)
+
+// monitorLookupTimeout bounds the lookup of the alerting monitors, the incident is reported
+// with the configured links only when Datadog is slow
+var monitorLookupTimeout = 2 * time.Second
+
+// domainContext holds the Datadog links relevant to the affected domain of an incident
+type domainContext struct {
+	Dashboards       []config.Link
+	Monitors         []config.Link
+	AlertingMonitors []config.Link
+}
+
+// isEmpty reports whether there is nothing to append to the incident message
+func (d *domainContext) isEmpty() bool {
+	return d == nil || len(d.Dashboards) == 0 && len(d.Monitors) == 0 && len(d.AlertingMonitors) == 0
+}
+
+// slackEscaper escapes the characters Slack reserves for links and mentions, e.g. in monitor names
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// slackText renders the context using Slack mrkdwn titles and links
+func (d *domainContext) slackText() string {
+	return d.render(
+		func(title string) string { return "*" + title + ":*" },
+		func(link config.Link) string {
+			return fmt.Sprintf("<%s|%s>", link.URL, slackEscaper.Replace(link.Title))
+		},
+	)
+}
+
+// markdownText renders the context using markdown titles and links, as understood by Datadog events
+func (d *domainContext) markdownText() string {
+	return d.render(
+		func(title string) string { return "**" + title + ":**" },
+		func(link config.Link) string { return fmt.Sprintf("[%s](%s)", link.Title, link.URL) },
+	)
+}
+
+func (d *domainContext) render(formatTitle func(string) string, formatLink func(config.Link) string) string {
+	if d.isEmpty() {
+		return ""
+	}
+
+	var sb strings.Builder
+	section := func(title string, links []config.Link) {
+		if len(links) == 0 {
+			return
+		}
+		sb.WriteString("\n" + formatTitle(title) + "\n")
+		for _, link := range links {
+			sb.WriteString("• " + formatLink(link) + "\n")
+		}
+	}
+
+	section("Monitors in Alert", d.AlertingMonitors)
+	section("Dashboards", d.Dashboards)
+	section("Monitors", d.Monitors)
+
+	return sb.String()
+}
+
+// buildDomainContext collects the configured links for the domain and looks up the monitors
+// currently in Alert state. A failed or timed out lookup is logged and does not prevent reporting
+// the incident.
+func (h *SlackHandler) buildDomainContext(ctx context.Context, domain string) *domainContext {
+	domainConfig, ok := h.config().Datadog.DomainContext(domain)
+	if !ok {
+		logutil.DebugCtx(ctx, "No Datadog context configured for domain", zap.String("domain", domain))
+		return nil
+	}
+
+	result := &domainContext{
+		Dashboards: domainConfig.Dashboards,
+		Monitors:   domainConfig.Monitors,
+	}
+
+	if domainConfig.MonitorTag == "" {
+		return result
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, monitorLookupTimeout)
+	defer cancel()
+	monitors, err := h.datadogService.ListAlertingMonitors(lookupCtx, domainConfig.MonitorTag)
+	if err != nil {
+		logutil.ErrorCtx(ctx, "Failed to look up alerting monitors",
+			zap.String("domain", domain),
+			zap.String("monitor_tag", domainConfig.MonitorTag),
+			zap.Error(err))
+		return result
+	}
+
+	for _, monitor := range monitors {
+		result.AlertingMonitors = append(result.AlertingMonitors, config.Link{
+			Title: monitor.GetName(),
+			URL:   fmt.Sprintf("%s/monitors/%d", strings.TrimSuffix(h.config().Datadog.AppURL, "/"), monitor.GetId()),
+		})
+	}
+
+	logutil.DebugCtx(ctx, "Datadog context built",
+		zap.String("domain", domain),
+		zap.Int("alerting_monitors", len(result.AlertingMonitors)))
+
+	return result
+}
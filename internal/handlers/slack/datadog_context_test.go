@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+	"github.com/syltek/oncall-incident-reporter/internal/incident"
+	"github.com/syltek/oncall-incident-reporter/internal/metrics"
+	"github.com/syltek/oncall-incident-reporter/internal/service"
+)
+
+// monitorsAPI answers the monitor lookups with its monitors or error, after an optional delay
+type monitorsAPI struct {
+	monitors []datadogV1.Monitor
+	err      error
+	delay    time.Duration
+}
+
+func (m *monitorsAPI) ListMonitors(ctx context.Context, _ ...datadogV1.ListMonitorsOptionalParameters) ([]datadogV1.Monitor, *http.Response, error) {
+	select {
+	case <-time.After(m.delay):
+		return m.monitors, nil, m.err
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+}
+
+func newDatadogContextHandler(monitors *monitorsAPI) *SlackHandler {
+	cfg := &config.Config{
+		SlackConfig: &config.SlackConfig{},
+		Modal:       &config.Modal{Title: "Report incident"},
+		Datadog: &config.Datadog{
+			AppURL: "https://app.datadoghq.eu/",
+			Domains: map[string]config.DomainContext{
+				"payments": {
+					MonitorTag: "domain:payments",
+					Dashboards: []config.Link{{Title: "Payments overview", URL: "https://app.datadoghq.eu/dashboard/abc"}},
+					Monitors:   []config.Link{{Title: "Payments error rate", URL: "https://app.datadoghq.eu/monitors/1"}},
+				},
+			},
+		},
+	}
+	datadogService := service.NewDatadogService(nil, monitors, service.NoRetryPolicy())
+	return NewSlackHandler(nil, datadogService, metrics.NewNoopRecorder(), incident.NewMemoryStore(), cfg)
+}
+
+func TestBuildDomainContext(t *testing.T) {
+	alerting := datadogV1.Monitor{}
+	alerting.SetId(42)
+	alerting.SetName("Checkout 5xx")
+	alerting.SetOverallState(datadogV1.MONITOROVERALLSTATES_ALERT)
+	h := newDatadogContextHandler(&monitorsAPI{monitors: []datadogV1.Monitor{alerting}})
+
+	ddContext := h.buildDomainContext(context.Background(), "Payments")
+	require.NotNil(t, ddContext)
+	assert.Equal(t, []config.Link{{Title: "Checkout 5xx", URL: "https://app.datadoghq.eu/monitors/42"}}, ddContext.AlertingMonitors)
+
+	assert.Equal(t, "\n*Monitors in Alert:*\n• <https://app.datadoghq.eu/monitors/42|Checkout 5xx>\n"+
+		"\n*Dashboards:*\n• <https://app.datadoghq.eu/dashboard/abc|Payments overview>\n"+
+		"\n*Monitors:*\n• <https://app.datadoghq.eu/monitors/1|Payments error rate>\n", ddContext.slackText())
+	assert.Equal(t, "\n**Monitors in Alert:**\n• [Checkout 5xx](https://app.datadoghq.eu/monitors/42)\n"+
+		"\n**Dashboards:**\n• [Payments overview](https://app.datadoghq.eu/dashboard/abc)\n"+
+		"\n**Monitors:**\n• [Payments error rate](https://app.datadoghq.eu/monitors/1)\n", ddContext.markdownText())
+
+	assert.Nil(t, h.buildDomainContext(context.Background(), "Bookings"), "domains without context")
+	assert.Empty(t, (*domainContext)(nil).slackText())
+
+	// Monitor names cannot break the Slack link
+	escaped := &domainContext{AlertingMonitors: []config.Link{{Title: "p99 > 1s & <errors>", URL: "https://app.datadoghq.eu/monitors/43"}}}
+	assert.Equal(t, "\n*Monitors in Alert:*\n• <https://app.datadoghq.eu/monitors/43|p99 &gt; 1s &amp; &lt;errors&gt;>\n", escaped.slackText())
+}
+
+func TestBuildDomainContextFallsBackToConfiguredLinks(t *testing.T) {
+	previous := monitorLookupTimeout
+	monitorLookupTimeout = 10 * time.Millisecond
+	t.Cleanup(func() { monitorLookupTimeout = previous })
+
+	tests := []struct {
+		name     string
+		monitors *monitorsAPI
+	}{
+		{name: "lookup fails", monitors: &monitorsAPI{err: errors.New("forbidden")}},
+		{name: "lookup times out", monitors: &monitorsAPI{delay: time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newDatadogContextHandler(tt.monitors)
+
+			start := time.Now()
+			ddContext := h.buildDomainContext(context.Background(), "payments")
+			assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+			require.NotNil(t, ddContext)
+			assert.Empty(t, ddContext.AlertingMonitors)
+			assert.Len(t, ddContext.Dashboards, 1)
+			assert.Len(t, ddContext.Monitors, 1)
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/syltek/oncall-incident-reporter/internal/audit"
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+	"github.com/syltek/oncall-incident-reporter/internal/incident"
+	apperrors "github.com/syltek/oncall-incident-reporter/pkg/errors"
+	"github.com/syltek/oncall-incident-reporter/pkg/logutil"
+	"go.uber.org/zap"
+)
+
+// Identifiers of the view asking a reporter whether to join a similar incident
+const (
+	duplicateCallbackID    = "duplicate_incident"
+	duplicateChoiceBlockID = "duplicate_choice"
+	choiceJoin             = "join"
+	choiceReportNew        = "report_new"
+)
+
+// Slack limits the private metadata of a view to 3000 characters
+const maxPrivateMetadataLength = 3000
+
+// errAlreadyReported is returned when the reporter already reported or joined the incident
+var errAlreadyReported = errors.New("incident already reported by the user")
+
+// errOtherWorkspace is returned when a reporter tries to join an incident of another workspace
+var errOtherWorkspace = errors.New("incident reported in another workspace")
+
+// pendingSubmission is a submission held back because a similar incident is open. It travels in
+// the private metadata of the view asking the reporter what to do.
+type pendingSubmission struct {
+	ViewID      string            `json:"view_id"`
+	Reporter    incident.Reporter `json:"reporter"`
+	Fields      map[string]string `json:"fields"`
+	DuplicateOf string            `json:"duplicate_of"`
+}
+
+// claimView guards against processing the same view submission twice, whether it is being
+// processed concurrently (double click, Slack retry) or was already recorded. The returned
+// function releases the claim once processing is over.
+func (h *SlackHandler) claimView(ctx context.Context, viewID string) (func(), bool) {
+	if viewID == "" {
+		return func() {}, true
+	}
+
+	if _, loaded := h.inflight.LoadOrStore(viewID, struct{}{}); loaded {
+		logutil.InfoCtx(ctx, "View submission already being processed")
+		return nil, false
+	}
+	release := func() { h.inflight.Delete(viewID) }
+
+	existing, err := h.store.FindByViewID(ctx, viewID)
+	if err == nil {
+		logutil.InfoCtx(ctx, "View submission already recorded", zap.String(logutil.FieldIncidentID, existing.ID))
+		release()
+		return nil, false
+	}
+	if !errors.Is(err, incident.ErrNotFound) {
+		logutil.ErrorCtx(ctx, "Failed to look up incident by view", zap.Error(err))
+	}
+
+	return release, true
+}
+
+// findSimilarIncident returns the most recent unresolved incident of the reporter's workspace
+// with the same domain and severity reported within the deduplication window, if any. The
+// incidents of other workspaces are never shown, they belong to other tenants.
+func (h *SlackHandler) findSimilarIncident(ctx context.Context, reporter incident.Reporter, fields map[string]string) *incident.Incident {
+	if h.config().Deduplication == nil || !h.config().Deduplication.Enabled {
+		return nil
+	}
+
+	incidents, err := h.store.List(ctx)
+	if err != nil {
+		logutil.ErrorCtx(ctx, "Failed to list incidents for deduplication", zap.Error(err))
+		return nil
+	}
+
+	window := time.Duration(h.config().Deduplication.Window) * time.Second
+	for _, inc := range incidents {
+		if time.Since(inc.CreatedAt) > window {
+			// Incidents are sorted by creation time, the rest are older
+			break
+		}
+		if inc.IsResolved() || !sameWorkspace(inc.Reporter, reporter) {
+			continue
+		}
+		if inc.Fields[config.SEVERITY_INPUT_KEY] == fields[config.SEVERITY_INPUT_KEY] &&
+			inc.Fields[config.DOMAINS_INPUT_KEY] == fields[config.DOMAINS_INPUT_KEY] {
+			return inc
+		}
+	}
+	return nil
+}
+
+// sameWorkspace reports whether the reporters are in the same Slack workspace
+func sameWorkspace(a, b incident.Reporter) bool {
+	return a.TeamID == b.TeamID && a.EnterpriseID == b.EnterpriseID
+}
+
+// duplicateView builds the view asking the reporter whether to join the similar incident or
+// report a new one. It returns false if the submission does not fit in the view metadata.
+func duplicateView(pending pendingSubmission, similar *incident.Incident) (*slack.ModalViewRequest, bool) {
+	metadata, err := json.Marshal(pending)
+	if err != nil || len(metadata) > maxPrivateMetadataLength {
+		return nil, false
+	}
+
+	text := fmt.Sprintf("An incident with the same severity (*%s*) and domain (*%s*) was reported by <@%s> %s ago: *%s*.\n\n"+
+		"Is it the same problem?",
+		similar.Fields[config.SEVERITY_INPUT_KEY],
+		similar.Fields[config.DOMAINS_INPUT_KEY],
+		similar.Reporter.ID,
+		time.Since(similar.CreatedAt).Truncate(time.Minute),
+		similar.ID)
+
+	joinOption := slack.NewOptionBlockObject(choiceJoin,
+		slack.NewTextBlockObject(slack.PlainTextType, "Yes, join the existing incident", false, false), nil)
+	newOption := slack.NewOptionBlockObject(choiceReportNew,
+		slack.NewTextBlockObject(slack.PlainTextType, "No, report a new incident", false, false), nil)
+	choice := slack.NewRadioButtonsBlockElement(duplicateChoiceBlockID, joinOption, newOption)
+	choice.InitialOption = joinOption
+
+	return &slack.ModalViewRequest{
+		Type:            slack.VTModal,
+		CallbackID:      duplicateCallbackID,
+		PrivateMetadata: string(metadata),
+		Title:           slack.NewTextBlockObject(slack.PlainTextType, "Possible duplicate", false, false),
+		Submit:          slack.NewTextBlockObject(slack.PlainTextType, "Continue", false, false),
+		Close:           slack.NewTextBlockObject(slack.PlainTextType, "Back", false, false),
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+			slack.NewInputBlock(duplicateChoiceBlockID,
+				slack.NewTextBlockObject(slack.PlainTextType, "What do you want to do?", false, false),
+				nil, choice),
+		}},
+	}, true
+}
+
+// handleDuplicateDecision processes the reporter's answer to the possible duplicate view
+func (h *SlackHandler) handleDuplicateDecision(ctx context.Context, w http.ResponseWriter, interaction *slack.InteractionCallback) {
+	var pending pendingSubmission
+	if err := json.Unmarshal([]byte(interaction.View.PrivateMetadata), &pending); err != nil {
+		h.submissionError(ctx, w, apperrors.ErrInvalidPayload.WithMessage("Invalid duplicate incident metadata").Wrap(err), duplicateChoiceBlockID)
+		return
+	}
+
+	var choice string
+	if interaction.View.State != nil {
+		choice = interaction.View.State.Values[duplicateChoiceBlockID][duplicateChoiceBlockID].SelectedOption.Value
+	}
+
+	// The decision view is pushed on top of the incident modal, log the ID of the latter
+	ctx = logutil.WithFields(ctx, zap.String(logutil.FieldViewID, pending.ViewID))
+	logutil.InfoCtx(ctx, "Possible duplicate incident decision",
+		zap.String("choice", choice),
+		zap.String("duplicate_of", pending.DuplicateOf))
+
+	// A double click or a Slack retry of the decision is processed once
+	release, ok := h.claimView(ctx, pending.ViewID)
+	if !ok {
+		h.sendResponse(ctx, w, map[string]interface{}{"response_action": "clear"})
+		return
+	}
+	defer release()
+
+	if choice == choiceJoin {
+		if err := h.joinIncident(ctx, pending); err != nil {
+			h.submissionError(ctx, w, apperrors.ErrStoreUnavailable.WithMessage("Failed to join the incident").Wrap(err), duplicateChoiceBlockID)
+			return
+		}
+		h.sendResponse(ctx, w, map[string]interface{}{"response_action": "clear"})
+		return
+	}
+
+	if err := h.reportIncident(ctx, pending.ViewID, pending.Reporter, pending.Fields); err != nil {
+		h.submissionError(ctx, w, err, duplicateChoiceBlockID)
+		return
+	}
+	h.sendResponse(ctx, w, map[string]interface{}{"response_action": "clear"})
+}
+
+// joinIncident adds the reporter to an existing incident and tells the incident thread
+func (h *SlackHandler) joinIncident(ctx context.Context, pending pendingSubmission) error {
+	// Finish recording the reporter even if Slack stops waiting for the response
+	ctx = logutil.WithFields(context.WithoutCancel(ctx), zap.String(logutil.FieldIncidentID, pending.DuplicateOf))
+	inc, joined, err := h.addReporter(ctx, pending)
+	if err != nil {
+		return err
+	}
+	if !joined {
+		logutil.InfoCtx(ctx, "Reporter already joined the incident")
+		return nil
+	}
+
+	delivery, ok := inc.Deliveries[sinkSlack]
+	if !ok || delivery.Status != incident.DeliveryDelivered {
+		return nil
+	}
+
+	text := fmt.Sprintf(":raised_hand: <@%s> is also seeing this incident.", pending.Reporter.ID)
+	if description := h.fieldsFor(sinkSlack, pending.Fields)[config.DESCRIPTION_INPUT_KEY]; description != "" {
+		text += "\n>" + strings.ReplaceAll(description, "\n", "\n>")
+	}
+	// The incident thread is in the workspace of the original reporter
+	slackService, err := h.slackService.ForTeam(ctx, inc.Reporter.EnterpriseID, inc.Reporter.TeamID)
+	if err != nil {
+		logutil.ErrorCtx(ctx, "Failed to post in incident thread", zap.Error(err))
+		return nil
+	}
+	if _, _, err := slackService.PostMessage(ctx, h.config().ChannelIDFor(inc.Reporter.TeamID),
+		slack.MsgOptionText(text, false),
+		slack.MsgOptionTS(delivery.Reference)); err != nil {
+		logutil.ErrorCtx(ctx, "Failed to post in incident thread", zap.Error(err))
+	}
+
+	logutil.InfoCtx(ctx, "Reporter joined existing incident")
+	return nil
+}
+
+// addReporter adds the reporter of the pending submission to the incident it duplicates, unless
+// they already reported or joined it
+func (h *SlackHandler) addReporter(ctx context.Context, pending pendingSubmission) (*incident.Incident, bool, error) {
+	var before *incident.Incident
+	inc, err := h.store.Modify(ctx, pending.DuplicateOf, func(inc *incident.Incident) error {
+		if !sameWorkspace(inc.Reporter, pending.Reporter) {
+			return errOtherWorkspace
+		}
+		if inc.Reporter.ID == pending.Reporter.ID || slices.ContainsFunc(inc.AlsoReportedBy, func(r incident.Reporter) bool {
+			return r.ID == pending.Reporter.ID
+		}) {
+			return errAlreadyReported
+		}
+		before = inc.Clone()
+		inc.AlsoReportedBy = append(inc.AlsoReportedBy, pending.Reporter)
+		return nil
+	})
+	if errors.Is(err, errAlreadyReported) {
+		return inc, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to update incident %s: %w", pending.DuplicateOf, err)
+	}
+	h.recordAudit(ctx, pending.Reporter.ID, audit.ActionJoined, before, inc)
+	return inc, true, nil
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+	"github.com/syltek/oncall-incident-reporter/internal/incident"
+	"github.com/syltek/oncall-incident-reporter/internal/metrics"
+	"github.com/syltek/oncall-incident-reporter/internal/service"
+	"github.com/syltek/oncall-incident-reporter/internal/service/fake"
+)
+
+func newDedupeHandler(store incident.Store, slackClient *fake.SlackClient) *SlackHandler {
+	cfg := &config.Config{
+		Metadata:      &config.Metadata{},
+		Local:         &config.Local{},
+		SlackConfig:   &config.SlackConfig{ChannelID: "C1", MessageFormat: "{{severity}} incident"},
+		Modal:         &config.Modal{Title: "Report incident"},
+		Deduplication: &config.Deduplication{Enabled: true, Window: 600},
+	}
+	return NewSlackHandler(service.NewSlackService(slackClient, service.NoRetryPolicy()),
+		service.NewDatadogService(fake.NewDatadogClient(), nil, service.NoRetryPolicy()),
+		metrics.NewNoopRecorder(), store, cfg)
+}
+
+// duplicateDecision is the reporter's answer to the possible duplicate view
+func duplicateDecision(t *testing.T, pending pendingSubmission, choice string) *slack.InteractionCallback {
+	t.Helper()
+	metadata, err := json.Marshal(pending)
+	require.NoError(t, err)
+
+	interaction := &slack.InteractionCallback{Type: slack.InteractionTypeViewSubmission}
+	interaction.View.CallbackID = duplicateCallbackID
+	interaction.View.PrivateMetadata = string(metadata)
+	interaction.View.State = &slack.ViewState{Values: map[string]map[string]slack.BlockAction{
+		duplicateChoiceBlockID: {duplicateChoiceBlockID: {SelectedOption: slack.OptionBlockObject{Value: choice}}},
+	}}
+	return interaction
+}
+
+func TestClaimView(t *testing.T) {
+	ctx := context.Background()
+	store := incident.NewMemoryStore()
+	h := newDedupeHandler(store, fake.NewSlackClient())
+
+	release, ok := h.claimView(ctx, "V1")
+	require.True(t, ok)
+	_, ok = h.claimView(ctx, "V1")
+	assert.False(t, ok, "view being processed")
+	release()
+
+	release, ok = h.claimView(ctx, "V1")
+	require.True(t, ok, "view released")
+	require.NoError(t, store.Create(ctx, incident.New("V1", incident.Reporter{ID: "U1"}, nil)))
+	release()
+	_, ok = h.claimView(ctx, "V1")
+	assert.False(t, ok, "view already recorded")
+
+	// Submissions without a view cannot be told apart
+	_, ok = h.claimView(ctx, "")
+	assert.True(t, ok)
+	_, ok = h.claimView(ctx, "")
+	assert.True(t, ok)
+}
+
+func TestFindSimilarIncident(t *testing.T) {
+	ctx := context.Background()
+	fields := map[string]string{"input_severity": "High", "input_domains_affected": "payments"}
+	reporter := incident.Reporter{ID: "U1", TeamID: "T1"}
+	newIncident := func(id string, age time.Duration, severity, domain string) *incident.Incident {
+		return &incident.Incident{
+			ID:        id,
+			CreatedAt: time.Now().Add(-age),
+			Reporter:  incident.Reporter{ID: "U0", TeamID: "T1"},
+			Fields:    map[string]string{"input_severity": severity, "input_domains_affected": domain},
+		}
+	}
+	otherTeam := newIncident("INC-other-team", time.Minute, "High", "payments")
+	otherTeam.Reporter.TeamID = "T2"
+	resolvedAt := time.Now()
+	resolved := newIncident("INC-resolved", time.Minute, "High", "payments")
+	resolved.ResolvedAt = &resolvedAt
+
+	tests := []struct {
+		name      string
+		incidents []*incident.Incident
+		want      string
+	}{
+		{name: "same severity and domain", incidents: []*incident.Incident{newIncident("INC-1", time.Minute, "High", "payments")}, want: "INC-1"},
+		{name: "other severity", incidents: []*incident.Incident{newIncident("INC-1", time.Minute, "Low", "payments")}},
+		{name: "other domain", incidents: []*incident.Incident{newIncident("INC-1", time.Minute, "High", "bookings")}},
+		{name: "outside the window", incidents: []*incident.Incident{newIncident("INC-1", time.Hour, "High", "payments")}},
+		{name: "resolved", incidents: []*incident.Incident{resolved}},
+		{name: "other workspace", incidents: []*incident.Incident{otherTeam}},
+		{
+			name: "most recent",
+			incidents: []*incident.Incident{
+				newIncident("INC-1", 5*time.Minute, "High", "payments"),
+				newIncident("INC-2", time.Minute, "High", "payments"),
+				resolved,
+				otherTeam,
+			},
+			want: "INC-2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := incident.NewMemoryStore()
+			for _, inc := range tt.incidents {
+				require.NoError(t, store.Create(ctx, inc))
+			}
+			similar := newDedupeHandler(store, fake.NewSlackClient()).findSimilarIncident(ctx, reporter, fields)
+			if tt.want == "" {
+				assert.Nil(t, similar)
+				return
+			}
+			require.NotNil(t, similar)
+			assert.Equal(t, tt.want, similar.ID)
+		})
+	}
+
+	h := newDedupeHandler(incident.NewMemoryStore(), fake.NewSlackClient())
+	h.config().Deduplication.Enabled = false
+	assert.Nil(t, h.findSimilarIncident(ctx, reporter, fields), "deduplication disabled")
+}
+
+func TestDuplicateDecision(t *testing.T) {
+	ctx := context.Background()
+	newStore := func(t *testing.T) incident.Store {
+		store := incident.NewMemoryStore()
+		existing := incident.New("V0", incident.Reporter{ID: "U0", TeamID: "T1"}, map[string]string{"input_severity": "High"})
+		existing.ID = "INC-1"
+		existing.Deliveries[sinkSlack] = &incident.Delivery{Status: incident.DeliveryDelivered, Reference: "1700000000.000001"}
+		require.NoError(t, store.Create(ctx, existing))
+		return store
+	}
+	pending := pendingSubmission{
+		ViewID:      "V1",
+		Reporter:    incident.Reporter{ID: "U1", TeamID: "T1"},
+		Fields:      map[string]string{"input_severity": "High"},
+		DuplicateOf: "INC-1",
+	}
+
+	t.Run("join", func(t *testing.T) {
+		store, slackClient := newStore(t), fake.NewSlackClient()
+		h := newDedupeHandler(store, slackClient)
+
+		for range 2 {
+			rec := httptest.NewRecorder()
+			h.handleDuplicateDecision(ctx, rec, duplicateDecision(t, pending, choiceJoin))
+			assert.Equal(t, "clear", decodeResponse(t, rec)["response_action"])
+		}
+
+		// The second click neither joins again nor posts again in the thread
+		inc, err := store.Get(ctx, "INC-1")
+		require.NoError(t, err)
+		assert.Equal(t, []incident.Reporter{pending.Reporter}, inc.AlsoReportedBy)
+		messages := slackClient.Messages()
+		require.Len(t, messages, 1)
+		assert.Contains(t, messages[0].Text, "<@U1> is also seeing this incident")
+	})
+
+	t.Run("join from another workspace", func(t *testing.T) {
+		store, slackClient := newStore(t), fake.NewSlackClient()
+		h := newDedupeHandler(store, slackClient)
+		other := pending
+		other.Reporter = incident.Reporter{ID: "U2", TeamID: "T2"}
+
+		rec := httptest.NewRecorder()
+		h.handleDuplicateDecision(ctx, rec, duplicateDecision(t, other, choiceJoin))
+		assert.Equal(t, "errors", decodeResponse(t, rec)["response_action"])
+
+		// Nothing of the reporter reaches the incident of the other workspace
+		inc, err := store.Get(ctx, "INC-1")
+		require.NoError(t, err)
+		assert.Empty(t, inc.AlsoReportedBy)
+		assert.Empty(t, slackClient.Messages())
+	})
+
+	t.Run("decision being processed", func(t *testing.T) {
+		store := newStore(t)
+		h := newDedupeHandler(store, fake.NewSlackClient())
+		release, ok := h.claimView(ctx, pending.ViewID)
+		require.True(t, ok)
+		defer release()
+
+		rec := httptest.NewRecorder()
+		h.handleDuplicateDecision(ctx, rec, duplicateDecision(t, pending, choiceJoin))
+		assert.Equal(t, "clear", decodeResponse(t, rec)["response_action"])
+
+		inc, err := store.Get(ctx, "INC-1")
+		require.NoError(t, err)
+		assert.Empty(t, inc.AlsoReportedBy)
+	})
+
+	t.Run("report new", func(t *testing.T) {
+		store, slackClient := newStore(t), fake.NewSlackClient()
+		h := newDedupeHandler(store, slackClient)
+
+		for range 2 {
+			rec := httptest.NewRecorder()
+			h.handleDuplicateDecision(ctx, rec, duplicateDecision(t, pending, choiceReportNew))
+			assert.Equal(t, "clear", decodeResponse(t, rec)["response_action"])
+		}
+		h.WaitForDeliveries()
+
+		reported, err := store.FindByViewID(ctx, "V1")
+		require.NoError(t, err)
+		assert.NotEqual(t, "INC-1", reported.ID)
+		incidents, err := store.List(ctx)
+		require.NoError(t, err)
+		assert.Len(t, incidents, 2)
+		assert.Len(t, slackClient.Messages(), 1)
+	})
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+	"github.com/syltek/oncall-incident-reporter/internal/installation"
+	apperrors "github.com/syltek/oncall-incident-reporter/pkg/errors"
+	"github.com/syltek/oncall-incident-reporter/pkg/logutil"
+	"go.uber.org/zap"
+)
+
+const (
+	slackAuthorizeURL = "https://slack.com/oauth/v2/authorize"
+	// oauthStateCookie binds the OAuth state to the browser that started the install
+	oauthStateCookie = "slack_oauth_state"
+	// oauthStateTTL is how long a user has to approve the install in Slack
+	oauthStateTTL = 10 * time.Minute
+)
+
+// OAuthExchanger exchanges the code of the OAuth callback for the tokens of the installation
+type OAuthExchanger func(ctx context.Context, code string) (*slack.OAuthV2Response, error)
+
+// InstallHandler handles the OAuth v2 flow installing the app to a workspace
+type InstallHandler struct {
+	config   *config.OAuth
+	store    installation.Store
+	exchange OAuthExchanger
+	now      func() time.Time
+}
+
+// NewInstallHandler creates an InstallHandler saving installations to the store. Without an
+// exchanger, codes are exchanged through the Slack oauth.v2.access method.
+func NewInstallHandler(oauth *config.OAuth, store installation.Store, exchange OAuthExchanger) *InstallHandler {
+	if exchange == nil {
+		exchange = func(ctx context.Context, code string) (*slack.OAuthV2Response, error) {
+			return slack.GetOAuthV2ResponseContext(ctx, http.DefaultClient, oauth.ClientID, oauth.ClientSecret, code, oauth.RedirectURL)
+		}
+	}
+	return &InstallHandler{
+		config:   oauth,
+		store:    store,
+		exchange: exchange,
+		now:      time.Now,
+	}
+}
+
+// HandleInstall redirects the user to Slack to approve the installation of the app
+func (h *InstallHandler) HandleInstall(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	state, err := h.newState()
+	if err != nil {
+		h.handleError(ctx, w, apperrors.New(http.StatusInternalServerError, "Failed to start installation", apperrors.CategoryServer, err))
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   int(oauthStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	authorizeURL := slackAuthorizeURL + "?" + url.Values{
+		"client_id":    {h.config.ClientID},
+		"scope":        {strings.Join(h.config.Scopes, ",")},
+		"redirect_uri": {h.config.RedirectURL},
+		"state":        {state},
+	}.Encode()
+	http.Redirect(w, r, authorizeURL, http.StatusFound)
+}
+
+// HandleOAuthCallback exchanges the code Slack redirects the user with for a bot token and
+// saves the installation
+func (h *InstallHandler) HandleOAuthCallback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	if slackErr := query.Get("error"); slackErr != "" {
+		logutil.InfoCtx(ctx, "Installation cancelled", zap.String("error", slackErr))
+		h.renderPage(w, http.StatusOK, "Installation cancelled", "The app was not installed.")
+		return
+	}
+
+	cookie, err := r.Cookie(oauthStateCookie)
+	state := query.Get("state")
+	if err != nil || cookie.Value != state || !h.validState(state) {
+		h.handleError(ctx, w, apperrors.New(http.StatusBadRequest, "Invalid or expired installation state", apperrors.CategoryClient, err))
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oauthStateCookie, Path: "/", MaxAge: -1})
+
+	code := query.Get("code")
+	if code == "" {
+		h.handleError(ctx, w, apperrors.New(http.StatusBadRequest, "Missing authorization code", apperrors.CategoryClient, nil))
+		return
+	}
+
+	resp, err := h.exchange(ctx, code)
+	if err != nil {
+		h.handleError(ctx, w, apperrors.New(http.StatusBadGateway, "Failed to complete installation with Slack", apperrors.CategoryServer, err))
+		return
+	}
+
+	if !h.config.AllowsInstall(resp.Enterprise.ID, resp.Team.ID, resp.IsEnterpriseInstall) {
+		logutil.ErrorCtx(ctx, "Installation to a workspace that is not allowed",
+			zap.String("team_id", resp.Team.ID),
+			zap.String("enterprise_id", resp.Enterprise.ID),
+			zap.Bool("enterprise_install", resp.IsEnterpriseInstall),
+			zap.String("installed_by", resp.AuthedUser.ID))
+		h.renderPage(w, http.StatusForbidden, "Installation not allowed", "The app cannot be installed to this workspace.")
+		return
+	}
+
+	inst := &installation.Installation{
+		TeamID:              resp.Team.ID,
+		TeamName:            resp.Team.Name,
+		EnterpriseID:        resp.Enterprise.ID,
+		EnterpriseName:      resp.Enterprise.Name,
+		IsEnterpriseInstall: resp.IsEnterpriseInstall,
+		BotToken:            resp.AccessToken,
+		BotUserID:           resp.BotUserID,
+		Scope:               resp.Scope,
+		InstalledBy:         resp.AuthedUser.ID,
+		InstalledAt:         h.now().UTC(),
+	}
+	if err := h.store.Save(ctx, inst); err != nil {
+		h.handleError(ctx, w, apperrors.New(http.StatusInternalServerError, "Failed to save installation", apperrors.CategoryServer, err))
+		return
+	}
+
+	name := inst.TeamName
+	if inst.IsEnterpriseInstall {
+		name = inst.EnterpriseName
+	}
+	logutil.InfoCtx(ctx, "App installed",
+		zap.String("team_id", inst.TeamID),
+		zap.String("enterprise_id", inst.EnterpriseID),
+		zap.Bool("enterprise_install", inst.IsEnterpriseInstall),
+		zap.String("installed_by", inst.InstalledBy))
+	h.renderPage(w, http.StatusOK, "App installed", "The app was installed to "+name+", you can close this page.")
+}
+
+// installationEvent is the part of the Events API payloads the install flow needs
+type installationEvent struct {
+	Type           string `json:"type"`
+	Challenge      string `json:"challenge"`
+	TeamID         string `json:"team_id"`
+	EnterpriseID   string `json:"enterprise_id"`
+	Authorizations []struct {
+		IsEnterpriseInstall bool `json:"is_enterprise_install"`
+	} `json:"authorizations"`
+	Event struct {
+		Type   string `json:"type"`
+		Tokens struct {
+			Bot []string `json:"bot"`
+		} `json:"tokens"`
+	} `json:"event"`
+}
+
+// HandleEvent answers the URL verification of the Event Subscriptions, and deletes the
+// installation when the app is uninstalled from a workspace or its bot token is revoked, so the
+// token is not used anymore
+func (h *InstallHandler) HandleEvent(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var payload installationEvent
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		logutil.ErrorCtx(ctx, "Invalid Slack event", zap.Error(err))
+		http.Error(w, "invalid event", http.StatusBadRequest)
+		return
+	}
+
+	if payload.Type == slackevents.URLVerification {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(payload.Challenge))
+		return
+	}
+	if payload.Type != slackevents.CallbackEvent {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	switch slackevents.EventsAPIType(payload.Event.Type) {
+	case slackevents.AppUninstalled:
+	case slackevents.TokensRevoked:
+		// Revoking the user tokens leaves the bot token working
+		if len(payload.Event.Tokens.Bot) == 0 {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	inst := &installation.Installation{
+		TeamID:              payload.TeamID,
+		EnterpriseID:        payload.EnterpriseID,
+		IsEnterpriseInstall: len(payload.Authorizations) > 0 && payload.Authorizations[0].IsEnterpriseInstall,
+	}
+	// Slack retries the event when it is not acknowledged
+	if err := h.store.Delete(ctx, inst.Key()); err != nil {
+		logutil.ErrorCtx(ctx, "Failed to delete installation", zap.String("event", payload.Event.Type), zap.Error(err))
+		http.Error(w, "failed to delete installation", http.StatusInternalServerError)
+		return
+	}
+	logutil.InfoCtx(ctx, "App uninstalled",
+		zap.String("event", payload.Event.Type),
+		zap.String("team_id", inst.TeamID),
+		zap.String("enterprise_id", inst.EnterpriseID),
+		zap.Bool("enterprise_install", inst.IsEnterpriseInstall))
+	w.WriteHeader(http.StatusOK)
+}
+
+// newState returns a state valid for oauthStateTTL, signed with the client secret so the
+// callback can check it without server-side storage
+func (h *InstallHandler) newState() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	payload := hex.EncodeToString(nonce) + "." + strconv.FormatInt(h.now().Add(oauthStateTTL).Unix(), 10)
+	return payload + "." + h.sign(payload), nil
+}
+
+func (h *InstallHandler) validState(state string) bool {
+	i := strings.LastIndex(state, ".")
+	if i < 0 {
+		return false
+	}
+	payload, signature := state[:i], state[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(h.sign(payload))) {
+		return false
+	}
+	_, expiry, ok := strings.Cut(payload, ".")
+	if !ok {
+		return false
+	}
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	return err == nil && h.now().Unix() <= expiresAt
+}
+
+func (h *InstallHandler) sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(h.config.ClientSecret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (h *InstallHandler) renderPage(w http.ResponseWriter, status int, title, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<!DOCTYPE html><html><head><title>%s</title></head><body><h1>%s</h1><p>%s</p></body></html>",
+		html.EscapeString(title), html.EscapeString(title), html.EscapeString(message))
+}
+
+func (h *InstallHandler) handleError(ctx context.Context, w http.ResponseWriter, err *apperrors.AppError) {
+	logutil.ErrorCtx(ctx, err.Message, zap.Error(err))
+	h.renderPage(w, err.Code, "Installation failed", err.UserMessage())
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/syltek/oncall-incident-reporter/internal/incident"
+	"github.com/syltek/oncall-incident-reporter/pkg/logutil"
+	"go.uber.org/zap"
+)
+
+// Sink names, as recorded in the incident deliveries
+const (
+	sinkSlack   = "slack"
+	sinkDatadog = "datadog"
+)
+
+// slackSink announces incidents in the configured Slack channel
+type slackSink struct {
+	h *SlackHandler
+}
+
+func (s *slackSink) Name() string {
+	return sinkSlack
+}
+
+func (s *slackSink) Deliver(ctx context.Context, inc *incident.Incident) (string, error) {
+	s.h.prepareIncident(ctx, inc)
+	// A failed delivery may have posted the announcement without getting the response
+	var usedSince time.Time
+	if delivery, ok := inc.Deliveries[sinkSlack]; ok && delivery.Attempts > 0 {
+		usedSince = inc.CreatedAt
+	}
+	return s.h.sendSlackMessage(ctx, inc.Reporter, inc.Announcement, refFromIncident(inc), inc.ViewID, usedSince)
+}
+
+// datadogSink creates a Datadog error event for incidents
+type datadogSink struct {
+	h *SlackHandler
+}
+
+func (s *datadogSink) Name() string {
+	return sinkDatadog
+}
+
+func (s *datadogSink) Deliver(ctx context.Context, inc *incident.Incident) (string, error) {
+	s.h.prepareIncident(ctx, inc)
+	return s.h.createDatadogEvent(ctx, inc.EventText, s.h.fieldsFor(sinkDatadog, inc.Fields))
+}
+
+// notifyDeliveryFailures tells the reporter, through a direct message, which sinks the incident
+// could not be delivered to. The incident is recorded and the deliveries will be retried.
+func (h *SlackHandler) notifyDeliveryFailures(ctx context.Context, inc *incident.Incident, failed []string) {
+	if inc.Reporter.ID == "" {
+		logutil.ErrorCtx(ctx, "Cannot notify reporter of failed deliveries, user ID is unknown",
+			zap.String("incident_id", inc.ID))
+		return
+	}
+
+	sort.Strings(failed)
+	var details strings.Builder
+	for _, name := range failed {
+		fmt.Fprintf(&details, "• *%s*: %s\n", name, inc.Deliveries[name].LastError)
+	}
+
+	text := fmt.Sprintf(":warning: Your incident *%s* was recorded, but it could not be delivered to: %s.\n%s"+
+		"Delivery will be retried automatically, there is no need to report the incident again.",
+		inc.ID, strings.Join(failed, ", "), details.String())
+
+	slackService, err := h.slackService.ForTeam(ctx, inc.Reporter.EnterpriseID, inc.Reporter.TeamID)
+	if err != nil {
+		logutil.ErrorCtx(ctx, "Cannot notify reporter of failed deliveries", zap.String("incident_id", inc.ID), zap.Error(err))
+		return
+	}
+
+	// Posting to a user ID sends a direct message from the app
+	if _, _, err := slackService.PostMessage(ctx, inc.Reporter.ID, slack.MsgOptionText(text, false)); err != nil {
+		logutil.ErrorCtx(ctx, "Failed to notify reporter of failed deliveries",
+			zap.String("incident_id", inc.ID),
+			zap.Error(err))
+	}
+}
@@ -8,12 +8,19 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
 	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
 	"github.com/slack-go/slack"
+	"github.com/syltek/oncall-incident-reporter/internal/audit"
+	"github.com/syltek/oncall-incident-reporter/internal/authorization"
 	"github.com/syltek/oncall-incident-reporter/internal/config"
+	"github.com/syltek/oncall-incident-reporter/internal/incident"
+	"github.com/syltek/oncall-incident-reporter/internal/metrics"
+	"github.com/syltek/oncall-incident-reporter/internal/pii"
 	"github.com/syltek/oncall-incident-reporter/internal/service"
 	"github.com/syltek/oncall-incident-reporter/internal/slackmodal"
 	apperrors "github.com/syltek/oncall-incident-reporter/pkg/errors"
@@ -25,82 +32,356 @@ import (
 type SlackHandler struct {
 	slackService   *service.SlackService
 	datadogService *service.DatadogService
-	config         *config.Config
+	metrics        metrics.Recorder
+	store          incident.Store
+	dispatcher     *incident.Dispatcher
+	audit          audit.Log
+	// settings is replaced when the configuration is reloaded
+	settings atomic.Pointer[handlerSettings]
+	// inflight holds the IDs of the views whose submission is being processed
+	inflight sync.Map
+	// deliveries tracks the incidents being delivered in the background
+	deliveries sync.WaitGroup
+	// queue, if set, delivers the reported incidents out of the process
+	queue DeliveryQueue
+}
+
+// DeliveryQueue hands a recorded incident over to be delivered out of the request that reported
+// it, e.g. by another Lambda invocation calling DeliverIncident
+type DeliveryQueue interface {
+	Enqueue(ctx context.Context, inc *incident.Incident) error
 }
 
 // NewSlackHandler creates a new SlackHandler instance.
-func NewSlackHandler(slackService *service.SlackService, datadogService *service.DatadogService, config *config.Config) *SlackHandler {
-	return &SlackHandler{
+func NewSlackHandler(slackService *service.SlackService, datadogService *service.DatadogService, recorder metrics.Recorder, store incident.Store, config *config.Config) *SlackHandler {
+	h := &SlackHandler{
 		slackService:   slackService,
 		datadogService: datadogService,
-		config:         config,
+		metrics:        recorder,
+		store:          store,
+	}
+	h.settings.Store(h.newSettings(config))
+
+	var sinks []incident.Sink
+	// Announce the incident in Slack if a channel is set
+	if config.HasAnnouncementChannel() {
+		sinks = append(sinks, &slackSink{h})
 	}
+	sinks = append(sinks, &datadogSink{h})
+
+	var maxAttempts int
+	if config.Incidents != nil {
+		maxAttempts = config.Incidents.MaxDeliveryAttempts
+	}
+	h.dispatcher = incident.NewDispatcher(store, recorder, maxAttempts, sinks...)
+
+	return h
+}
+
+// handlerSettings are the configuration of the handler and what is built from it
+type handlerSettings struct {
+	config     *config.Config
+	authorizer *authorization.Authorizer
+	scrubber   *pii.Scrubber
+}
+
+func (h *SlackHandler) newSettings(cfg *config.Config) *handlerSettings {
+	return &handlerSettings{
+		config:     cfg,
+		authorizer: authorization.NewAuthorizer(cfg.Authorization, workspaceUserGroups{h.slackService}),
+		scrubber:   pii.NewScrubber(cfg.Scrubbing),
+	}
+}
+
+// ApplyConfig replaces the configuration of the handler when it is reloaded: the modals, the
+// message format, the channels, the authorization rules, the scrubbing and the Datadog context
+// take effect for the next requests. The sinks are only set up at startup, a configuration
+// adding or removing the announcement channel is rejected.
+func (h *SlackHandler) ApplyConfig(next *config.Config) error {
+	if next.HasAnnouncementChannel() != h.config().HasAnnouncementChannel() {
+		return fmt.Errorf("announcement channel added or removed, a restart is needed")
+	}
+	h.settings.Store(h.newSettings(next))
+	return nil
+}
+
+func (h *SlackHandler) config() *config.Config {
+	return h.settings.Load().config
+}
+
+func (h *SlackHandler) authorizer() *authorization.Authorizer {
+	return h.settings.Load().authorizer
+}
+
+func (h *SlackHandler) scrubber() *pii.Scrubber {
+	return h.settings.Load().scrubber
+}
+
+// RetryFailedDeliveries retries delivering stored incidents to the sinks that failed
+func (h *SlackHandler) RetryFailedDeliveries(ctx context.Context) error {
+	return h.dispatcher.RetryFailed(ctx)
+}
+
+// WaitForDeliveries waits until the incidents reported so far are delivered to the sinks, or
+// their deliveries failed
+func (h *SlackHandler) WaitForDeliveries() {
+	h.deliveries.Wait()
+}
+
+// WithDeliveryQueue delivers the reported incidents through the queue instead of in the
+// background of the process, which may be frozen once the request is answered
+func (h *SlackHandler) WithDeliveryQueue(queue DeliveryQueue) *SlackHandler {
+	h.queue = queue
+	return h
 }
 
 // HandleCommand processes Slack commands to trigger modals.
 func (h *SlackHandler) HandleCommand(w http.ResponseWriter, r *http.Request) {
-	logutil.Debug("Processing Slack command")
+	ctx := r.Context()
+	logutil.DebugCtx(ctx, "Processing Slack command")
 	if err := r.ParseForm(); err != nil {
-		h.handleError(w, apperrors.New(http.StatusBadRequest, "Failed to parse form data", apperrors.CategoryClient, err))
+		h.commandError(ctx, w, apperrors.ErrInvalidPayload.WithMessage("Failed to parse form data").Wrap(err))
 		return
 	}
+	ctx = logutil.WithFields(ctx,
+		zap.String(logutil.FieldTriggerID, r.FormValue("trigger_id")),
+		zap.String(logutil.FieldTeamID, r.FormValue("team_id")),
+		zap.String(logutil.FieldUser, r.FormValue("user_id")))
+
 	// Debug the form
-	logutil.Debug("Form", zap.Any("form", r.Form))
+	logutil.DebugCtx(ctx, "Form", zap.Any("form", r.Form))
+
+	// A trigger ID can only be used once, a retried command already opened the modal or never will
+	if retryNum := r.Header.Get("X-Slack-Retry-Num"); retryNum != "" {
+		logutil.InfoCtx(ctx, "Ignoring retried Slack command",
+			zap.String("retry_num", retryNum),
+			zap.String("retry_reason", r.Header.Get("X-Slack-Retry-Reason")))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
 
-	modal := h.createModal(r.FormValue("trigger_id"))
-	if err := modal.SendModal(h.slackService); err != nil {
-		h.handleError(w, apperrors.New(http.StatusInternalServerError, "Failed to send modal to Slack", apperrors.CategoryServer, err))
+	if args := strings.Fields(r.FormValue("text")); len(args) > 0 && strings.EqualFold(args[0], subcommandAudit) {
+		h.handleAuditCommand(ctx, w, r, args[1:])
+		return
+	}
+
+	channelID := r.FormValue("channel_id")
+	teamID := r.FormValue("team_id")
+	enterpriseID := r.FormValue("enterprise_id")
+	decision := h.authorizer().Authorize(ctx, authorization.Request{
+		Action:       authorization.ActionOpenModal,
+		UserID:       r.FormValue("user_id"),
+		ChannelID:    channelID,
+		TeamID:       teamID,
+		EnterpriseID: enterpriseID,
+	})
+	if !decision.Allowed {
+		h.denyCommand(ctx, w, decision)
+		return
+	}
+
+	slackService, err := h.slackService.ForTeam(ctx, enterpriseID, teamID)
+	if err != nil {
+		h.commandError(ctx, w, apperrors.ErrNotInstalled.Wrap(err))
 		return
 	}
 
-	logutil.Info("Slack modal sent successfully", zap.String("trigger_id", r.FormValue("trigger_id")))
+	modal := h.createModal(ctx, r.FormValue("trigger_id"), teamID)
+	modal.SetPrivateMetadata(modalMetadata{ChannelID: channelID}.encode())
+	if err := modal.SendModal(ctx, slackService); err != nil {
+		h.metrics.Count(metrics.ModalOpenFailures, 1, "team_id:"+teamID)
+		h.commandError(ctx, w, apperrors.ErrUpstreamFailure.WithMessage("Failed to open the incident form").
+			WithHint("Run the command again.").Wrap(err))
+		return
+	}
+
+	logutil.InfoCtx(ctx, "Slack modal sent successfully")
 	w.WriteHeader(http.StatusOK)
 }
 
 // HandleModalSubmission processes modal submissions from Slack.
 func (h *SlackHandler) HandleModalSubmission(w http.ResponseWriter, r *http.Request) {
-	logutil.Debug("Processing modal submission")
+	ctx := r.Context()
+	logutil.DebugCtx(ctx, "Processing modal submission")
 	if err := r.ParseForm(); err != nil {
-		h.handleError(w, apperrors.New(http.StatusBadRequest, "Failed to parse form data", apperrors.CategoryClient, err))
+		h.handleError(ctx, w, apperrors.New(http.StatusBadRequest, "Failed to parse form data", apperrors.CategoryClient, err))
 		return
 	}
 
 	// Debug the form
-	logutil.Debug("Form", zap.Any("form", r.Form))
+	logutil.DebugCtx(ctx, "Form", zap.Any("form", r.Form))
+
+	if retryNum := r.Header.Get("X-Slack-Retry-Num"); retryNum != "" {
+		logutil.InfoCtx(ctx, "Slack retried the submission",
+			zap.String("retry_num", retryNum),
+			zap.String("retry_reason", r.Header.Get("X-Slack-Retry-Reason")))
+	}
+
+	// Slack sends every interaction to the same endpoint, dispatch the announcement buttons
+	// and the answer to the possible duplicate view
+	var interaction slack.InteractionCallback
+	if err := json.Unmarshal([]byte(r.FormValue("payload")), &interaction); err == nil {
+		ctx = logutil.WithFields(ctx,
+			zap.String(logutil.FieldTeamID, interaction.Team.ID),
+			zap.String(logutil.FieldUser, interaction.User.ID))
+		if interaction.View.ID != "" {
+			ctx = logutil.WithFields(ctx, zap.String(logutil.FieldViewID, interaction.View.ID))
+		}
+		switch {
+		case interaction.Type == slack.InteractionTypeBlockActions:
+			h.handleBlockActions(ctx, w, &interaction)
+			return
+		case interaction.Type == slack.InteractionTypeViewSubmission && interaction.View.CallbackID == duplicateCallbackID:
+			h.handleDuplicateDecision(ctx, w, &interaction)
+			return
+		}
+	}
 
-	modal, err := h.parseModalPayload(r.FormValue("payload"))
+	modal, err := h.parseModalPayload(ctx, r.FormValue("payload"))
 	if err != nil {
-		h.handleError(w, apperrors.New(http.StatusBadRequest, "Invalid modal payload", apperrors.CategoryClient, err))
+		h.handleError(ctx, w, apperrors.New(http.StatusBadRequest, "Invalid modal payload", apperrors.CategoryClient, err))
 		return
 	}
+	ctx = logutil.WithFields(ctx,
+		zap.String(logutil.FieldViewID, modal.GetViewID()),
+		zap.String(logutil.FieldTeamID, modal.GetTeamID()),
+		zap.String(logutil.FieldUser, modal.GetUserID()))
 
 	fieldData, err := modal.ParseAllFields()
 	if err != nil {
-		h.handleError(w, apperrors.New(http.StatusInternalServerError, "Failed to parse modal fields", apperrors.CategoryServer, err))
+		h.submissionError(ctx, w, err, config.SEVERITY_INPUT_KEY)
 		return
 	}
 
-	username := modal.GetUsername()
-	messageText := h.generateIncidentMessage(fieldData, username)
+	decision := h.authorizer().Authorize(ctx, authorization.Request{
+		Action:       authorization.ActionReport,
+		UserID:       modal.GetUserID(),
+		ChannelID:    decodeModalMetadata(ctx, modal.GetPrivateMetadata()).ChannelID,
+		TeamID:       modal.GetTeamID(),
+		EnterpriseID: modal.GetEnterpriseID(),
+		Severity:     fieldData[config.SEVERITY_INPUT_KEY],
+	})
+	if !decision.Allowed {
+		h.denySubmission(ctx, w, decision)
+		return
+	}
+
+	// Ignore submissions of a view that is already being processed or was already recorded
+	viewID := modal.GetViewID()
+	release, ok := h.claimView(ctx, viewID)
+	if !ok {
+		h.sendResponse(ctx, w, map[string]interface{}{"response_action": "clear"})
+		return
+	}
+	defer release()
 
-	// Send a message to Slack if the channel is set
-	if h.config.SlackConfig != nil && h.config.SlackConfig.ChannelID != "" {
-		err = h.sendSlackMessage(messageText)
-		if err != nil {
-			h.handleError(w, apperrors.New(http.StatusInternalServerError, "Failed to send message to Slack", apperrors.CategoryServer, err))
+	reporter := incident.Reporter{
+		ID:           modal.GetUserID(),
+		Username:     modal.GetUsername(),
+		TeamID:       modal.GetTeamID(),
+		EnterpriseID: modal.GetEnterpriseID(),
+	}
+
+	// Ask the reporter whether to join a similar open incident instead of opening a new one
+	if similar := h.findSimilarIncident(ctx, reporter, fieldData); similar != nil {
+		pending := pendingSubmission{ViewID: viewID, Reporter: reporter, Fields: fieldData, DuplicateOf: similar.ID}
+		if view, ok := duplicateView(pending, similar); ok {
+			logutil.InfoCtx(ctx, "Similar incident found, asking reporter",
+				zap.String("similar_incident_id", similar.ID))
+			h.sendResponse(ctx, w, map[string]interface{}{"response_action": "push", "view": view})
 			return
 		}
+		logutil.InfoCtx(ctx, "Similar incident found but the submission is too large to hold back, reporting it",
+			zap.String("similar_incident_id", similar.ID))
 	}
 
-	// Create a Datadog event
-	err = h.createDatadogEvent(messageText, fieldData)
-	if err != nil {
-		h.handleError(w, apperrors.New(http.StatusInternalServerError, "Failed to create Datadog event", apperrors.CategoryServer, err))
+	if err := h.reportIncident(ctx, viewID, reporter, fieldData); err != nil {
+		h.submissionError(ctx, w, err, config.SEVERITY_INPUT_KEY)
 		return
 	}
+	h.sendResponse(ctx, w, map[string]interface{}{"response_action": "clear"})
+	logutil.InfoCtx(ctx, "Modal submission processed successfully")
+}
+
+// reportIncident records a new incident and delivers it to the sinks through the delivery queue
+// or in the background, so Slack gets its answer before the Datadog context is looked up. Only failing to record the
+// incident fails the report, failed deliveries are retried.
+func (h *SlackHandler) reportIncident(ctx context.Context, viewID string, reporter incident.Reporter, fieldData map[string]string) error {
+	// Deliver the incident even if Slack stops waiting for the response, the trace is kept
+	ctx = context.WithoutCancel(ctx)
+	inc := incident.New(viewID, reporter, fieldData)
+	ctx = logutil.WithFields(ctx, zap.String(logutil.FieldIncidentID, inc.ID))
+
+	// Record the incident before delivering it, so a failing sink cannot lose it
+	if err := h.store.Create(ctx, inc); err != nil {
+		return apperrors.ErrStoreUnavailable.WithMessage("Failed to record the incident").Wrap(err)
+	}
+	h.recordAudit(ctx, reporter.ID, audit.ActionReported, nil, inc)
+	h.metrics.Count(metrics.IncidentsReported, 1, refFromIncident(inc).metricTags()...)
 
-	h.sendResponse(w, map[string]interface{}{"response_action": "clear"})
-	logutil.Info("Modal submission processed successfully")
+	if h.queue != nil {
+		err := h.queue.Enqueue(ctx, inc)
+		if err == nil {
+			return nil
+		}
+		logutil.ErrorCtx(ctx, "Failed to queue incident delivery, delivering it in the background", zap.Error(err))
+	}
+	h.deliveries.Add(1)
+	go func() {
+		defer h.deliveries.Done()
+		h.deliverIncident(ctx, inc)
+	}()
+	return nil
+}
+
+// DeliverIncident delivers an incident taken from the delivery queue. It is recorded again when
+// the store does not have it, e.g. a memory store of another Lambda execution environment, so
+// that its failed deliveries can be retried.
+func (h *SlackHandler) DeliverIncident(ctx context.Context, inc *incident.Incident) {
+	ctx = logutil.WithFields(ctx, zap.String(logutil.FieldIncidentID, inc.ID))
+	if _, err := h.store.Get(ctx, inc.ID); errors.Is(err, incident.ErrNotFound) {
+		if err := h.store.Create(ctx, inc); err != nil {
+			logutil.ErrorCtx(ctx, "Failed to record queued incident", zap.Error(err))
+		}
+	}
+	h.deliverIncident(ctx, inc)
+}
+
+// deliverIncident delivers a new incident to Slack and Datadog. Failed deliveries are retried
+// later and the reporter is told about them.
+func (h *SlackHandler) deliverIncident(ctx context.Context, inc *incident.Incident) {
+	if err := h.dispatcher.Dispatch(ctx, inc); err != nil {
+		logutil.ErrorCtx(ctx, "Failed to record incident deliveries", zap.Error(err))
+	}
+	if failed := inc.FailedSinks(); len(failed) > 0 {
+		h.notifyDeliveryFailures(ctx, inc, failed)
+	}
+}
+
+// prepareIncident sets the texts of the incident before its first delivery. They are kept with
+// the incident, so retried deliveries send the texts of the report.
+func (h *SlackHandler) prepareIncident(ctx context.Context, inc *incident.Incident) {
+	if inc.Announcement != "" || inc.EventText != "" {
+		return
+	}
+	inc.Announcement, inc.EventText = h.PreviewIncident(ctx, inc.Fields, inc.Reporter.Username)
+}
+
+// PreviewIncident returns the texts of an incident reported with the fields: the Slack
+// announcement and the Datadog event, with the Datadog context of the affected domain. Each sink
+// gets the text its scrubbing policy allows.
+func (h *SlackHandler) PreviewIncident(ctx context.Context, fields map[string]string, username string) (announcement, eventText string) {
+	// Look up dashboards, monitors and alerts for the affected domain
+	ddContext := h.buildDomainContext(datadog.NewDefaultContext(ctx), fields[config.DOMAINS_INPUT_KEY])
+	announcement = h.generateIncidentMessage(ctx, h.fieldsFor(sinkSlack, fields), username) + ddContext.slackText()
+	eventText = h.generateIncidentMessage(ctx, h.fieldsFor(sinkDatadog, fields), username) + ddContext.markdownText()
+	return announcement, eventText
+}
+
+// RenderModal returns the incident modal opened by the slash command run in a channel of the
+// workspace, as it is sent to Slack
+func (h *SlackHandler) RenderModal(teamID, channelID string) *slackmodal.Modal {
+	return h.createModal(context.Background(), "", teamID).SetPrivateMetadata(modalMetadata{ChannelID: channelID}.encode())
 }
 
 // Constants for Datadog event configuration
@@ -110,15 +391,15 @@ const (
 	textBlockEnd   = "\n %%%"
 )
 
-// createDatadogEvent creates a new event in Datadog with the given message
-func (h *SlackHandler) createDatadogEvent(messageText string, fieldData map[string]string) error {
-	ctx := datadog.NewDefaultContext(context.Background())
+// createDatadogEvent creates a new event in Datadog with the given message and returns its URL
+func (h *SlackHandler) createDatadogEvent(ctx context.Context, messageText string, fieldData map[string]string) (string, error) {
+	ctx = datadog.NewDefaultContext(ctx)
 
 	// Enrich the message with event time and event source
 	// If local is enabled, use local_execution as the event source
 	// Otherwise, use the AWS lambda function name
 	event_source := ""
-	if h.config.Local.Enabled {
+	if h.config().Local.Enabled {
 		event_source = "local_execution"
 	} else {
 		event_source = os.Getenv("AWS_LAMBDA_FUNCTION_NAME")
@@ -130,18 +411,19 @@ func (h *SlackHandler) createDatadogEvent(messageText string, fieldData map[stri
 
 	ddResponse, err := h.sendEventToDatadog(ctx, eventConfig)
 	if err != nil {
-		return fmt.Errorf("failed to send event to Datadog: %w", err)
+		return "", fmt.Errorf("failed to send event to Datadog: %w", err)
 	}
 
-	if err := h.validateResponse(ddResponse); err != nil {
-		return err
+	if err := h.validateResponse(ctx, ddResponse); err != nil {
+		return "", err
 	}
 
-	logutil.Info("Datadog event created successfully",
-		zap.String("url", *ddResponse.GetEvent().Url),
+	event := ddResponse.GetEvent()
+	logutil.InfoCtx(ctx, "Datadog event created successfully",
+		zap.String("url", event.GetUrl()),
 		zap.String("status", ddResponse.GetStatus()))
 
-	return nil
+	return event.GetUrl(), nil
 }
 
 // buildEventConfig creates the event configuration
@@ -160,24 +442,24 @@ func (h *SlackHandler) buildEventConfig(messageText string, fieldData map[string
 // buildEventTags returns the tags for the event
 func (h *SlackHandler) buildEventTags(fieldData map[string]string) []string {
 	return []string{
-		"env:" + h.config.Metadata.Environment,
-		"team:" + h.config.Metadata.Team,
-		"service:" + h.config.Metadata.Service,
-		"severity:" + fieldData["input_severity"],
-		"domain:" + fieldData["input_domains_affected"],
+		"env:" + h.config().Metadata.Environment,
+		"team:" + h.config().Metadata.Team,
+		"service:" + h.config().Metadata.Service,
+		"severity:" + fieldData[config.SEVERITY_INPUT_KEY],
+		"domain:" + fieldData[config.DOMAINS_INPUT_KEY],
 	}
 }
 
 // getAggregationKey returns the aggregation key for the event
 func (h *SlackHandler) getAggregationKey() string {
-	return h.config.Metadata.Environment + "-" + h.config.Metadata.Service
+	return h.config().Metadata.Environment + "-" + h.config().Metadata.Service
 }
 
 // sendEventToDatadog sends the event to Datadog
 func (h *SlackHandler) sendEventToDatadog(ctx context.Context, req datadogV1.EventCreateRequest) (*datadogV1.EventCreateResponse, error) {
 	ddResponse, err := h.datadogService.CreateEvent(ctx, req)
 	if err != nil {
-		logutil.Error("Failed to create Datadog event", zap.Error(err))
+		logutil.ErrorCtx(ctx, "Failed to create Datadog event", zap.Error(err))
 		return nil, err
 	}
 
@@ -185,10 +467,10 @@ func (h *SlackHandler) sendEventToDatadog(ctx context.Context, req datadogV1.Eve
 }
 
 // validateResponse validates the Datadog API response
-func (h *SlackHandler) validateResponse(response *datadogV1.EventCreateResponse) error {
+func (h *SlackHandler) validateResponse(ctx context.Context, response *datadogV1.EventCreateResponse) error {
 	status := response.GetStatus()
 
-	logutil.Debug("Datadog response status", zap.String("status", status))
+	logutil.DebugCtx(ctx, "Datadog response status", zap.String("status", status))
 
 	if status != "ok" {
 		return fmt.Errorf("failed to create Datadog event: status not expected: %s", status)
@@ -197,34 +479,64 @@ func (h *SlackHandler) validateResponse(response *datadogV1.EventCreateResponse)
 	return nil
 }
 
-func (h *SlackHandler) handleError(w http.ResponseWriter, err error) {
-	var appErr *apperrors.AppError
-	if !errors.As(err, &appErr) {
-		appErr = apperrors.New(http.StatusInternalServerError, "Internal server error", apperrors.CategoryServer, err)
+func (h *SlackHandler) handleError(ctx context.Context, w http.ResponseWriter, err error) {
+	appErr := apperrors.As(err)
+	logError(ctx, appErr)
+	http.Error(w, appErr.UserMessage(), appErr.Code)
+}
+
+// commandError answers a slash command with the error in a message only the user sees. Slack
+// shows any other status than 200 as a generic failure.
+func (h *SlackHandler) commandError(ctx context.Context, w http.ResponseWriter, err error) {
+	appErr := apperrors.As(err)
+	logError(ctx, appErr)
+	h.sendResponse(ctx, w, map[string]interface{}{
+		"response_type": slack.ResponseTypeEphemeral,
+		"text":          ":warning: " + appErr.UserMessage(),
+	})
+}
+
+// submissionError keeps the modal open and shows the error under the input it is about, or
+// under blockID if it is not about an input. Slack closes the modal with a generic failure on
+// any other status than 200.
+func (h *SlackHandler) submissionError(ctx context.Context, w http.ResponseWriter, err error, blockID string) {
+	appErr := apperrors.As(err)
+	logError(ctx, appErr)
+	if appErr.Field != "" {
+		blockID = appErr.Field
 	}
+	h.sendResponse(ctx, w, map[string]interface{}{
+		"response_action": "errors",
+		"errors":          map[string]string{blockID: appErr.UserMessage()},
+	})
+}
 
-	logutil.Error(appErr.Message, zap.Error(appErr))
-	http.Error(w, appErr.Message, appErr.Code)
+func logError(ctx context.Context, appErr *apperrors.AppError) {
+	logutil.ErrorCtx(ctx, appErr.Message,
+		zap.Error(appErr),
+		zap.String("error_code", appErr.ErrorCode()),
+		zap.Bool("retryable", appErr.Retryable))
 }
 
-func (h *SlackHandler) createModal(triggerID string) *slackmodal.Modal {
-	logutil.Debug("Creating modal", zap.String("trigger_id", triggerID))
-	modal := slackmodal.NewModal(h.config.Modal.Title, triggerID)
+func (h *SlackHandler) createModal(ctx context.Context, triggerID, teamID string) *slackmodal.Modal {
+	logutil.DebugCtx(ctx, "Creating modal", zap.String("trigger_id", triggerID), zap.String("team_id", teamID))
+	modalConfig := h.config().ModalFor(teamID)
+	modal := slackmodal.NewModal(modalConfig.Title, triggerID)
 
-	for _, input := range h.config.Modal.Inputs {
+	for _, input := range modalConfig.Inputs {
 		switch input.Type {
-		case "select":
-			options := h.getSelectOptions(input.Options)
+		case config.INPUT_TYPE_SELECT:
+			options := h.getSelectOptions(ctx, input.Options)
 			modal.AddSelectInput(input.Key, input.Label, input.Placeholder, options)
-		case "text":
+		case config.INPUT_TYPE_TEXT:
 			modal.AddTextInput(input.Key, input.Label, input.Placeholder, false)
 		}
 	}
 	return modal
 }
 
-func (h *SlackHandler) getSelectOptions(options []config.Option) []string {
-	logutil.Debug("Getting select options", zap.Int("option_count", len(options)))
+func (h *SlackHandler) getSelectOptions(ctx context.Context, options []config.Option) []string {
+	logutil.DebugCtx(ctx, "Getting select options", zap.Int("option_count", len(options)))
 	result := make([]string, len(options))
 	for i, option := range options {
 		result[i] = option.Text
@@ -232,8 +544,8 @@ func (h *SlackHandler) getSelectOptions(options []config.Option) []string {
 	return result
 }
 
-func (h *SlackHandler) parseModalPayload(payload string) (*slackmodal.Modal, error) {
-	logutil.Debug("Parsing modal payload")
+func (h *SlackHandler) parseModalPayload(ctx context.Context, payload string) (*slackmodal.Modal, error) {
+	logutil.DebugCtx(ctx, "Parsing modal payload")
 	modal := &slackmodal.Modal{}
 	if err := modal.ParsePayload(payload); err != nil {
 		return nil, err
@@ -241,41 +553,69 @@ func (h *SlackHandler) parseModalPayload(payload string) (*slackmodal.Modal, err
 	return modal, nil
 }
 
-func (h *SlackHandler) generateIncidentMessage(fields map[string]string, username string) string {
-	logutil.Debug("Generating incident message",
-		zap.String("username", username),
-		zap.Any("fields", fields))
-	replacements := map[string]string{
-		"{{severity}}":         fields["input_severity"],
-		"{{domains_affected}}": fields["input_domains_affected"],
-		"{{description}}":      fields["input_incident_description"],
-		"{{username}}":         username,
+// fieldsFor returns the incident fields as the sink may receive them, with the personal data
+// masked if the scrubbing policy of the sink says so
+func (h *SlackHandler) fieldsFor(sink string, fields map[string]string) map[string]string {
+	if h.config().Scrubbing.PolicyFor(sink) != config.SCRUB_POLICY_SCRUBBED {
+		return fields
 	}
+	return h.scrubber().ScrubFields(fields)
+}
 
-	message := h.config.SlackConfig.MessageFormat
-	for placeholder, value := range replacements {
-		message = strings.ReplaceAll(message, placeholder, value)
+func (h *SlackHandler) generateIncidentMessage(ctx context.Context, fields map[string]string, username string) string {
+	logutil.DebugCtx(ctx, "Generating incident message",
+		zap.String("username", username),
+		zap.Any("fields", fields))
+	message := h.config().SlackConfig.MessageFormat
+	for placeholder, key := range config.MESSAGE_PLACEHOLDERS {
+		value := fields[key]
+		if key == "" {
+			value = username
+		}
+		message = strings.ReplaceAll(message, "{{"+placeholder+"}}", value)
 	}
 	return message
 }
 
-func (h *SlackHandler) sendSlackMessage(messageText string) error {
-	logutil.Debug("Sending Slack message",
-		zap.String("channel_id", h.config.SlackConfig.ChannelID))
+// sendSlackMessage announces the incident and returns the message timestamp. The view ID is used
+// as idempotency key so a retried post, or a retried submission of the same view, does not
+// announce the incident twice. usedSince, unless zero, is when an earlier delivery may have
+// posted the announcement.
+func (h *SlackHandler) sendSlackMessage(ctx context.Context, reporter incident.Reporter, messageText string, ref incidentRef, viewID string, usedSince time.Time) (string, error) {
+	channelID := h.config().ChannelIDFor(reporter.TeamID)
+	if channelID == "" {
+		return "", fmt.Errorf("no announcement channel configured for team %s", reporter.TeamID)
+	}
 
-	_, _, err := h.slackService.PostMessage(h.config.SlackConfig.ChannelID, slack.MsgOptionText(messageText, false))
+	logutil.DebugCtx(ctx, "Sending Slack message",
+		zap.String("channel_id", channelID),
+		zap.String("team_id", reporter.TeamID))
 
+	slackService, err := h.slackService.ForTeam(ctx, reporter.EnterpriseID, reporter.TeamID)
 	if err != nil {
-		return fmt.Errorf("failed to send message to Slack: %w", err)
+		return "", err
 	}
 
-	return nil
+	var idempotencyKey string
+	if viewID != "" {
+		idempotencyKey = "view:" + viewID
+	}
+
+	_, timestamp, err := slackService.PostMessageIdempotent(ctx, idempotencyKey, usedSince, channelID,
+		slack.MsgOptionText(messageText, false),
+		slack.MsgOptionBlocks(incidentMessageBlocks(messageText, ref)...))
+
+	if err != nil {
+		return "", fmt.Errorf("failed to send message to Slack: %w", err)
+	}
+
+	return timestamp, nil
 }
 
-func (h *SlackHandler) sendResponse(w http.ResponseWriter, response interface{}) {
-	logutil.Debug("Sending response")
+func (h *SlackHandler) sendResponse(ctx context.Context, w http.ResponseWriter, response interface{}) {
+	logutil.DebugCtx(ctx, "Sending response")
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		h.handleError(w, apperrors.New(http.StatusInternalServerError, "Failed to encode response", apperrors.CategoryServer, err))
+		h.handleError(ctx, w, apperrors.New(http.StatusInternalServerError, "Failed to encode response", apperrors.CategoryServer, err))
 	}
 }
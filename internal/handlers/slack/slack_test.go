@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+	"github.com/syltek/oncall-incident-reporter/internal/incident"
+	"github.com/syltek/oncall-incident-reporter/internal/metrics"
+	"github.com/syltek/oncall-incident-reporter/internal/service"
+	"github.com/syltek/oncall-incident-reporter/internal/service/fake"
+	"github.com/syltek/oncall-incident-reporter/internal/slackmodal"
+	apperrors "github.com/syltek/oncall-incident-reporter/pkg/errors"
+)
+
+func decodeResponse(t *testing.T, rec *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	return body
+}
+
+func TestCommandErrorIsEphemeral(t *testing.T) {
+	h := &SlackHandler{}
+	rec := httptest.NewRecorder()
+	h.commandError(context.Background(), rec, apperrors.ErrNotInstalled.Wrap(errors.New("installation not found")))
+
+	body := decodeResponse(t, rec)
+	assert.Equal(t, "ephemeral", body["response_type"])
+	assert.Equal(t, ":warning: The app is not installed to this workspace. Ask a workspace admin to install the app again.", body["text"])
+}
+
+func TestSubmissionErrorKeepsModalOpen(t *testing.T) {
+	h := &SlackHandler{}
+
+	tests := []struct {
+		name      string
+		err       error
+		wantBlock string
+		wantText  string
+	}{
+		{
+			name:      "field error",
+			err:       apperrors.ErrInvalidField.WithMessage("Field input_title not found").WithField("input_title"),
+			wantBlock: "input_title",
+			wantText:  "Field input_title not found",
+		},
+		{
+			name:      "retryable error",
+			err:       apperrors.ErrStoreUnavailable.WithMessage("Failed to record the incident").Wrap(errors.New("disk full")),
+			wantBlock: config.SEVERITY_INPUT_KEY,
+			wantText:  "Failed to record the incident. Please try again in a moment.",
+		},
+		{
+			name:      "unexpected error",
+			err:       errors.New("boom"),
+			wantBlock: config.SEVERITY_INPUT_KEY,
+			wantText:  "Internal server error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.submissionError(context.Background(), rec, tt.err, config.SEVERITY_INPUT_KEY)
+
+			body := decodeResponse(t, rec)
+			assert.Equal(t, "errors", body["response_action"])
+			assert.Equal(t, map[string]interface{}{tt.wantBlock: tt.wantText}, body["errors"])
+		})
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	newConfig := func(channelID, format string) *config.Config {
+		return &config.Config{
+			SlackConfig: &config.SlackConfig{ChannelID: channelID, MessageFormat: format},
+			Modal:       &config.Modal{Title: "Report incident"},
+		}
+	}
+	h := NewSlackHandler(nil, nil, metrics.NewNoopRecorder(), incident.NewMemoryStore(), newConfig("C1", "Incident: {}"))
+
+	require.NoError(t, h.ApplyConfig(newConfig("C2", "New incident: {}")))
+	assert.Equal(t, "C2", h.config().ChannelIDFor("T1"))
+	assert.Equal(t, "New incident: {}", h.config().SlackConfig.MessageFormat)
+
+	// The Slack sink is set up at startup only
+	assert.ErrorContains(t, h.ApplyConfig(newConfig("", "New incident: {}")), "restart")
+	assert.Equal(t, "C2", h.config().ChannelIDFor("T1"))
+}
+
+func TestSubmissionWithFakeClients(t *testing.T) {
+	cfg := &config.Config{
+		Metadata: &config.Metadata{},
+		Local:    &config.Local{},
+		SlackConfig: &config.SlackConfig{
+			ChannelID:     "C1",
+			MessageFormat: "{{severity}} incident reported by {{username}}: {{description}}",
+		},
+		Modal: &config.Modal{
+			Title: "Report incident",
+			Inputs: []config.Input{
+				{Key: config.SEVERITY_INPUT_KEY, Label: "Severity", Type: config.INPUT_TYPE_SELECT, Options: []config.Option{{Text: "High"}, {Text: "Low"}}},
+				{Key: config.DESCRIPTION_INPUT_KEY, Label: "Description", Type: config.INPUT_TYPE_TEXT},
+			},
+		},
+	}
+	slackClient, datadogClient := fake.NewSlackClient(), fake.NewDatadogClient()
+	store := incident.NewMemoryStore()
+	h := NewSlackHandler(
+		service.NewSlackService(slackClient, service.NoRetryPolicy()),
+		service.NewDatadogService(datadogClient, datadogClient, service.NoRetryPolicy()),
+		metrics.NewNoopRecorder(), store, cfg)
+
+	submitter := slackmodal.Submitter{UserID: "U1", Username: "jane", TeamID: "T1"}
+	_, err := h.RenderModal("T1", "").SubmissionPayload(submitter, "V1", map[string]string{config.SEVERITY_INPUT_KEY: "Critical"})
+	assert.ErrorContains(t, err, "not an option")
+
+	payload, err := h.RenderModal("T1", "").SubmissionPayload(submitter, "V1", map[string]string{
+		config.SEVERITY_INPUT_KEY:    "High",
+		config.DESCRIPTION_INPUT_KEY: "Checkout is down",
+	})
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/incident/submit", strings.NewReader(url.Values{"payload": {payload}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	h.HandleModalSubmission(rec, req)
+	assert.Equal(t, "clear", decodeResponse(t, rec)["response_action"])
+	h.WaitForDeliveries()
+
+	messages := slackClient.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "C1", messages[0].Channel)
+	assert.Contains(t, messages[0].Text, "High incident reported by jane: Checkout is down")
+	require.Len(t, datadogClient.Events(), 1)
+
+	inc, err := store.FindByViewID(context.Background(), "V1")
+	require.NoError(t, err)
+	assert.Empty(t, inc.FailedSinks())
+
+	resolved, err := h.ResolveIncident(context.Background(), inc.ID, "U2")
+	require.NoError(t, err)
+	assert.True(t, resolved.IsResolved())
+	assert.Equal(t, "U2", resolved.ResolvedBy)
+}
+
+func TestSubmissionIsAnsweredBeforeDelivery(t *testing.T) {
+	cfg := &config.Config{
+		Metadata:    &config.Metadata{},
+		Local:       &config.Local{},
+		SlackConfig: &config.SlackConfig{ChannelID: "C1", MessageFormat: "{{severity}} incident in {{domains_affected}}"},
+		Modal: &config.Modal{
+			Title: "Report incident",
+			Inputs: []config.Input{
+				{Key: config.SEVERITY_INPUT_KEY, Label: "Severity", Type: config.INPUT_TYPE_SELECT, Options: []config.Option{{Text: "High"}}},
+				{Key: config.DOMAINS_INPUT_KEY, Label: "Domain", Type: config.INPUT_TYPE_SELECT, Options: []config.Option{{Text: "payments"}}},
+			},
+		},
+		Datadog: &config.Datadog{Domains: map[string]config.DomainContext{"payments": {MonitorTag: "domain:payments"}}},
+	}
+	slackClient, datadogClient := fake.NewSlackClient(), fake.NewDatadogClient()
+	store := incident.NewMemoryStore()
+	// The Datadog context of the domain is slow to look up
+	h := NewSlackHandler(
+		service.NewSlackService(slackClient, service.NoRetryPolicy()),
+		service.NewDatadogService(datadogClient, &monitorsAPI{delay: 200 * time.Millisecond}, service.NoRetryPolicy()),
+		metrics.NewNoopRecorder(), store, cfg)
+
+	submitter := slackmodal.Submitter{UserID: "U1", Username: "jane", TeamID: "T1"}
+	payload, err := h.RenderModal("T1", "").SubmissionPayload(submitter, "V1", map[string]string{
+		config.SEVERITY_INPUT_KEY: "High",
+		config.DOMAINS_INPUT_KEY:  "payments",
+	})
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/incident/submit", strings.NewReader(url.Values{"payload": {payload}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	h.HandleModalSubmission(rec, req)
+
+	// The incident is recorded when Slack gets its answer, and delivered afterwards
+	assert.Equal(t, "clear", decodeResponse(t, rec)["response_action"])
+	_, err = store.FindByViewID(context.Background(), "V1")
+	require.NoError(t, err)
+	assert.Empty(t, slackClient.Messages())
+
+	h.WaitForDeliveries()
+	messages := slackClient.Messages()
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0].Text, "High incident in payments")
+	require.Len(t, datadogClient.Events(), 1)
+
+	// The texts are kept with the incident for the retried deliveries
+	inc, err := store.FindByViewID(context.Background(), "V1")
+	require.NoError(t, err)
+	assert.Equal(t, messages[0].Text, inc.Announcement)
+	assert.NotEmpty(t, inc.EventText)
+}
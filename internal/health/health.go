@@ -0,0 +1,150 @@
+// Package health serves the liveness, readiness and version endpoints used by load balancers,
+// container orchestrators and humans to check a deployment.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/syltek/oncall-incident-reporter/pkg/buildinfo"
+	"github.com/syltek/oncall-incident-reporter/pkg/logutil"
+	"go.uber.org/zap"
+)
+
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+const (
+	// DEFAULT_CHECK_TIMEOUT bounds the time all the readiness checks may take together
+	DEFAULT_CHECK_TIMEOUT = 5 * time.Second
+	// DEFAULT_CHECK_CACHE_TTL is how long the outcome of the readiness checks is reused, so
+	// frequent probes do not call Slack and Datadog every time
+	DEFAULT_CHECK_CACHE_TTL = 5 * time.Second
+)
+
+// Check reports whether a dependency is usable
+type Check func(ctx context.Context) error
+
+// CheckResult is the outcome of a readiness check. The endpoint is not authenticated, the error
+// of a failed check is only logged.
+type CheckResult struct {
+	Status string `json:"status"`
+}
+
+// Response is the body of the health and readiness endpoints
+type Response struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Handler serves the health endpoints
+type Handler struct {
+	checks   map[string]Check
+	timeout  time.Duration
+	cacheTTL time.Duration
+	now      func() time.Time
+
+	// mu guards the last outcome of the checks, and is held while they run
+	mu        sync.Mutex
+	results   map[string]CheckResult
+	checkedAt time.Time
+}
+
+// NewHandler creates a Handler without readiness checks
+func NewHandler() *Handler {
+	return &Handler{
+		checks:   make(map[string]Check),
+		timeout:  DEFAULT_CHECK_TIMEOUT,
+		cacheTTL: DEFAULT_CHECK_CACHE_TTL,
+		now:      time.Now,
+	}
+}
+
+// AddCheck adds a dependency the application is not ready without
+func (h *Handler) AddCheck(name string, check Check) *Handler {
+	h.checks[name] = check
+	return h
+}
+
+// HandleHealth reports that the process is up. It checks no dependency, a failing dependency
+// must not get the process restarted.
+func (h *Handler) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(r.Context(), w, http.StatusOK, Response{Status: StatusOK})
+}
+
+// HandleReady runs the readiness checks concurrently and responds 503 if any fails. The outcome
+// is reused for the probes received within the cache TTL.
+func (h *Handler) HandleReady(w http.ResponseWriter, r *http.Request) {
+	resp := Response{Status: StatusOK, Checks: h.lastResults(r.Context())}
+	status := http.StatusOK
+	for _, result := range resp.Checks {
+		if result.Status != StatusOK {
+			resp.Status = StatusError
+			status = http.StatusServiceUnavailable
+		}
+	}
+	writeJSON(r.Context(), w, status, resp)
+}
+
+// HandleVersion responds with the build information of the binary
+func (h *Handler) HandleVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(r.Context(), w, http.StatusOK, buildinfo.Get())
+}
+
+// lastResults returns the outcome of the checks, running them again if it is older than the
+// cache TTL. Concurrent probes wait for the same run.
+func (h *Handler) lastResults(ctx context.Context) map[string]CheckResult {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.results != nil && h.now().Sub(h.checkedAt) < h.cacheTTL {
+		return h.results
+	}
+
+	// A probe giving up must not fail the checks shared with the others
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), h.timeout)
+	defer cancel()
+	h.results = h.runChecks(ctx)
+	h.checkedAt = h.now()
+	return h.results
+}
+
+func (h *Handler) runChecks(ctx context.Context) map[string]CheckResult {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]CheckResult, len(h.checks))
+	for name, check := range h.checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			start := time.Now()
+			err := check(ctx)
+			result := CheckResult{Status: StatusOK}
+			if err != nil {
+				logutil.ErrorCtx(ctx, "Readiness check failed",
+					zap.String("check", name),
+					zap.Duration("duration", time.Since(start)),
+					zap.Error(err))
+				result.Status = StatusError
+			}
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+	return results
+}
+
+func writeJSON(ctx context.Context, w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logutil.ErrorCtx(ctx, "Failed to write health response", zap.Error(err))
+	}
+}
@@ -0,0 +1,118 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleReady(t *testing.T) {
+	tests := []struct {
+		name       string
+		checks     map[string]Check
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "no checks",
+			wantStatus: http.StatusOK,
+			wantBody:   StatusOK,
+		},
+		{
+			name: "all checks pass",
+			checks: map[string]Check{
+				"slack":   func(context.Context) error { return nil },
+				"datadog": func(context.Context) error { return nil },
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   StatusOK,
+		},
+		{
+			name: "a check fails",
+			checks: map[string]Check{
+				"slack":   func(context.Context) error { return nil },
+				"datadog": func(context.Context) error { return errors.New("forbidden") },
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   StatusError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler()
+			for name, check := range tt.checks {
+				h.AddCheck(name, check)
+			}
+
+			rec := httptest.NewRecorder()
+			h.HandleReady(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			var resp Response
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.wantBody, resp.Status)
+			assert.Len(t, resp.Checks, len(tt.checks))
+			if tt.wantStatus != http.StatusOK {
+				assert.Equal(t, StatusError, resp.Checks["datadog"].Status)
+				assert.Equal(t, StatusOK, resp.Checks["slack"].Status)
+				assert.NotContains(t, rec.Body.String(), "forbidden", "errors are not exposed")
+			}
+		})
+	}
+}
+
+func TestHandleReadyTimesOut(t *testing.T) {
+	h := NewHandler().AddCheck("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	h.timeout = 0
+
+	rec := httptest.NewRecorder()
+	h.HandleReady(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestHandleReadyReusesResults(t *testing.T) {
+	var calls int
+	h := NewHandler().AddCheck("slack", func(context.Context) error {
+		calls++
+		return nil
+	})
+	now := time.Unix(1_700_000_000, 0)
+	h.now = func() time.Time { return now }
+
+	ready := func() int {
+		rec := httptest.NewRecorder()
+		h.HandleReady(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, ready())
+	now = now.Add(time.Second)
+	assert.Equal(t, http.StatusOK, ready())
+	assert.Equal(t, 1, calls, "checked again before the cache TTL")
+
+	now = now.Add(DEFAULT_CHECK_CACHE_TTL)
+	assert.Equal(t, http.StatusOK, ready())
+	assert.Equal(t, 2, calls)
+}
+
+func TestHandleVersion(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewHandler().HandleVersion(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var info map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &info))
+	assert.NotEmpty(t, info["version"])
+	assert.NotEmpty(t, info["go_version"])
+}
@@ -0,0 +1,196 @@
+package incident
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/syltek/oncall-incident-reporter/internal/metrics"
+	"github.com/syltek/oncall-incident-reporter/internal/tracing"
+	"github.com/syltek/oncall-incident-reporter/pkg/logutil"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// retryGracePeriod is the minimum age of an incident before its deliveries are retried
+const retryGracePeriod = time.Minute
+
+// deliveryLease is how long a claimed delivery is left to the process that claimed it. It
+// outlasts the retries of a sink; a delivery still in progress after it, e.g. because the
+// process was stopped, is claimed again.
+const deliveryLease = 5 * time.Minute
+
+// errDeliveryClaimed is returned when a delivery is done, out of attempts or in progress elsewhere
+var errDeliveryClaimed = errors.New("delivery already done or in progress")
+
+// Sink is a destination an incident is delivered to
+type Sink interface {
+	// Name identifies the sink in the incident deliveries, e.g. "slack"
+	Name() string
+	// Deliver sends the incident and returns a reference to what was created
+	Deliver(ctx context.Context, incident *Incident) (string, error)
+}
+
+// Dispatcher delivers incidents to every sink, recording the outcome of each delivery in the
+// store so that one failing sink neither loses the incident nor blocks the others.
+type Dispatcher struct {
+	store       Store
+	sinks       []Sink
+	metrics     metrics.Recorder
+	maxAttempts int
+}
+
+// NewDispatcher creates a Dispatcher. Deliveries that failed maxAttempts times are not retried.
+func NewDispatcher(store Store, recorder metrics.Recorder, maxAttempts int, sinks ...Sink) *Dispatcher {
+	return &Dispatcher{
+		store:       store,
+		sinks:       sinks,
+		metrics:     recorder,
+		maxAttempts: max(maxAttempts, 1),
+	}
+}
+
+// Dispatch delivers the incident to every sink it has not been delivered to yet. Each delivery is
+// claimed in the store before the sink is called, so the processes delivering or retrying the
+// same incident at the same time do not deliver it twice. The outcome of each delivery is
+// recorded in incident.Deliveries and persisted, leaving the other changes of the stored
+// incident as they are. The returned error is only about the store, sink failures are reported
+// through the deliveries.
+func (d *Dispatcher) Dispatch(ctx context.Context, incident *Incident) error {
+	ctx = logutil.WithFields(ctx, zap.String(logutil.FieldIncidentID, incident.ID))
+	var errs []error
+	for _, sink := range d.sinks {
+		delivery, err := d.claim(ctx, incident, sink.Name())
+		if errors.Is(err, errDeliveryClaimed) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("claim %s delivery of %s: %w", sink.Name(), incident.ID, err))
+			continue
+		}
+
+		start := time.Now()
+		sinkCtx, span := tracing.Start(ctx, "sink."+sink.Name(),
+			attribute.String("incident.id", incident.ID),
+			attribute.Int("sink.attempt", delivery.Attempts+1))
+		reference, err := sink.Deliver(sinkCtx, incident)
+		tracing.End(span, err)
+		outcome := "success"
+		if err != nil {
+			outcome = "failure"
+		}
+		metrics.Duration(d.metrics, metrics.SinkDuration, time.Since(start), "sink:"+sink.Name(), "outcome:"+outcome)
+		delivery.Attempts++
+		delivery.UpdatedAt = time.Now().UTC()
+		if err != nil {
+			delivery.Status = DeliveryFailed
+			delivery.LastError = err.Error()
+			d.metrics.Count(metrics.SinkFailures, 1, "sink:"+sink.Name())
+			logutil.ErrorCtx(ctx, "Failed to deliver incident",
+				zap.String("sink", sink.Name()),
+				zap.Int("attempts", delivery.Attempts),
+				zap.Error(err))
+		} else {
+			delivery.Status = DeliveryDelivered
+			delivery.Reference = reference
+			delivery.LastError = ""
+			logutil.InfoCtx(ctx, "Incident delivered",
+				zap.String("sink", sink.Name()),
+				zap.String("reference", reference))
+		}
+
+		// Only the delivery is stored, the incident may have been acknowledged or joined meanwhile
+		if _, err := d.store.Modify(ctx, incident.ID, func(stored *Incident) error {
+			recordDelivery(stored, incident, sink.Name())
+			return nil
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("record %s delivery of %s: %w", sink.Name(), incident.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// claim marks the delivery of the incident to the sink in progress in the store, unless it is
+// delivered, out of attempts or claimed by another process within its lease. The delivery of
+// the incident is replaced by the stored one, with the attempts made so far.
+func (d *Dispatcher) claim(ctx context.Context, incident *Incident, sink string) (*Delivery, error) {
+	now := time.Now().UTC()
+	stored, err := d.store.Modify(ctx, incident.ID, func(stored *Incident) error {
+		delivery, ok := stored.Deliveries[sink]
+		if !ok {
+			delivery = &Delivery{Status: DeliveryPending}
+			stored.Deliveries[sink] = delivery
+		}
+		if delivery.Status == DeliveryDelivered || delivery.Attempts >= d.maxAttempts ||
+			delivery.Status == DeliveryInProgress && now.Sub(delivery.UpdatedAt) < deliveryLease {
+			return errDeliveryClaimed
+		}
+		delivery.Status = DeliveryInProgress
+		delivery.UpdatedAt = now
+		return nil
+	})
+	if stored != nil {
+		if delivery, ok := stored.Deliveries[sink]; ok {
+			clone := *delivery
+			incident.Deliveries[sink] = &clone
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return incident.Deliveries[sink], nil
+}
+
+// recordDelivery copies the delivery of the incident to the sink to the stored incident, with the
+// texts it was delivered with unless the stored incident has them already
+func recordDelivery(stored, incident *Incident, sink string) {
+	delivery := *incident.Deliveries[sink]
+	stored.Deliveries[sink] = &delivery
+	if stored.Announcement == "" && stored.EventText == "" {
+		stored.Announcement, stored.EventText = incident.Announcement, incident.EventText
+	}
+}
+
+// RetryFailed retries the failed deliveries of every stored incident that has attempts left
+func (d *Dispatcher) RetryFailed(ctx context.Context) error {
+	incidents, err := d.store.List(ctx)
+	if err != nil {
+		return fmt.Errorf("list incidents: %w", err)
+	}
+
+	var errs []error
+	for _, incident := range incidents {
+		if !d.hasRetryableDeliveries(incident) {
+			continue
+		}
+
+		logutil.InfoCtx(ctx, "Retrying failed incident deliveries",
+			zap.String("incident_id", incident.ID),
+			zap.Strings("sinks", incident.FailedSinks()))
+
+		if err := d.Dispatch(ctx, incident); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// hasRetryableDeliveries reports whether a sink has not received the incident yet and has
+// attempts left. Recent incidents are skipped as they may still be dispatched by the request
+// that reported them.
+func (d *Dispatcher) hasRetryableDeliveries(incident *Incident) bool {
+	if time.Since(incident.CreatedAt) < retryGracePeriod {
+		return false
+	}
+	for _, sink := range d.sinks {
+		delivery, ok := incident.Deliveries[sink.Name()]
+		if !ok {
+			return true
+		}
+		if delivery.Status != DeliveryDelivered && delivery.Attempts < d.maxAttempts {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package incident
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syltek/oncall-incident-reporter/internal/metrics"
+)
+
+type fakeSink struct {
+	name  string
+	err   error
+	calls int
+}
+
+func (s *fakeSink) Name() string { return s.name }
+
+func (s *fakeSink) Deliver(context.Context, *Incident) (string, error) {
+	s.calls++
+	if s.err != nil {
+		return "", s.err
+	}
+	return s.name + "-ref", nil
+}
+
+func TestDispatcherPartialFailure(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	recorder := metrics.NewMemoryRecorder()
+	slackSink := &fakeSink{name: "slack"}
+	datadogSink := &fakeSink{name: "datadog", err: errors.New("datadog is down")}
+	dispatcher := NewDispatcher(store, recorder, 2, slackSink, datadogSink)
+
+	inc := New("V123", Reporter{ID: "U123", Username: "jane"}, map[string]string{"input_severity": "High"})
+	require.NoError(t, store.Create(ctx, inc))
+	require.NoError(t, dispatcher.Dispatch(ctx, inc))
+
+	assert.Equal(t, []string{"datadog"}, inc.FailedSinks())
+	assert.Equal(t, float64(1), recorder.Sum(metrics.SinkFailures, "sink:datadog"))
+	assert.Len(t, recorder.Find(metrics.SinkDuration, "sink:datadog", "outcome:failure"), 1)
+	assert.Len(t, recorder.Find(metrics.SinkDuration, "sink:slack", "outcome:success"), 1)
+
+	stored, err := store.Get(ctx, inc.ID)
+	require.NoError(t, err)
+	assert.Equal(t, DeliveryDelivered, stored.Deliveries["slack"].Status)
+	assert.Equal(t, "slack-ref", stored.Deliveries["slack"].Reference)
+	assert.Equal(t, DeliveryFailed, stored.Deliveries["datadog"].Status)
+	assert.Equal(t, "datadog is down", stored.Deliveries["datadog"].LastError)
+
+	// Recent incidents are left to the request that reported them
+	require.NoError(t, dispatcher.RetryFailed(ctx))
+	assert.Equal(t, 1, datadogSink.calls)
+
+	stored.CreatedAt = time.Now().Add(-2 * retryGracePeriod)
+	require.NoError(t, store.Update(ctx, stored))
+
+	// Only the failed sink is retried, and no more than the maximum attempts
+	datadogSink.err = nil
+	require.NoError(t, dispatcher.RetryFailed(ctx))
+	require.NoError(t, dispatcher.RetryFailed(ctx))
+	assert.Equal(t, 1, slackSink.calls)
+	assert.Equal(t, 2, datadogSink.calls)
+
+	stored, err = store.Get(ctx, inc.ID)
+	require.NoError(t, err)
+	assert.Empty(t, stored.FailedSinks())
+	assert.Equal(t, 2, stored.Deliveries["datadog"].Attempts)
+}
+
+// actingSink acknowledges the stored incident while it is being delivered
+type actingSink struct {
+	store Store
+}
+
+func (s *actingSink) Name() string { return "slack" }
+
+func (s *actingSink) Deliver(ctx context.Context, incident *Incident) (string, error) {
+	incident.Announcement = "announcement"
+	_, err := s.store.Modify(ctx, incident.ID, func(stored *Incident) error {
+		stored.AcknowledgedBy = "U2"
+		return nil
+	})
+	return "1700000000.000001", err
+}
+
+func TestDispatchKeepsConcurrentChanges(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	dispatcher := NewDispatcher(store, metrics.NewMemoryRecorder(), 1, &actingSink{store})
+
+	inc := New("V123", Reporter{ID: "U123"}, nil)
+	require.NoError(t, store.Create(ctx, inc))
+	require.NoError(t, dispatcher.Dispatch(ctx, inc))
+
+	stored, err := store.Get(ctx, inc.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "U2", stored.AcknowledgedBy)
+	assert.Equal(t, DeliveryDelivered, stored.Deliveries["slack"].Status)
+	assert.Equal(t, "announcement", stored.Announcement)
+}
+
+// slowSink counts its deliveries, which take a while
+type slowSink struct {
+	calls atomic.Int32
+}
+
+func (s *slowSink) Name() string { return "datadog" }
+
+func (s *slowSink) Deliver(context.Context, *Incident) (string, error) {
+	s.calls.Add(1)
+	time.Sleep(10 * time.Millisecond)
+	return "event", nil
+}
+
+func TestDispatchClaimsDeliveries(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	sink := &slowSink{}
+	dispatcher := NewDispatcher(store, metrics.NewMemoryRecorder(), 3, sink)
+
+	inc := New("V123", Reporter{ID: "U123"}, nil)
+	require.NoError(t, store.Create(ctx, inc))
+
+	// The request delivering the incident and the retries race, the sink is called once
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, dispatcher.Dispatch(ctx, inc.Clone()))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), sink.calls.Load())
+
+	// A delivery in progress elsewhere is left alone until its lease expires
+	claimed := New("V456", Reporter{ID: "U123"}, nil)
+	claimed.CreatedAt = time.Now().Add(-2 * retryGracePeriod)
+	claimed.Deliveries["datadog"] = &Delivery{Status: DeliveryInProgress, Attempts: 1, UpdatedAt: time.Now().UTC()}
+	require.NoError(t, store.Create(ctx, claimed))
+	require.NoError(t, dispatcher.RetryFailed(ctx))
+	assert.Equal(t, int32(1), sink.calls.Load())
+
+	claimed.Deliveries["datadog"].UpdatedAt = time.Now().Add(-2 * deliveryLease)
+	require.NoError(t, store.Update(ctx, claimed))
+	require.NoError(t, dispatcher.RetryFailed(ctx))
+	assert.Equal(t, int32(2), sink.calls.Load())
+
+	stored, err := store.Get(ctx, claimed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, DeliveryDelivered, stored.Deliveries["datadog"].Status)
+	assert.Equal(t, 2, stored.Deliveries["datadog"].Attempts)
+}
@@ -0,0 +1,151 @@
+package incident
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+
+	"github.com/syltek/oncall-incident-reporter/pkg/fileutil"
+)
+
+// FileStore keeps incidents in a single JSON file. Every write reads the file and rewrites it
+// atomically under a lock, so the file can be shared by several processes, e.g. the Lambda
+// execution environments mounting the same EFS file system. This is adequate for the low
+// volume of incidents.
+type FileStore struct {
+	path string
+	// mu serializes the writes of the process, the file lock those of the other processes
+	mu sync.Mutex
+}
+
+// NewFileStore creates a FileStore backed by the file at path, checking the incidents it holds
+// can be read
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path}
+	if _, err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) Create(_ context.Context, incident *Incident) error {
+	return s.write(func(incidents map[string]*Incident) error {
+		incidents[incident.ID] = incident.Clone()
+		return nil
+	})
+}
+
+func (s *FileStore) Get(_ context.Context, id string) (*Incident, error) {
+	incidents, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	incident, ok := incidents[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return incident, nil
+}
+
+func (s *FileStore) Update(_ context.Context, incident *Incident) error {
+	return s.write(func(incidents map[string]*Incident) error {
+		if _, ok := incidents[incident.ID]; !ok {
+			return ErrNotFound
+		}
+		incidents[incident.ID] = incident.Clone()
+		return nil
+	})
+}
+
+func (s *FileStore) Modify(_ context.Context, id string, fn func(incident *Incident) error) (*Incident, error) {
+	var incident *Incident
+	err := s.write(func(incidents map[string]*Incident) error {
+		stored, ok := incidents[id]
+		if !ok {
+			return ErrNotFound
+		}
+		incident = stored.Clone()
+		if err := fn(incident); err != nil {
+			incident = stored
+			return err
+		}
+		incidents[id] = incident.Clone()
+		return nil
+	})
+	return incident, err
+}
+
+func (s *FileStore) List(_ context.Context) ([]*Incident, error) {
+	incidents, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return sortedClones(incidents), nil
+}
+
+func (s *FileStore) FindByViewID(_ context.Context, viewID string) (*Incident, error) {
+	incidents, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return findByViewID(incidents, viewID)
+}
+
+// load reads the incidents of the file. It needs no lock, the file is only ever replaced whole.
+func (s *FileStore) load() (map[string]*Incident, error) {
+	incidents := make(map[string]*Incident)
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return incidents, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read incident store: %w", err)
+	}
+
+	var list []*Incident
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("decode incident store: %w", err)
+	}
+	for _, incident := range list {
+		incidents[incident.ID] = incident
+	}
+	return incidents, nil
+}
+
+// write changes the incidents of the file with fn and persists them, holding the file lock so
+// that no other process writes in between. Nothing is written when fn fails.
+func (s *FileStore) write(fn func(incidents map[string]*Incident) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := fileutil.Lock(s.path + ".lock")
+	if err != nil {
+		return fmt.Errorf("lock incident store: %w", err)
+	}
+	defer unlock()
+
+	incidents, err := s.load()
+	if err != nil {
+		return err
+	}
+	if err := fn(incidents); err != nil {
+		return err
+	}
+	return s.persist(incidents)
+}
+
+// persist replaces the store file with the incidents
+func (s *FileStore) persist(incidents map[string]*Incident) error {
+	data, err := json.MarshalIndent(sortedClones(incidents), "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode incident store: %w", err)
+	}
+
+	if err := fileutil.WriteFile(s.path, data); err != nil {
+		return fmt.Errorf("write incident store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package incident
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStoreSharedBetweenProcesses(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "incidents.json")
+	first, err := NewFileStore(path)
+	require.NoError(t, err)
+	second, err := NewFileStore(path)
+	require.NoError(t, err)
+
+	inc := New("V1", Reporter{ID: "U1"}, map[string]string{"input_severity": "High"})
+	require.NoError(t, first.Create(ctx, inc))
+
+	// Each store sees the writes of the other
+	stored, err := second.Get(ctx, inc.ID)
+	require.NoError(t, err)
+	stored.AcknowledgedBy = "U2"
+	require.NoError(t, second.Update(ctx, stored))
+
+	other := New("V2", Reporter{ID: "U3"}, nil)
+	require.NoError(t, first.Create(ctx, other))
+
+	incidents, err := second.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, incidents, 2)
+	found, err := first.FindByViewID(ctx, "V1")
+	require.NoError(t, err)
+	assert.Equal(t, "U2", found.AcknowledgedBy)
+
+	assert.ErrorIs(t, first.Update(ctx, New("V3", Reporter{}, nil)), ErrNotFound)
+}
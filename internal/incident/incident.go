@@ -0,0 +1,144 @@
+// Package incident provides the incident model, its storage and the delivery of incidents
+// to the configured sinks (Slack announcement, Datadog event).
+package incident
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DeliveryStatus is the outcome of delivering an incident to a sink
+type DeliveryStatus string
+
+const (
+	DeliveryPending DeliveryStatus = "pending"
+	// DeliveryInProgress is a delivery claimed by a process, see Dispatcher
+	DeliveryInProgress DeliveryStatus = "in_progress"
+	DeliveryDelivered  DeliveryStatus = "delivered"
+	DeliveryFailed     DeliveryStatus = "failed"
+)
+
+// Incident is a reported incident and the state of its delivery to every sink
+type Incident struct {
+	ID       string            `json:"id"`
+	ViewID   string            `json:"view_id,omitempty"`
+	Reporter Reporter          `json:"reporter"`
+	Fields   map[string]string `json:"fields"`
+	// Announcement is the Slack mrkdwn text of the incident announcement
+	Announcement string `json:"announcement"`
+	// EventText is the markdown text of the Datadog event
+	EventText  string               `json:"event_text"`
+	CreatedAt  time.Time            `json:"created_at"`
+	Deliveries map[string]*Delivery `json:"deliveries"`
+	// AlsoReportedBy lists the users who joined the incident instead of reporting a duplicate
+	AlsoReportedBy []Reporter `json:"also_reported_by,omitempty"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy string     `json:"acknowledged_by,omitempty"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+	ResolvedBy     string     `json:"resolved_by,omitempty"`
+}
+
+// Reporter identifies the Slack user who reported the incident, and their workspace
+type Reporter struct {
+	ID           string `json:"id"`
+	Username     string `json:"username"`
+	TeamID       string `json:"team_id,omitempty"`
+	EnterpriseID string `json:"enterprise_id,omitempty"`
+}
+
+// Delivery is the state of the delivery of an incident to a single sink
+type Delivery struct {
+	Status   DeliveryStatus `json:"status"`
+	Attempts int            `json:"attempts"`
+	// Reference identifies what the sink created, e.g. the Slack message timestamp or Datadog event URL
+	Reference string    `json:"reference,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// New creates an incident with a new ID
+func New(viewID string, reporter Reporter, fields map[string]string) *Incident {
+	return &Incident{
+		ID:         NewID(),
+		ViewID:     viewID,
+		Reporter:   reporter,
+		Fields:     fields,
+		CreatedAt:  time.Now().UTC(),
+		Deliveries: make(map[string]*Delivery),
+	}
+}
+
+// NewID generates a short random incident ID such as INC-1a2b3c4d
+func NewID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return "INC-" + hex.EncodeToString(b)
+}
+
+// IsResolved reports whether the incident has been resolved
+func (i *Incident) IsResolved() bool {
+	return i.ResolvedAt != nil
+}
+
+// FailedSinks returns the names of the sinks whose delivery failed
+func (i *Incident) FailedSinks() []string {
+	var failed []string
+	for name, delivery := range i.Deliveries {
+		if delivery.Status == DeliveryFailed {
+			failed = append(failed, name)
+		}
+	}
+	return failed
+}
+
+// AuditState returns the state of the incident recorded in the audit trail, as flat values:
+// the reported fields, prefixed with "fields.", and who acknowledged, resolved or joined it
+func (i *Incident) AuditState() map[string]string {
+	state := make(map[string]string, len(i.Fields)+5)
+	for key, value := range i.Fields {
+		state["fields."+key] = value
+	}
+	if i.AcknowledgedAt != nil {
+		state["acknowledged_at"] = i.AcknowledgedAt.Format(time.RFC3339)
+		state["acknowledged_by"] = i.AcknowledgedBy
+	}
+	if i.ResolvedAt != nil {
+		state["resolved_at"] = i.ResolvedAt.Format(time.RFC3339)
+		state["resolved_by"] = i.ResolvedBy
+	}
+	if len(i.AlsoReportedBy) > 0 {
+		ids := make([]string, len(i.AlsoReportedBy))
+		for n, reporter := range i.AlsoReportedBy {
+			ids[n] = reporter.ID
+		}
+		state["also_reported_by"] = strings.Join(ids, ",")
+	}
+	return state
+}
+
+// Clone returns a deep copy of the incident
+func (i *Incident) Clone() *Incident {
+	clone := *i
+	clone.Fields = make(map[string]string, len(i.Fields))
+	for k, v := range i.Fields {
+		clone.Fields[k] = v
+	}
+	clone.Deliveries = make(map[string]*Delivery, len(i.Deliveries))
+	for k, v := range i.Deliveries {
+		delivery := *v
+		clone.Deliveries[k] = &delivery
+	}
+	clone.AlsoReportedBy = slices.Clone(i.AlsoReportedBy)
+	if i.AcknowledgedAt != nil {
+		acknowledgedAt := *i.AcknowledgedAt
+		clone.AcknowledgedAt = &acknowledgedAt
+	}
+	if i.ResolvedAt != nil {
+		resolvedAt := *i.ResolvedAt
+		clone.ResolvedAt = &resolvedAt
+	}
+	return &clone
+}
@@ -0,0 +1,118 @@
+package incident
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+)
+
+// ErrNotFound is returned when an incident does not exist in the store
+var ErrNotFound = errors.New("incident not found")
+
+// Store persists incidents
+type Store interface {
+	// Create stores a new incident
+	Create(ctx context.Context, incident *Incident) error
+	// Get returns the incident with the given ID or ErrNotFound
+	Get(ctx context.Context, id string) (*Incident, error)
+	// Update replaces a stored incident
+	Update(ctx context.Context, incident *Incident) error
+	// Modify changes the stored incident with fn, atomically: no other change of the incident is
+	// stored in between. Nothing is stored when fn fails, its error is returned with the
+	// incident as stored. Otherwise the changed incident is returned.
+	Modify(ctx context.Context, id string, fn func(incident *Incident) error) (*Incident, error)
+	// List returns all incidents, most recent first
+	List(ctx context.Context) ([]*Incident, error)
+	// FindByViewID returns the incident reported through the given Slack view or ErrNotFound
+	FindByViewID(ctx context.Context, viewID string) (*Incident, error)
+}
+
+// MemoryStore keeps incidents in memory. Incidents are lost when the process exits.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	incidents map[string]*Incident
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{incidents: make(map[string]*Incident)}
+}
+
+func (s *MemoryStore) Create(_ context.Context, incident *Incident) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.incidents[incident.ID] = incident.Clone()
+	return nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, id string) (*Incident, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	incident, ok := s.incidents[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return incident.Clone(), nil
+}
+
+func (s *MemoryStore) Update(_ context.Context, incident *Incident) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.incidents[incident.ID]; !ok {
+		return ErrNotFound
+	}
+	s.incidents[incident.ID] = incident.Clone()
+	return nil
+}
+
+func (s *MemoryStore) Modify(_ context.Context, id string, fn func(incident *Incident) error) (*Incident, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.incidents[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	incident := stored.Clone()
+	if err := fn(incident); err != nil {
+		return stored.Clone(), err
+	}
+	s.incidents[id] = incident.Clone()
+	return incident, nil
+}
+
+func (s *MemoryStore) List(_ context.Context) ([]*Incident, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return sortedClones(s.incidents), nil
+}
+
+func (s *MemoryStore) FindByViewID(_ context.Context, viewID string) (*Incident, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return findByViewID(s.incidents, viewID)
+}
+
+func findByViewID(incidents map[string]*Incident, viewID string) (*Incident, error) {
+	if viewID == "" {
+		return nil, ErrNotFound
+	}
+	for _, incident := range incidents {
+		if incident.ViewID == viewID {
+			return incident.Clone(), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// sortedClones returns copies of the incidents sorted by creation time, most recent first
+func sortedClones(incidents map[string]*Incident) []*Incident {
+	list := make([]*Incident, 0, len(incidents))
+	for _, incident := range incidents {
+		list = append(list, incident.Clone())
+	}
+	slices.SortFunc(list, func(a, b *Incident) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return list
+}
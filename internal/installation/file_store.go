@@ -0,0 +1,116 @@
+package installation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+
+	"github.com/syltek/oncall-incident-reporter/pkg/fileutil"
+)
+
+// FileStore keeps installations in a single JSON file. Every access reads the file, and every
+// write rewrites it atomically under a lock, so the file can be shared by several processes,
+// e.g. the Lambda execution environments mounting the same EFS file system. The file holds bot
+// tokens and is created readable by its owner only.
+type FileStore struct {
+	path string
+	// mu serializes the writes of the process, the file lock those of the other processes
+	mu sync.Mutex
+}
+
+// NewFileStore creates a FileStore backed by the file at path, checking the installations it
+// holds can be read
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path}
+	if _, err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) Save(_ context.Context, installation *Installation) error {
+	return s.write(func(installations map[string]*Installation) {
+		clone := *installation
+		installations[installation.Key()] = &clone
+	})
+}
+
+func (s *FileStore) Find(_ context.Context, enterpriseID, teamID string) (*Installation, error) {
+	installations, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return find(installations, enterpriseID, teamID)
+}
+
+func (s *FileStore) List(_ context.Context) ([]*Installation, error) {
+	installations, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return sortedClones(installations), nil
+}
+
+func (s *FileStore) Delete(_ context.Context, key string) error {
+	return s.write(func(installations map[string]*Installation) {
+		delete(installations, key)
+	})
+}
+
+// load reads the installations of the file. It needs no lock, the file is only ever replaced
+// whole.
+func (s *FileStore) load() (map[string]*Installation, error) {
+	installations := make(map[string]*Installation)
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return installations, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read installation store: %w", err)
+	}
+
+	var list []*Installation
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("decode installation store: %w", err)
+	}
+	for _, installation := range list {
+		installations[installation.Key()] = installation
+	}
+	return installations, nil
+}
+
+// write changes the installations of the file with fn and persists them, holding the file lock
+// so that no other process writes in between
+func (s *FileStore) write(fn func(installations map[string]*Installation)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := fileutil.Lock(s.path + ".lock")
+	if err != nil {
+		return fmt.Errorf("lock installation store: %w", err)
+	}
+	defer unlock()
+
+	installations, err := s.load()
+	if err != nil {
+		return err
+	}
+	fn(installations)
+	return s.persist(installations)
+}
+
+// persist replaces the store file with the installations
+func (s *FileStore) persist(installations map[string]*Installation) error {
+	data, err := json.MarshalIndent(sortedClones(installations), "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode installation store: %w", err)
+	}
+
+	if err := fileutil.WriteFile(s.path, data); err != nil {
+		return fmt.Errorf("write installation store: %w", err)
+	}
+	return nil
+}
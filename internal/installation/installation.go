@@ -0,0 +1,136 @@
+// Package installation provides the Slack workspaces the app was installed to through the
+// OAuth v2 flow, and the storage of their bot tokens.
+package installation
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when the app is not installed to a workspace
+var ErrNotFound = errors.New("installation not found")
+
+// Installation is the installation of the app to a Slack workspace, or to a whole Enterprise
+// Grid organization
+type Installation struct {
+	TeamID         string `json:"team_id,omitempty"`
+	TeamName       string `json:"team_name,omitempty"`
+	EnterpriseID   string `json:"enterprise_id,omitempty"`
+	EnterpriseName string `json:"enterprise_name,omitempty"`
+	// IsEnterpriseInstall is set when the app was installed to the whole organization, the
+	// installation then applies to every workspace of the enterprise
+	IsEnterpriseInstall bool      `json:"is_enterprise_install,omitempty"`
+	BotToken            string    `json:"bot_token"`
+	BotUserID           string    `json:"bot_user_id,omitempty"`
+	Scope               string    `json:"scope,omitempty"`
+	InstalledBy         string    `json:"installed_by,omitempty"`
+	InstalledAt         time.Time `json:"installed_at"`
+}
+
+// Key identifies the installation in a store
+func (i *Installation) Key() string {
+	if i.IsEnterpriseInstall {
+		return enterpriseKey(i.EnterpriseID)
+	}
+	return teamKey(i.TeamID)
+}
+
+// Keys returns the keys of the installations that may serve a workspace, in the order they are
+// looked up
+func Keys(enterpriseID, teamID string) []string {
+	var keys []string
+	if teamID != "" {
+		keys = append(keys, teamKey(teamID))
+	}
+	if enterpriseID != "" {
+		keys = append(keys, enterpriseKey(enterpriseID))
+	}
+	return keys
+}
+
+func teamKey(teamID string) string {
+	return "team:" + teamID
+}
+
+func enterpriseKey(enterpriseID string) string {
+	return "enterprise:" + enterpriseID
+}
+
+// Store persists installations, keyed by team or enterprise ID
+type Store interface {
+	// Save creates or replaces the installation, e.g. when the app is reinstalled with new scopes
+	Save(ctx context.Context, installation *Installation) error
+	// Find returns the installation serving a workspace: the installation to the workspace
+	// itself, or else the installation to its enterprise. It returns ErrNotFound otherwise.
+	Find(ctx context.Context, enterpriseID, teamID string) (*Installation, error)
+	// List returns all installations
+	List(ctx context.Context) ([]*Installation, error)
+	// Delete removes the installation with the given key, e.g. when the app is uninstalled.
+	// Deleting a missing installation is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// MemoryStore keeps installations in memory. Installations are lost when the process exits.
+type MemoryStore struct {
+	mu            sync.RWMutex
+	installations map[string]*Installation
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{installations: make(map[string]*Installation)}
+}
+
+func (s *MemoryStore) Save(_ context.Context, installation *Installation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clone := *installation
+	s.installations[installation.Key()] = &clone
+	return nil
+}
+
+func (s *MemoryStore) Find(_ context.Context, enterpriseID, teamID string) (*Installation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return find(s.installations, enterpriseID, teamID)
+}
+
+func (s *MemoryStore) List(_ context.Context) ([]*Installation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return sortedClones(s.installations), nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.installations, key)
+	return nil
+}
+
+func find(installations map[string]*Installation, enterpriseID, teamID string) (*Installation, error) {
+	for _, key := range Keys(enterpriseID, teamID) {
+		if installation, ok := installations[key]; ok {
+			clone := *installation
+			return &clone, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// sortedClones returns copies of the installations sorted by key
+func sortedClones(installations map[string]*Installation) []*Installation {
+	list := make([]*Installation, 0, len(installations))
+	for _, installation := range installations {
+		clone := *installation
+		list = append(list, &clone)
+	}
+	slices.SortFunc(list, func(a, b *Installation) int {
+		return strings.Compare(a.Key(), b.Key())
+	})
+	return list
+}
@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+)
+
+type IDatadogMetricsAPI interface {
+	SubmitMetrics(ctx context.Context, body datadogV2.MetricPayload, o ...datadogV2.SubmitMetricsOptionalParameters) (datadogV2.IntakePayloadAccepted, *http.Response, error)
+}
+
+type IDatadogDistributionsAPI interface {
+	SubmitDistributionPoints(ctx context.Context, body datadogV1.DistributionPointsPayload, o ...datadogV1.SubmitDistributionPointsOptionalParameters) (datadogV1.IntakePayloadAccepted, *http.Response, error)
+}
+
+// series identifies a metric by name and its sorted tags
+type series struct {
+	name string
+	tags string
+}
+
+func newSeries(name string, tags []string) series {
+	sorted := slices.Clone(tags)
+	slices.Sort(sorted)
+	return series{name: name, tags: strings.Join(sorted, ",")}
+}
+
+func (s series) tagList() []string {
+	if s.tags == "" {
+		return nil
+	}
+	return strings.Split(s.tags, ",")
+}
+
+// DatadogRecorder buffers metrics in memory and submits them to the Datadog Metrics API on Flush.
+// Counts are aggregated per series between flushes, distributions keep every sample.
+type DatadogRecorder struct {
+	metrics       IDatadogMetricsAPI
+	distributions IDatadogDistributionsAPI
+	prefix        string
+	tags          []string
+
+	mu            sync.Mutex
+	counts        map[series]int64
+	samples       map[series][]float64
+	lastFlushedAt time.Time
+}
+
+// NewDatadogRecorder creates a DatadogRecorder. Every metric name is prefixed with prefix and
+// every series carries the given global tags.
+func NewDatadogRecorder(metrics IDatadogMetricsAPI, distributions IDatadogDistributionsAPI, prefix string, tags ...string) *DatadogRecorder {
+	return &DatadogRecorder{
+		metrics:       metrics,
+		distributions: distributions,
+		prefix:        strings.TrimSuffix(prefix, "."),
+		tags:          tags,
+		counts:        make(map[series]int64),
+		samples:       make(map[series][]float64),
+		lastFlushedAt: time.Now(),
+	}
+}
+
+func (d *DatadogRecorder) Count(name string, value int64, tags ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.counts[d.series(name, tags)] += value
+}
+
+func (d *DatadogRecorder) Distribution(name string, value float64, tags ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.series(name, tags)
+	d.samples[s] = append(d.samples[s], value)
+}
+
+// Flush submits the buffered metrics. The buffer is emptied even if the submission fails,
+// so a Datadog outage cannot grow it without bound.
+func (d *DatadogRecorder) Flush(ctx context.Context) error {
+	d.mu.Lock()
+	counts, samples := d.counts, d.samples
+	interval := int64(time.Since(d.lastFlushedAt).Seconds())
+	d.counts = make(map[series]int64)
+	d.samples = make(map[series][]float64)
+	d.lastFlushedAt = time.Now()
+	d.mu.Unlock()
+
+	if len(counts) == 0 && len(samples) == 0 {
+		return nil
+	}
+
+	ctx = datadog.NewDefaultContext(ctx)
+	now := time.Now().Unix()
+	var errs []error
+
+	if len(counts) > 0 {
+		if _, _, err := d.metrics.SubmitMetrics(ctx, countsPayload(counts, now, max(interval, 1))); err != nil {
+			errs = append(errs, fmt.Errorf("failed to submit counts: %w", err))
+		}
+	}
+
+	if len(samples) > 0 {
+		if _, _, err := d.distributions.SubmitDistributionPoints(ctx, distributionsPayload(samples, now)); err != nil {
+			errs = append(errs, fmt.Errorf("failed to submit distribution points: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (d *DatadogRecorder) series(name string, tags []string) series {
+	return newSeries(d.prefix+"."+name, append(slices.Clone(d.tags), tags...))
+}
+
+func countsPayload(counts map[series]int64, timestamp, interval int64) datadogV2.MetricPayload {
+	payload := datadogV2.MetricPayload{}
+	for s, value := range counts {
+		point := datadogV2.MetricPoint{
+			Timestamp: datadog.PtrInt64(timestamp),
+			Value:     datadog.PtrFloat64(float64(value)),
+		}
+		payload.Series = append(payload.Series, datadogV2.MetricSeries{
+			Metric:   s.name,
+			Type:     datadogV2.METRICINTAKETYPE_COUNT.Ptr(),
+			Interval: datadog.PtrInt64(interval),
+			Points:   []datadogV2.MetricPoint{point},
+			Tags:     s.tagList(),
+		})
+	}
+	return payload
+}
+
+func distributionsPayload(samples map[series][]float64, timestamp int64) datadogV1.DistributionPointsPayload {
+	payload := datadogV1.DistributionPointsPayload{}
+	ts := float64(timestamp)
+	for s, values := range samples {
+		point := []datadogV1.DistributionPointItem{
+			datadogV1.DistributionPointTimestampAsDistributionPointItem(&ts),
+			datadogV1.DistributionPointDataAsDistributionPointItem(&values),
+		}
+		series := datadogV1.NewDistributionPointsSeries(s.name, [][]datadogV1.DistributionPointItem{point})
+		series.Tags = s.tagList()
+		payload.Series = append(payload.Series, *series)
+	}
+	return payload
+}
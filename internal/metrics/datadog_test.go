@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeMetricsAPI struct {
+	counts        []datadogV2.MetricPayload
+	distributions []datadogV1.DistributionPointsPayload
+}
+
+func (f *fakeMetricsAPI) SubmitMetrics(_ context.Context, body datadogV2.MetricPayload, _ ...datadogV2.SubmitMetricsOptionalParameters) (datadogV2.IntakePayloadAccepted, *http.Response, error) {
+	f.counts = append(f.counts, body)
+	return datadogV2.IntakePayloadAccepted{}, nil, nil
+}
+
+func (f *fakeMetricsAPI) SubmitDistributionPoints(_ context.Context, body datadogV1.DistributionPointsPayload, _ ...datadogV1.SubmitDistributionPointsOptionalParameters) (datadogV1.IntakePayloadAccepted, *http.Response, error) {
+	f.distributions = append(f.distributions, body)
+	return datadogV1.IntakePayloadAccepted{}, nil, nil
+}
+
+func TestDatadogRecorderFlush(t *testing.T) {
+	api := &fakeMetricsAPI{}
+	recorder := NewDatadogRecorder(api, api, "reporter.", "env:test")
+
+	recorder.Count(IncidentsReported, 1, "severity:High", "domain:Payments")
+	recorder.Count(IncidentsReported, 1, "domain:Payments", "severity:High")
+	recorder.Count(IncidentsReported, 1, "severity:Low", "domain:Payments")
+	recorder.Distribution(IncidentTimeToAck, 30, "severity:High")
+	recorder.Distribution(IncidentTimeToAck, 90, "severity:High")
+
+	require.NoError(t, recorder.Flush(context.Background()))
+
+	require.Len(t, api.counts, 1)
+	values := map[string]float64{}
+	for _, s := range api.counts[0].Series {
+		assert.Equal(t, "reporter.incidents.reported", s.Metric)
+		values[strings.Join(s.Tags, ",")] = s.Points[0].GetValue()
+	}
+	assert.Equal(t, map[string]float64{
+		"domain:Payments,env:test,severity:High": 2,
+		"domain:Payments,env:test,severity:Low":  1,
+	}, values)
+
+	require.Len(t, api.distributions, 1)
+	require.Len(t, api.distributions[0].Series, 1)
+	series := api.distributions[0].Series[0]
+	assert.Equal(t, "reporter.incidents.time_to_ack", series.Metric)
+	assert.Equal(t, []float64{30, 90}, *series.Points[0][1].DistributionPointData)
+
+	// A second flush with nothing buffered must not call the API
+	require.NoError(t, recorder.Flush(context.Background()))
+	assert.Len(t, api.counts, 1)
+	assert.Len(t, api.distributions, 1)
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// Kind identifies the type of a recorded metric
+type Kind string
+
+const (
+	KindCount        Kind = "count"
+	KindDistribution Kind = "distribution"
+)
+
+// Point is a single recorded metric sample
+type Point struct {
+	Kind  Kind
+	Name  string
+	Value float64
+	Tags  []string
+}
+
+// MemoryRecorder keeps every recorded metric in memory. It is intended for tests.
+type MemoryRecorder struct {
+	mu     sync.Mutex
+	points []Point
+}
+
+// NewMemoryRecorder creates an empty MemoryRecorder
+func NewMemoryRecorder() *MemoryRecorder {
+	return &MemoryRecorder{}
+}
+
+func (m *MemoryRecorder) Count(name string, value int64, tags ...string) {
+	m.record(Point{Kind: KindCount, Name: name, Value: float64(value), Tags: tags})
+}
+
+func (m *MemoryRecorder) Distribution(name string, value float64, tags ...string) {
+	m.record(Point{Kind: KindDistribution, Name: name, Value: value, Tags: tags})
+}
+
+// Flush is a no-op, recorded points are kept until Reset is called
+func (m *MemoryRecorder) Flush(context.Context) error {
+	return nil
+}
+
+// Points returns a copy of all recorded points
+func (m *MemoryRecorder) Points() []Point {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.points)
+}
+
+// Find returns the recorded points with the given name that carry all the given tags
+func (m *MemoryRecorder) Find(name string, tags ...string) []Point {
+	var found []Point
+	for _, p := range m.Points() {
+		if p.Name != name {
+			continue
+		}
+		if !containsAll(p.Tags, tags) {
+			continue
+		}
+		found = append(found, p)
+	}
+	return found
+}
+
+// Sum returns the sum of the values of the points matched by Find
+func (m *MemoryRecorder) Sum(name string, tags ...string) float64 {
+	var sum float64
+	for _, p := range m.Find(name, tags...) {
+		sum += p.Value
+	}
+	return sum
+}
+
+// Reset discards all recorded points
+func (m *MemoryRecorder) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.points = nil
+}
+
+func (m *MemoryRecorder) record(p Point) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p.Tags = slices.Clone(p.Tags)
+	m.points = append(m.points, p)
+}
+
+func containsAll(haystack, needles []string) bool {
+	for _, n := range needles {
+		if !slices.Contains(haystack, n) {
+			return false
+		}
+	}
+	return true
+}
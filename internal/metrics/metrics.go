@@ -0,0 +1,78 @@
+// Package metrics provides custom metrics emission for incident reporting activity.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Metric names, relative to the configured prefix
+const (
+	IncidentsReported     = "incidents.reported"
+	IncidentTimeToAck     = "incidents.time_to_ack"
+	IncidentTimeToResolve = "incidents.time_to_resolve"
+	SinkFailures          = "sink.failures"
+	SinkDuration          = "sink.duration"
+	ModalOpenFailures     = "modal.open_failures"
+	HTTPRequests          = "http.requests"
+	HTTPRequestDuration   = "http.request.duration"
+)
+
+// Recorder records custom metrics. Implementations must be safe for concurrent use.
+type Recorder interface {
+	// Count adds value to the counter identified by name and tags
+	Count(name string, value int64, tags ...string)
+	// Distribution records a single sample of the distribution identified by name and tags
+	Distribution(name string, value float64, tags ...string)
+	// Flush sends any buffered metrics to the backend
+	Flush(ctx context.Context) error
+}
+
+// Duration records d, in seconds, as a sample of the named distribution
+func Duration(r Recorder, name string, d time.Duration, tags ...string) {
+	r.Distribution(name, d.Seconds(), tags...)
+}
+
+// NoopRecorder discards all metrics
+type NoopRecorder struct{}
+
+// NewNoopRecorder creates a Recorder that discards all metrics
+func NewNoopRecorder() *NoopRecorder {
+	return &NoopRecorder{}
+}
+
+func (NoopRecorder) Count(string, int64, ...string)          {}
+func (NoopRecorder) Distribution(string, float64, ...string) {}
+func (NoopRecorder) Flush(context.Context) error             { return nil }
+
+// MultiRecorder records every metric to several recorders
+type MultiRecorder []Recorder
+
+// NewMultiRecorder creates a Recorder recording to all the given recorders
+func NewMultiRecorder(recorders ...Recorder) MultiRecorder {
+	return MultiRecorder(recorders)
+}
+
+func (m MultiRecorder) Count(name string, value int64, tags ...string) {
+	for _, r := range m {
+		r.Count(name, value, tags...)
+	}
+}
+
+func (m MultiRecorder) Distribution(name string, value float64, tags ...string) {
+	for _, r := range m {
+		r.Distribution(name, value, tags...)
+	}
+}
+
+// Flush flushes every recorder, even if one fails
+func (m MultiRecorder) Flush(ctx context.Context) error {
+	var errs []error
+	for _, r := range m {
+		if err := r.Flush(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
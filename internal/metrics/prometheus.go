@@ -0,0 +1,170 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/syltek/oncall-incident-reporter/pkg/logutil"
+	"go.uber.org/zap"
+)
+
+// durationBuckets are the histogram buckets, in seconds, of the distributions measuring how long
+// humans take, the others use the default buckets sized for calls to APIs
+var durationBuckets = map[string][]float64{
+	IncidentTimeToAck:     prometheus.ExponentialBuckets(60, 2, 10),
+	IncidentTimeToResolve: prometheus.ExponentialBuckets(60, 2, 12),
+}
+
+// PrometheusRecorder exposes metrics to be scraped by Prometheus. Counts are counters and
+// distributions are histograms. Tags are turned into labels, "key:value" into key="value".
+//
+// The labels of a metric are the tag keys of its first recording. A later recording missing
+// one of them gets it empty, and its tags that are not labels are dropped.
+type PrometheusRecorder struct {
+	registry *prometheus.Registry
+	prefix   string
+
+	mu         sync.Mutex
+	counters   map[string]*labeledVec[*prometheus.CounterVec]
+	histograms map[string]*labeledVec[*prometheus.HistogramVec]
+}
+
+type labeledVec[V any] struct {
+	vec    V
+	labels []string
+}
+
+// NewPrometheusRecorder creates a PrometheusRecorder with its own registry, including the Go
+// runtime and process metrics. Metric names are prefixed with prefix.
+func NewPrometheusRecorder(prefix string) *PrometheusRecorder {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return &PrometheusRecorder{
+		registry:   registry,
+		prefix:     strings.TrimSuffix(prefix, "."),
+		counters:   make(map[string]*labeledVec[*prometheus.CounterVec]),
+		histograms: make(map[string]*labeledVec[*prometheus.HistogramVec]),
+	}
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (p *PrometheusRecorder) Handler() http.Handler {
+	return promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{})
+}
+
+func (p *PrometheusRecorder) Count(name string, value int64, tags ...string) {
+	labels := parseTags(tags)
+
+	p.mu.Lock()
+	counter, ok := p.counters[name]
+	if !ok {
+		counter = &labeledVec[*prometheus.CounterVec]{labels: labelNames(labels)}
+		counter.vec = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: p.metricName(name) + "_total",
+			Help: "Count of " + name,
+		}, counter.labels)
+		if !p.register(name, counter.vec) {
+			p.mu.Unlock()
+			return
+		}
+		p.counters[name] = counter
+	}
+	p.mu.Unlock()
+
+	counter.vec.With(selectLabels(counter.labels, labels)).Add(float64(value))
+}
+
+func (p *PrometheusRecorder) Distribution(name string, value float64, tags ...string) {
+	labels := parseTags(tags)
+
+	p.mu.Lock()
+	histogram, ok := p.histograms[name]
+	if !ok {
+		buckets, ok := durationBuckets[name]
+		if !ok {
+			buckets = prometheus.DefBuckets
+		}
+		histogram = &labeledVec[*prometheus.HistogramVec]{labels: labelNames(labels)}
+		histogram.vec = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    p.metricName(name),
+			Help:    "Distribution of " + name,
+			Buckets: buckets,
+		}, histogram.labels)
+		if !p.register(name, histogram.vec) {
+			p.mu.Unlock()
+			return
+		}
+		p.histograms[name] = histogram
+	}
+	p.mu.Unlock()
+
+	histogram.vec.With(selectLabels(histogram.labels, labels)).Observe(value)
+}
+
+// Flush is a no-op, Prometheus scrapes the metrics
+func (p *PrometheusRecorder) Flush(context.Context) error {
+	return nil
+}
+
+func (p *PrometheusRecorder) register(name string, collector prometheus.Collector) bool {
+	if err := p.registry.Register(collector); err != nil {
+		logutil.Error("Failed to register metric", zap.String("metric", name), zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// metricName turns a dotted metric name into a Prometheus one, e.g. incidents.reported into
+// <prefix>_incidents_reported
+func (p *PrometheusRecorder) metricName(name string) string {
+	return sanitizeName(p.prefix + "_" + name)
+}
+
+// parseTags turns key:value tags into labels. A tag without a value is a label set to "true".
+func parseTags(tags []string) map[string]string {
+	labels := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		key, value, ok := strings.Cut(tag, ":")
+		if !ok {
+			value = "true"
+		}
+		labels[sanitizeName(key)] = value
+	}
+	return labels
+}
+
+func labelNames(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func selectLabels(names []string, labels map[string]string) prometheus.Labels {
+	selected := make(prometheus.Labels, len(names))
+	for _, name := range names {
+		selected[name] = labels[name]
+	}
+	return selected
+}
+
+// sanitizeName replaces the characters not allowed in Prometheus names by underscores
+func sanitizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T, recorder *PrometheusRecorder) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	recorder.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
+
+func TestPrometheusRecorder(t *testing.T) {
+	recorder := NewPrometheusRecorder("reporter.")
+	recorder.Count(IncidentsReported, 1, "severity:High", "domain:Payments")
+	recorder.Count(IncidentsReported, 2, "domain:Payments", "severity:High")
+	// Missing labels are empty, unknown ones dropped
+	recorder.Count(IncidentsReported, 1, "severity:Low", "team:platform")
+	recorder.Distribution(SinkDuration, 0.2, "sink:slack", "outcome:success")
+	recorder.Distribution(IncidentTimeToAck, 90, "severity:High")
+
+	body := scrape(t, recorder)
+	assert.Contains(t, body, `reporter_incidents_reported_total{domain="Payments",severity="High"} 3`)
+	assert.Contains(t, body, `reporter_incidents_reported_total{domain="",severity="Low"} 1`)
+	assert.Contains(t, body, `reporter_sink_duration_bucket{outcome="success",sink="slack",le="0.25"} 1`)
+	assert.Contains(t, body, `reporter_incidents_time_to_ack_bucket{severity="High",le="120"} 1`)
+	assert.Contains(t, body, "go_goroutines")
+	assert.NoError(t, recorder.Flush(context.Background()))
+}
+
+func TestMultiRecorder(t *testing.T) {
+	first, second := NewMemoryRecorder(), NewMemoryRecorder()
+	recorder := NewMultiRecorder(first, second)
+
+	recorder.Count(SinkFailures, 1, "sink:slack")
+	recorder.Distribution(SinkDuration, 0.5, "sink:slack")
+
+	for _, r := range []*MemoryRecorder{first, second} {
+		assert.Equal(t, 1.0, r.Sum(SinkFailures, "sink:slack"))
+		assert.Equal(t, 0.5, r.Sum(SinkDuration, "sink:slack"))
+	}
+	assert.NoError(t, recorder.Flush(context.Background()))
+}
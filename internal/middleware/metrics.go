@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/syltek/oncall-incident-reporter/internal/metrics"
+)
+
+// Metrics returns a middleware recording the count and the latency of the requests by route,
+// method and status code
+func Metrics(recorder metrics.Recorder) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rw := &ResponseWriter{
+				ResponseWriter: w,
+				statusCode:     http.StatusOK, // Default to 200 if WriteHeader is never called
+			}
+
+			next.ServeHTTP(rw, r)
+
+			tags := []string{
+				"route:" + routeTemplate(r),
+				"method:" + r.Method,
+				"status:" + strconv.Itoa(rw.statusCode),
+			}
+			recorder.Count(metrics.HTTPRequests, 1, tags...)
+			metrics.Duration(recorder, metrics.HTTPRequestDuration, time.Since(start), tags...)
+		})
+	}
+}
+
+// routeTemplate returns the path template of the route that matched the request. Middlewares
+// only run once a route matched, requests to unknown paths are not recorded. The requests
+// handled without the router, e.g. over Socket Mode, are recorded with their path, the path of
+// a configured endpoint.
+func routeTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return r.URL.Path
+	}
+	// Every route is registered with a path, the template is empty otherwise
+	template, _ := route.GetPathTemplate()
+	return template
+}
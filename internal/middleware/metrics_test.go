@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/syltek/oncall-incident-reporter/internal/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	recorder := metrics.NewMemoryRecorder()
+	r := mux.NewRouter()
+	r.Use(Metrics(recorder))
+	r.HandleFunc("/incidents/{id}", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	r.HandleFunc("/incident", func(http.ResponseWriter, *http.Request) {})
+
+	for _, path := range []string{"/incident", "/incidents/INC-1", "/incidents/INC-2"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, nil))
+	}
+
+	assert.Equal(t, 1.0, recorder.Sum(metrics.HTTPRequests, "route:/incident", "method:POST", "status:200"))
+	assert.Equal(t, 2.0, recorder.Sum(metrics.HTTPRequests, "route:/incidents/{id}", "status:404"))
+	assert.Len(t, recorder.Find(metrics.HTTPRequestDuration), 3)
+}
@@ -9,9 +9,11 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
+	"strconv"
+	"sync/atomic"
 	"time"
 
+	"github.com/syltek/oncall-incident-reporter/internal/config"
 	apperrors "github.com/syltek/oncall-incident-reporter/pkg/errors"
 	"github.com/syltek/oncall-incident-reporter/pkg/logutil"
 	"go.uber.org/zap"
@@ -29,6 +31,20 @@ func (rw *ResponseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// WithLogger returns a middleware attaching the logger to the requests, so that the request and
+// what is logged while handling it are written to it. Without a logger, the requests are left
+// unchanged.
+func WithLogger(logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if logger == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(logutil.WithLogger(r.Context(), logger)))
+		})
+	}
+}
+
 // Logging middleware logs HTTP request details including method, path, status code,
 // and duration. It uses structured logging via zap.
 func Logging(next http.Handler) http.Handler {
@@ -43,7 +59,7 @@ func Logging(next http.Handler) http.Handler {
 
 		next.ServeHTTP(rw, r)
 
-		logutil.Info("Request processed",
+		logutil.InfoCtx(r.Context(), "Request processed",
 			zap.String("method", r.Method),
 			zap.String("path", r.URL.Path),
 			zap.Int("status", rw.statusCode),
@@ -67,7 +83,7 @@ func Recovery(next http.Handler) http.Handler {
 					apperrors.CategoryServer,
 					fmt.Errorf("panic recovered: %v", rec),
 				)
-				logutil.Error("Panic recovered in request handler",
+				logutil.ErrorCtx(r.Context(), "Panic recovered in request handler",
 					zap.Error(err),
 					zap.String("path", r.URL.Path),
 					zap.String("method", r.Method),
@@ -79,29 +95,80 @@ func Recovery(next http.Handler) http.Handler {
 	})
 }
 
-// ValidateSlackSignature middleware validates the X-Slack-Signature header
-// to ensure requests are coming from Slack
-func ValidateSlackSignature(next http.Handler) http.Handler {
-	signingSecret := os.Getenv("SLACK_SIGNING_SECRET")
-	if signingSecret == "" {
-		logutil.Error("SLACK_SIGNING_SECRET environment variable is not set")
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			http.Error(w, "Server configuration error", http.StatusInternalServerError)
-		})
+// DefaultMaxRequestAge is the default maximum skew between the X-Slack-Request-Timestamp header
+// and the current time, as recommended by Slack
+const DefaultMaxRequestAge = 5 * time.Minute
+
+// SlackSignatureOptions configures the Slack signature validation
+type SlackSignatureOptions struct {
+	// MaxRequestAge is the maximum skew allowed between the request timestamp and now.
+	// Defaults to DefaultMaxRequestAge.
+	MaxRequestAge time.Duration
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// SlackSignatureValidator validates the X-Slack-Signature header to ensure requests are coming
+// from Slack. Several signing secrets can be active at once so a secret can be rotated without
+// rejecting requests signed with the previous one.
+type SlackSignatureValidator struct {
+	rules atomic.Pointer[signatureRules]
+	now   func() time.Time
+	seen  *replayCache
+}
+
+// signatureRules are the secrets and the allowed skew, replaced together when the configuration
+// is reloaded
+type signatureRules struct {
+	secrets       []config.SigningSecret
+	maxRequestAge time.Duration
+}
+
+// NewSlackSignatureValidator creates a validator accepting requests signed with any of the given
+// secrets. Requests whose timestamp is outside the allowed skew are rejected, and so are exact
+// replays of a request already accepted while its timestamp is still fresh.
+func NewSlackSignatureValidator(secrets []config.SigningSecret, opts SlackSignatureOptions) *SlackSignatureValidator {
+	v := &SlackSignatureValidator{
+		now:  opts.Now,
+		seen: newReplayCache(),
 	}
+	if v.now == nil {
+		v.now = time.Now
+	}
+	v.Configure(secrets, opts.MaxRequestAge)
+	return v
+}
 
-	logutil.Debug("Validating Slack signature. Using it from SLACK_SIGNING_SECRET environment variable")
+// Configure replaces the accepted secrets and the allowed skew, e.g. when a secret is rotated.
+// Requests being validated keep the previous ones.
+func (v *SlackSignatureValidator) Configure(secrets []config.SigningSecret, maxRequestAge time.Duration) {
+	if len(secrets) == 0 {
+		logutil.Error("No Slack signing secret is configured")
+	}
+	if maxRequestAge <= 0 {
+		maxRequestAge = DefaultMaxRequestAge
+	}
+	v.rules.Store(&signatureRules{secrets: secrets, maxRequestAge: maxRequestAge})
+}
 
+// Middleware returns the middleware validating the Slack signature of requests
+func (v *SlackSignatureValidator) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rules := v.rules.Load()
+		if len(rules.secrets) == 0 {
+			http.Error(w, "Server configuration error", http.StatusInternalServerError)
+			return
+		}
+
 		// Get required headers
 		timestamp := r.Header.Get("X-Slack-Request-Timestamp")
 		signature := r.Header.Get("X-Slack-Signature")
 
-		logutil.Debug("Timestamp", zap.String("timestamp", timestamp))
-		logutil.Debug("Signature", zap.String("signature", signature))
+		logutil.DebugCtx(r.Context(), "Timestamp", zap.String("timestamp", timestamp))
+		logutil.DebugCtx(r.Context(), "Signature", zap.String("signature", signature))
 
 		if timestamp == "" || signature == "" {
-			logutil.Error("Missing required Slack headers",
+			logutil.ErrorCtx(r.Context(), "Missing required Slack headers",
 				zap.String("path", r.URL.Path),
 				zap.String("method", r.Method),
 			)
@@ -109,10 +176,31 @@ func ValidateSlackSignature(next http.Handler) http.Handler {
 			return
 		}
 
+		// Reject stale requests, a captured request must not be usable forever
+		requestTime, err := parseSlackTimestamp(timestamp)
+		if err != nil {
+			logutil.ErrorCtx(r.Context(), "Invalid Slack request timestamp",
+				zap.Error(err),
+				zap.String("path", r.URL.Path),
+			)
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		now := v.now()
+		if skew := now.Sub(requestTime).Abs(); skew > rules.maxRequestAge {
+			logutil.ErrorCtx(r.Context(), "Slack request timestamp outside the allowed window",
+				zap.String("path", r.URL.Path),
+				zap.Duration("skew", skew),
+				zap.Duration("max_request_age", rules.maxRequestAge),
+			)
+			http.Error(w, "Request expired", http.StatusUnauthorized)
+			return
+		}
+
 		// Read the request body
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			logutil.Error("Failed to read request body",
+			logutil.ErrorCtx(r.Context(), "Failed to read request body",
 				zap.Error(err),
 				zap.String("path", r.URL.Path),
 			)
@@ -123,17 +211,9 @@ func ValidateSlackSignature(next http.Handler) http.Handler {
 		// Important: Restore the body for subsequent middleware/handlers
 		r.Body = io.NopCloser(bytes.NewBuffer(body))
 
-		// Create the signature base string
-		baseString := fmt.Sprintf("v0:%s:%s", timestamp, string(body))
-
-		// Create the signature using HMAC-SHA256
-		mac := hmac.New(sha256.New, []byte(signingSecret))
-		mac.Write([]byte(baseString))
-		expectedSignature := "v0=" + hex.EncodeToString(mac.Sum(nil))
-
-		// Compare signatures using a constant-time comparison
-		if !hmac.Equal([]byte(signature), []byte(expectedSignature)) {
-			logutil.Error("Invalid Slack signature",
+		keyID, ok := rules.match(signature, timestamp, body)
+		if !ok {
+			logutil.ErrorCtx(r.Context(), "Invalid Slack signature",
 				zap.String("path", r.URL.Path),
 				zap.String("method", r.Method),
 			)
@@ -141,8 +221,52 @@ func ValidateSlackSignature(next http.Handler) http.Handler {
 			return
 		}
 
-		logutil.Debug("Signature is valid")
+		// Reject exact replays. A signature only needs to be remembered while its
+		// timestamp is fresh, older replays are rejected by the timestamp check.
+		if !v.seen.add(signature, requestTime.Add(rules.maxRequestAge), now) {
+			logutil.ErrorCtx(r.Context(), "Replayed Slack request",
+				zap.String("path", r.URL.Path),
+				zap.String("method", r.Method),
+			)
+			http.Error(w, "Replayed request", http.StatusUnauthorized)
+			return
+		}
+
+		// Requests signed with an older secret tell whether a rotation can be finished
+		if keyID != rules.secrets[0].ID {
+			logutil.InfoCtx(r.Context(), "Signature matches a previous signing secret", zap.String("key_id", keyID))
+		} else {
+			logutil.DebugCtx(r.Context(), "Signature is valid", zap.String("key_id", keyID))
+		}
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// match returns the ID of the signing secret the signature was computed with
+func (rules *signatureRules) match(signature, timestamp string, body []byte) (string, bool) {
+	// Create the signature base string
+	baseString := fmt.Sprintf("v0:%s:%s", timestamp, string(body))
+
+	for _, secret := range rules.secrets {
+		// Create the signature using HMAC-SHA256
+		mac := hmac.New(sha256.New, []byte(secret.Secret))
+		mac.Write([]byte(baseString))
+		expectedSignature := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+		// Compare signatures using a constant-time comparison
+		if hmac.Equal([]byte(signature), []byte(expectedSignature)) {
+			return secret.ID, true
+		}
+	}
+	return "", false
+}
+
+// parseSlackTimestamp parses the X-Slack-Request-Timestamp header, in seconds since the epoch
+func parseSlackTimestamp(timestamp string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse timestamp %q: %w", timestamp, err)
+	}
+	return time.Unix(seconds, 0), nil
+}
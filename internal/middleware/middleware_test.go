@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+	"github.com/syltek/oncall-incident-reporter/pkg/logutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const (
+	testSigningSecret     = "test-signing-secret"
+	previousSigningSecret = "previous-signing-secret"
+)
+
+var testSigningSecrets = []config.SigningSecret{
+	{ID: config.CURRENT_SIGNING_SECRET_ID, Secret: testSigningSecret},
+	{ID: config.PREVIOUS_SIGNING_SECRET_ID, Secret: previousSigningSecret},
+}
+
+func sign(secret, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + body))
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidateSlackSignature(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	fresh := strconv.FormatInt(now.Add(-30*time.Second).Unix(), 10)
+	stale := strconv.FormatInt(now.Add(-6*time.Minute).Unix(), 10)
+	future := strconv.FormatInt(now.Add(6*time.Minute).Unix(), 10)
+	body := "command=%2Fincident&trigger_id=123"
+
+	tests := []struct {
+		name       string
+		timestamp  string
+		signature  string
+		wantStatus int
+	}{
+		{
+			name:       "valid fresh request",
+			timestamp:  fresh,
+			signature:  sign(testSigningSecret, fresh, body),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "missing headers",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "malformed timestamp",
+			timestamp:  "yesterday",
+			signature:  sign(testSigningSecret, "yesterday", body),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "stale request",
+			timestamp:  stale,
+			signature:  sign(testSigningSecret, stale, body),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "request from the future",
+			timestamp:  future,
+			signature:  sign(testSigningSecret, future, body),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "signed with the previous secret during a rotation",
+			timestamp:  fresh,
+			signature:  sign(previousSigningSecret, fresh, body),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "invalid signature",
+			timestamp:  fresh,
+			signature:  sign("another-secret", fresh, body),
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewSlackSignatureValidator(testSigningSecrets, SlackSignatureOptions{
+				Now: func() time.Time { return now },
+			}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, newSignedRequest(tt.timestamp, tt.signature, body))
+			assert.Equal(t, tt.wantStatus, rec.Code)
+		})
+	}
+}
+
+func TestValidateSlackSignatureRejectsReplays(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	clock := func() time.Time { return now }
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	body := "payload=%7B%7D"
+	signature := sign(testSigningSecret, timestamp, body)
+
+	handler := NewSlackSignatureValidator(testSigningSecrets, SlackSignatureOptions{
+		MaxRequestAge: time.Minute,
+		Now:           clock,
+	}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	steps := []struct {
+		name       string
+		elapsed    time.Duration
+		wantStatus int
+	}{
+		{"first delivery", 0, http.StatusOK},
+		{"exact replay within the window", 10 * time.Second, http.StatusUnauthorized},
+		{"exact replay after the window", 2 * time.Minute, http.StatusUnauthorized},
+	}
+
+	for _, step := range steps {
+		now = time.Unix(1_700_000_000, 0).Add(step.elapsed)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newSignedRequest(timestamp, signature, body))
+		assert.Equal(t, step.wantStatus, rec.Code, step.name)
+	}
+}
+
+func TestValidateSlackSignatureLogsPreviousSecret(t *testing.T) {
+	observed, logs := observer.New(zap.InfoLevel)
+	previous := logutil.Logger
+	logutil.Logger = zap.New(observed)
+	t.Cleanup(func() { logutil.Logger = previous })
+
+	handler := NewSlackSignatureValidator(testSigningSecrets, SlackSignatureOptions{}).Middleware(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	// Requests signed with the current secret are not logged at Info
+	handler.ServeHTTP(httptest.NewRecorder(), newSignedRequest(timestamp, sign(testSigningSecret, timestamp, "a=1"), "a=1"))
+	assert.Zero(t, logs.Len())
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newSignedRequest(timestamp, sign(previousSigningSecret, timestamp, "a=2"), "a=2"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	entries := logs.All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "Signature matches a previous signing secret", entries[0].Message)
+	assert.Equal(t, config.PREVIOUS_SIGNING_SECRET_ID, entries[0].ContextMap()["key_id"])
+}
+
+func TestValidateSlackSignatureWithoutSecrets(t *testing.T) {
+	handler := NewSlackSignatureValidator(nil, SlackSignatureOptions{}).Middleware(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newSignedRequest(timestamp, sign(testSigningSecret, timestamp, ""), ""))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func newSignedRequest(timestamp, signature, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/incident", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if timestamp != "" {
+		req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	}
+	if signature != "" {
+		req.Header.Set("X-Slack-Signature", signature)
+	}
+	return req
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+)
+
+// replayCache remembers the signatures of accepted requests until they expire
+type replayCache struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+}
+
+func newReplayCache() *replayCache {
+	return &replayCache{entries: make(map[string]time.Time)}
+}
+
+// add records signature until expiresAt and reports whether it was not already recorded
+func (c *replayCache) add(signature string, expiresAt, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for s, expiry := range c.entries {
+		if now.After(expiry) {
+			delete(c.entries, s)
+		}
+	}
+
+	if _, ok := c.entries[signature]; ok {
+		return false
+	}
+	c.entries[signature] = expiresAt
+	return true
+}
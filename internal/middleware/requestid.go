@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/awslabs/aws-lambda-go-api-proxy/core"
+	"github.com/syltek/oncall-incident-reporter/pkg/logutil"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader carries the request ID, from the proxy in front of the app and back to the
+// caller
+const RequestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID, which is also added to the lines
+// logged with the context
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey{}, requestID)
+	return logutil.WithFields(ctx, zap.String(logutil.FieldRequestID, requestID))
+}
+
+// RequestIDFromContext returns the ID of the request being processed, empty outside a request
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// RequestID middleware identifies every request, so its log lines can be correlated. In Lambda,
+// the ID is the API Gateway request ID or the Lambda request ID, so it can be looked up in the
+// AWS logs as well. Otherwise it is taken from the X-Request-Id header or generated. The ID of
+// the trace the request belongs to is logged too.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := requestIDOf(r)
+		w.Header().Set(RequestIDHeader, requestID)
+
+		ctx := WithRequestID(r.Context(), requestID)
+		if span := trace.SpanContextFromContext(ctx); span.HasTraceID() {
+			ctx = logutil.WithFields(ctx, zap.String(logutil.FieldTraceID, span.TraceID().String()))
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func requestIDOf(r *http.Request) string {
+	ctx := r.Context()
+	if gateway, ok := core.GetAPIGatewayContextFromContext(ctx); ok && gateway.RequestID != "" {
+		return gateway.RequestID
+	}
+	if gateway, ok := core.GetAPIGatewayV2ContextFromContext(ctx); ok && gateway.RequestID != "" {
+		return gateway.RequestID
+	}
+	// ALB and Function URL requests have no gateway request ID
+	if lambda, ok := lambdacontext.FromContext(ctx); ok && lambda.AwsRequestID != "" {
+		return lambda.AwsRequestID
+	}
+	if requestID := r.Header.Get(RequestIDHeader); requestID != "" && len(requestID) <= maxRequestIDLength {
+		return requestID
+	}
+	return newRequestID()
+}
+
+// maxRequestIDLength bounds the request IDs accepted from the X-Request-Id header
+const maxRequestIDLength = 128
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
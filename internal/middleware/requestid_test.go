@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/awslabs/aws-lambda-go-api-proxy/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syltek/oncall-incident-reporter/pkg/logutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRequestID(t *testing.T) {
+	lambdaCtx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{AwsRequestID: "lambda-request"})
+
+	tests := []struct {
+		name    string
+		request func() *http.Request
+		want    string
+	}{
+		{
+			name: "API Gateway request ID",
+			request: func() *http.Request {
+				req, err := (&core.RequestAccessor{}).EventToRequestWithContext(lambdaCtx, events.APIGatewayProxyRequest{
+					HTTPMethod:     http.MethodPost,
+					Path:           "/incident",
+					RequestContext: events.APIGatewayProxyRequestContext{RequestID: "gateway-request"},
+				})
+				require.NoError(t, err)
+				return req
+			},
+			want: "gateway-request",
+		},
+		{
+			name: "Lambda request ID without gateway",
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodPost, "/incident", nil).WithContext(lambdaCtx)
+			},
+			want: "lambda-request",
+		},
+		{
+			name: "header set by a proxy",
+			request: func() *http.Request {
+				req := httptest.NewRequest(http.MethodPost, "/incident", nil)
+				req.Header.Set(RequestIDHeader, "proxy-request")
+				return req
+			},
+			want: "proxy-request",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = RequestIDFromContext(r.Context())
+			}))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, tt.request())
+
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.want, rec.Header().Get(RequestIDHeader))
+		})
+	}
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	var ids []string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids = append(ids, RequestIDFromContext(r.Context()))
+	}))
+	for range 2 {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	require.Len(t, ids, 2)
+	assert.Len(t, ids[0], 32)
+	assert.NotEqual(t, ids[0], ids[1])
+}
+
+func TestRequestIDIsLogged(t *testing.T) {
+	observed, logs := observer.New(zap.DebugLevel)
+	previous := logutil.Logger
+	logutil.Logger = zap.New(observed)
+	t.Cleanup(func() { logutil.Logger = previous })
+
+	handler := RequestID(Logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := logutil.WithFields(r.Context(), zap.String(logutil.FieldTriggerID, "123.456"))
+		logutil.ErrorCtx(ctx, "Failed to send modal to Slack")
+	})))
+	req := httptest.NewRequest(http.MethodPost, "/incident", nil)
+	req.Header.Set(RequestIDHeader, "proxy-request")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := logs.All()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "Failed to send modal to Slack", entries[0].Message)
+	assert.Equal(t, "proxy-request", entries[0].ContextMap()[logutil.FieldRequestID])
+	assert.Equal(t, "123.456", entries[0].ContextMap()[logutil.FieldTriggerID])
+	assert.Equal(t, "Request processed", entries[1].Message)
+	assert.Equal(t, "proxy-request", entries[1].ContextMap()[logutil.FieldRequestID])
+}
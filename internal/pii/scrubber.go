@@ -0,0 +1,152 @@
+// Package pii detects and masks the personal data reporters paste in incidents, such as customer
+// emails, phone numbers, IBANs and card numbers, before the incidents leave the organisation.
+package pii
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+)
+
+// Masks replacing the detected data
+const (
+	MaskEmail = "[email]"
+	MaskPhone = "[phone]"
+	MaskIBAN  = "[iban]"
+	MaskPAN   = "[card]"
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`)
+	// IBANs are written in one block or in groups of four
+	ibanPattern = regexp.MustCompile(`\b[A-Z]{2}\d{2}(?:[A-Z0-9]{11,30}|(?: [A-Z0-9]{4}){2,7}(?: [A-Z0-9]{1,4})?)\b`)
+	// Card numbers have 13 to 19 digits, possibly grouped with spaces or dashes
+	panPattern = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	// Phone numbers are recognised with an international prefix or with separators between
+	// groups of digits, so that bare identifiers are not taken for phone numbers
+	phonePattern = regexp.MustCompile(`(?:\+|\b00)\d{1,3}[ .-]?(?:\(\d{1,4}\)[ .-]?)?\d{2,4}(?:[ .-]?\d{2,4}){1,4}\b` +
+		`|(?:\(\d{2,4}\)[ .-]?|\b\d{2,4}[ .-])\d{2,4}(?:[ .-]\d{2,4}){1,3}\b`)
+	// datePattern matches the phone number candidates starting with a date, e.g. a timestamp
+	datePattern = regexp.MustCompile(`^(?:\d{4}[-./]\d{1,2}[-./]\d{1,2}|\d{1,2}[-./]\d{1,2}[-./]\d{2,4})(?:\D|$)`)
+)
+
+// Scrubber masks the personal data found by its detectors
+type Scrubber struct {
+	detectors []detector
+}
+
+type detector struct {
+	pattern *regexp.Regexp
+	mask    string
+	// valid tells a match is the data, e.g. passes the checksum of an IBAN. Nil accepts all.
+	valid func(match string) bool
+}
+
+// detectors by name. They run in this order, IBANs contain digits that could be taken for a
+// card or phone number.
+var detectors = []struct {
+	name string
+	detector
+}{
+	{config.SCRUB_DETECTOR_EMAIL, detector{emailPattern, MaskEmail, nil}},
+	{config.SCRUB_DETECTOR_IBAN, detector{ibanPattern, MaskIBAN, validIBAN}},
+	{config.SCRUB_DETECTOR_PAN, detector{panPattern, MaskPAN, validPAN}},
+	{config.SCRUB_DETECTOR_PHONE, detector{phonePattern, MaskPhone, validPhone}},
+}
+
+// NewScrubber creates a Scrubber running the detectors enabled in the configuration
+func NewScrubber(cfg *config.Scrubbing) *Scrubber {
+	enabled := cfg.EnabledDetectors()
+	s := &Scrubber{}
+	for _, d := range detectors {
+		for _, name := range enabled {
+			if d.name == name {
+				s.detectors = append(s.detectors, d.detector)
+			}
+		}
+	}
+	return s
+}
+
+// Scrub masks the personal data in text
+func (s *Scrubber) Scrub(text string) string {
+	for _, d := range s.detectors {
+		text = d.pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if d.valid != nil && !d.valid(match) {
+				return match
+			}
+			return d.mask
+		})
+	}
+	return text
+}
+
+// ScrubFields returns a copy of the fields with the personal data of their values masked
+func (s *Scrubber) ScrubFields(fields map[string]string) map[string]string {
+	scrubbed := make(map[string]string, len(fields))
+	for key, value := range fields {
+		scrubbed[key] = s.Scrub(value)
+	}
+	return scrubbed
+}
+
+// validIBAN checks the length and the ISO 7064 mod 97-10 checksum
+func validIBAN(match string) bool {
+	iban := strings.ReplaceAll(match, " ", "")
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+
+	// Move the country code and the check digits to the end and read letters as numbers, A
+	// being 10 and Z 35. The remainder is computed digit by digit, the number is too large.
+	remainder := 0
+	for _, r := range iban[4:] + iban[:4] {
+		switch {
+		case r >= '0' && r <= '9':
+			remainder = (remainder*10 + int(r-'0')) % 97
+		case r >= 'A' && r <= 'Z':
+			remainder = (remainder*100 + int(r-'A'+10)) % 97
+		default:
+			return false
+		}
+	}
+	return remainder == 1
+}
+
+// validPAN checks the Luhn checksum of the card number
+func validPAN(match string) bool {
+	var sum, count int
+	double := false
+	for i := len(match) - 1; i >= 0; i-- {
+		c := match[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+		count++
+	}
+	return count >= 13 && count <= 19 && sum%10 == 0
+}
+
+// validPhone rejects dates, and numbers too short or too long to be phone numbers
+func validPhone(match string) bool {
+	if datePattern.MatchString(match) {
+		return false
+	}
+	var count int
+	for _, r := range match {
+		if r >= '0' && r <= '9' {
+			count++
+		}
+	}
+	return count >= 8 && count <= 15
+}
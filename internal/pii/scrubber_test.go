@@ -0,0 +1,57 @@
+package pii
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+)
+
+func TestScrub(t *testing.T) {
+	s := NewScrubber(&config.Scrubbing{Enabled: true})
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"email", "Customer jane.doe+shop@example.co.uk cannot pay", "Customer [email] cannot pay"},
+		{"international phone", "Call her at +34 612 345 678", "Call her at [phone]"},
+		{"phone with separators", "Call (555) 123-4567 back", "Call [phone] back"},
+		{"IBAN in groups", "Refund to ES91 2100 0418 4502 0005 1332 today", "Refund to [iban] today"},
+		{"IBAN in one block", "Refund to GB29NWBK60161331926819", "Refund to [iban]"},
+		{"IBAN with a wrong checksum", "Ref GB00NWBK60161331926819", "Ref GB00NWBK60161331926819"},
+		{"card number", "Card 4111 1111 1111 1111 was charged twice", "Card [card] was charged twice"},
+		{"card number with dashes", "Card 5500-0000-0000-0004 declined", "Card [card] declined"},
+		{"digits failing the Luhn check", "Order 4111111111111112 is stuck", "Order 4111111111111112 is stuck"},
+		{"date", "Since 2024-01-15 10:30", "Since 2024-01-15 10:30"},
+		{"short identifiers", "Pod 12-34 restarted 3 times, error 500", "Pod 12-34 restarted 3 times, error 500"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, s.Scrub(tt.in))
+		})
+	}
+}
+
+func TestScrubEnabledDetectorsOnly(t *testing.T) {
+	s := NewScrubber(&config.Scrubbing{Enabled: true, Detectors: []string{config.SCRUB_DETECTOR_EMAIL}})
+
+	assert.Equal(t, "[email] paid with 4111 1111 1111 1111",
+		s.Scrub("jane@example.com paid with 4111 1111 1111 1111"))
+}
+
+func TestScrubFields(t *testing.T) {
+	s := NewScrubber(nil)
+	fields := map[string]string{
+		"input_severity":             "SEV1",
+		"input_incident_description": "jane@example.com cannot log in",
+	}
+
+	scrubbed := s.ScrubFields(fields)
+
+	assert.Equal(t, "SEV1", scrubbed["input_severity"])
+	assert.Equal(t, "[email] cannot log in", scrubbed["input_incident_description"])
+	// The reported fields are left untouched
+	assert.Equal(t, "jane@example.com cannot log in", fields["input_incident_description"])
+}
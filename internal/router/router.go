@@ -3,15 +3,27 @@
 package router
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/awslabs/aws-lambda-go-api-proxy/core"
 	"github.com/awslabs/aws-lambda-go-api-proxy/gorillamux"
 	"github.com/gorilla/mux"
 	"github.com/syltek/oncall-incident-reporter/internal/config"
+	"github.com/syltek/oncall-incident-reporter/internal/metrics"
 	"github.com/syltek/oncall-incident-reporter/internal/middleware"
+	"github.com/syltek/oncall-incident-reporter/internal/tracing"
 	"github.com/syltek/oncall-incident-reporter/pkg/logutil"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -21,13 +33,45 @@ type Handler interface {
 	HandleModalSubmission(w http.ResponseWriter, r *http.Request)
 }
 
+// InstallHandler defines the interface for handling the OAuth v2 install flow
+type InstallHandler interface {
+	HandleInstall(w http.ResponseWriter, r *http.Request)
+	HandleOAuthCallback(w http.ResponseWriter, r *http.Request)
+	HandleEvent(w http.ResponseWriter, r *http.Request)
+}
+
+// HealthHandler defines the interface for handling the health, readiness and version checks
+type HealthHandler interface {
+	HandleHealth(w http.ResponseWriter, r *http.Request)
+	HandleReady(w http.ResponseWriter, r *http.Request)
+	HandleVersion(w http.ResponseWriter, r *http.Request)
+}
+
+// Paths of the health endpoints
+const (
+	HealthPath  = "/healthz"
+	ReadyPath   = "/readyz"
+	VersionPath = "/version"
+	MetricsPath = "/metrics"
+)
+
 // Router wraps the mux.Router and provides additional functionality for
 // handling both HTTP and Lambda requests.
 type Router struct {
 	*mux.Router
-	config  *config.Config
-	handler Handler
-	adapter *gorillamux.GorillaMuxAdapter
+	// config is replaced when the configuration is reloaded
+	config    atomic.Pointer[config.Config]
+	validator *middleware.SlackSignatureValidator
+	handler   Handler
+	adapter   *gorillamux.GorillaMuxAdapter
+	// adapterV2 serves API Gateway HTTP API and Lambda Function URL events
+	adapterV2  *gorillamux.GorillaMuxAdapterV2
+	adapterALB *gorillamux.GorillaMuxAdapterALB
+	// logger logs the requests, logutil.Logger if nil
+	logger *zap.Logger
+	// tracing starts the spans of the requests, with the global tracer provider until
+	// UseTracerProvider is called
+	tracing mux.MiddlewareFunc
 }
 
 // NewRouter creates and configures a new Router instance with the provided configuration.
@@ -35,11 +79,13 @@ func NewRouter(handler Handler, config *config.Config) *Router {
 	r := &Router{
 		Router:  mux.NewRouter(),
 		handler: handler,
-		config:  config,
 	}
+	r.config.Store(config)
 
 	r.setupRoutes()
 	r.adapter = gorillamux.New(r.Router)
+	r.adapterV2 = gorillamux.NewV2(r.Router)
+	r.adapterALB = gorillamux.NewALB(r.Router)
 
 	return r
 }
@@ -47,37 +93,269 @@ func NewRouter(handler Handler, config *config.Config) *Router {
 // setupRoutes configures all routes and middleware for the application.
 func (r *Router) setupRoutes() {
 	// Add middleware
+	// Recover inside the request ID, so panics are logged with the ID and the trace
+	r.Use(r.withLogger)
+	r.tracing = otelmux.Middleware(r.serviceName())
+	r.Use(func(next http.Handler) http.Handler { return r.tracing(next) })
+	r.Use(middleware.RequestID)
 	r.Use(middleware.Recovery)
 	r.Use(middleware.Logging)
-	r.Use(middleware.ValidateSlackSignature)
 
 	// Configure routes from config
-	if r.config.Endpoints == nil {
+	cfg := r.config.Load()
+	if cfg.Endpoints == nil {
 		logutil.Error("Endpoints configuration is missing")
 		return
 	}
 
-	r.HandleFunc(r.config.Endpoints.SlackCommand, r.handler.HandleCommand).
+	// Requests from Slack must be signed
+	slackRoutes := r.NewRoute().Subrouter()
+	r.validator = middleware.NewSlackSignatureValidator(cfg.SlackConfig.ActiveSigningSecrets(), signatureOptions(cfg))
+	slackRoutes.Use(r.validator.Middleware)
+
+	slackRoutes.HandleFunc(cfg.Endpoints.SlackCommand, r.handler.HandleCommand).
+		Methods(http.MethodPost)
+	slackRoutes.HandleFunc(cfg.Endpoints.SlackModalParser, r.handler.HandleModalSubmission).
 		Methods(http.MethodPost)
-	r.HandleFunc(r.config.Endpoints.SlackModalParser, r.handler.HandleModalSubmission).
+}
+
+// HandleInstallation adds the routes of the OAuth v2 install flow. They are visited by users'
+// browsers, not Slack, so they are not signed. The events route is called by Slack and is.
+func (r *Router) HandleInstallation(install InstallHandler) {
+	cfg := r.config.Load()
+	if cfg.OAuth == nil {
+		return
+	}
+	r.HandleFunc(cfg.OAuth.InstallPath, install.HandleInstall).
+		Methods(http.MethodGet)
+	r.HandleFunc(cfg.OAuth.CallbackPath, install.HandleOAuthCallback).
+		Methods(http.MethodGet)
+
+	if r.validator == nil {
+		return
+	}
+	eventRoutes := r.NewRoute().Subrouter()
+	eventRoutes.Use(r.validator.Middleware)
+	eventRoutes.HandleFunc(cfg.OAuth.EventsPath, install.HandleEvent).
 		Methods(http.MethodPost)
 }
 
-// LambdaHandler handles requests from AWS Lambda.
-func (r *Router) LambdaHandler(req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	logutil.Debug("Starting LambdaHandler")
-	logutil.Debug("Request", zap.Any("request", req))
+// HandleHealthChecks adds the health, readiness and version routes. They are called by load
+// balancers and orchestrators, not Slack, so they are not signed.
+func (r *Router) HandleHealthChecks(health HealthHandler) {
+	routes := r.NewRoute().Subrouter()
+	addLivenessRoutes(routes, health)
+	addReadinessRoute(routes, health)
+}
+
+// HandleLivenessChecks adds the health and version routes only. The readiness route calls
+// Slack, Datadog and the stores, it is left out where nothing probes it, e.g. in Lambda.
+func (r *Router) HandleLivenessChecks(health HealthHandler) {
+	addLivenessRoutes(r.NewRoute().Subrouter(), health)
+}
+
+// UseLogger logs the requests, and what is logged while handling them, with the logger
+func (r *Router) UseLogger(logger *zap.Logger) {
+	r.logger = logger
+}
+
+// UseTracerProvider records the spans of the requests with the provider
+func (r *Router) UseTracerProvider(provider trace.TracerProvider) {
+	r.tracing = otelmux.Middleware(r.serviceName(),
+		otelmux.WithTracerProvider(provider),
+		otelmux.WithPropagators(tracing.Propagator()))
+}
+
+// withLogger attaches the logger of the router to the requests. It is looked up per request, the
+// middleware is set up before the logger is known.
+func (r *Router) withLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		middleware.WithLogger(r.logger)(next).ServeHTTP(w, req)
+	})
+}
+
+// UseMetrics records the count and latency of the requests of every route
+func (r *Router) UseMetrics(recorder metrics.Recorder) {
+	r.Use(middleware.Metrics(recorder))
+}
+
+// HandleMetrics adds the route scraped by Prometheus. It is not signed.
+func (r *Router) HandleMetrics(metricsHandler http.Handler) {
+	r.Handle(MetricsPath, metricsHandler).Methods(http.MethodGet)
+}
+
+// HandleAuditExport adds the route exporting the audit trail. It is protected by its own token,
+// not signed.
+func (r *Router) HandleAuditExport(path string, export http.Handler) {
+	r.Handle(path, export).Methods(http.MethodGet)
+}
+
+// NewAdminRouter creates the router of the admin listener, serving the health checks and the
+// metrics, if any, apart from the public Slack routes. The requests are logged with the logger,
+// logutil.Logger if nil.
+func NewAdminRouter(health HealthHandler, metricsHandler http.Handler, logger *zap.Logger) *mux.Router {
+	r := mux.NewRouter()
+	r.Use(middleware.WithLogger(logger))
+	r.Use(middleware.Recovery)
+	addLivenessRoutes(r, health)
+	addReadinessRoute(r, health)
+	if metricsHandler != nil {
+		r.Handle(MetricsPath, metricsHandler).Methods(http.MethodGet)
+	}
+	return r
+}
+
+func addLivenessRoutes(r *mux.Router, health HealthHandler) {
+	r.HandleFunc(HealthPath, health.HandleHealth).
+		Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc(VersionPath, health.HandleVersion).
+		Methods(http.MethodGet)
+}
+
+func addReadinessRoute(r *mux.Router, health HealthHandler) {
+	r.HandleFunc(ReadyPath, health.HandleReady).
+		Methods(http.MethodGet, http.MethodHead)
+}
+
+// serviceName names the server in the spans of the requests
+func (r *Router) serviceName() string {
+	cfg := r.config.Load()
+	if cfg.Metadata == nil || cfg.Metadata.Service == "" {
+		return tracing.InstrumentationName
+	}
+	return cfg.Metadata.Service
+}
+
+// signatureOptions returns the Slack signature validation options from the configuration
+func signatureOptions(cfg *config.Config) middleware.SlackSignatureOptions {
+	var opts middleware.SlackSignatureOptions
+	if cfg.SlackConfig != nil {
+		opts.MaxRequestAge = time.Duration(cfg.SlackConfig.RequestMaxAge) * time.Second
+	}
+	return opts
+}
+
+// ApplyConfig replaces the configuration of the router when it is reloaded. The signing
+// secrets take effect at once. Routes are only set up at startup, a configuration changing
+// them is rejected.
+func (r *Router) ApplyConfig(next *config.Config) error {
+	current := r.config.Load()
+	if !reflect.DeepEqual(current.Endpoints, next.Endpoints) {
+		return fmt.Errorf("endpoints changed, a restart is needed")
+	}
+	if next.OAuthEnabled() != current.OAuthEnabled() ||
+		next.OAuthEnabled() && (next.OAuth.InstallPath != current.OAuth.InstallPath || next.OAuth.CallbackPath != current.OAuth.CallbackPath ||
+			next.OAuth.EventsPath != current.OAuth.EventsPath) {
+		return fmt.Errorf("oauth install routes changed, a restart is needed")
+	}
+
+	if r.validator != nil {
+		r.validator.Configure(next.SlackConfig.ActiveSigningSecrets(), signatureOptions(next).MaxRequestAge)
+	}
+	r.config.Store(next)
+	return nil
+}
+
+// Shapes of the Lambda events carrying an HTTP request
+const (
+	EventAPIGatewayV1 = "api_gateway_v1"
+	EventAPIGatewayV2 = "api_gateway_v2"
+	EventFunctionURL  = "function_url"
+	EventALB          = "alb"
+)
+
+// DetectEventShape tells which service invoked the function from the shape of the event:
+// API Gateway REST API (payload v1), API Gateway HTTP API (payload v2), a Lambda Function URL
+// (same payload as v2) or an Application Load Balancer target group.
+func DetectEventShape(payload []byte) (string, error) {
+	var probe struct {
+		Version        string `json:"version"`
+		HTTPMethod     string `json:"httpMethod"`
+		RequestContext struct {
+			ELB        json.RawMessage `json:"elb"`
+			APIID      string          `json:"apiId"`
+			DomainName string          `json:"domainName"`
+			HTTP       json.RawMessage `json:"http"`
+		} `json:"requestContext"`
+	}
+	if err := json.Unmarshal(payload, &probe); err != nil {
+		return "", fmt.Errorf("decode event: %w", err)
+	}
+
+	switch {
+	case len(probe.RequestContext.ELB) > 0:
+		return EventALB, nil
+	case probe.Version == "2.0" || len(probe.RequestContext.HTTP) > 0:
+		if strings.Contains(probe.RequestContext.DomainName, ".lambda-url.") {
+			return EventFunctionURL, nil
+		}
+		return EventAPIGatewayV2, nil
+	case probe.HTTPMethod != "":
+		return EventAPIGatewayV1, nil
+	default:
+		return "", fmt.Errorf("unsupported event, expected an API Gateway, Function URL or ALB request")
+	}
+}
+
+// LambdaHandler handles requests from AWS Lambda, whatever the service that invoked the
+// function, and responds with the matching response shape.
+func (r *Router) LambdaHandler(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	// The Lambda request ID correlates the lines logged before and after the HTTP request
+	if lambda, ok := lambdacontext.FromContext(ctx); ok {
+		ctx = logutil.WithFields(ctx, zap.String(logutil.FieldRequestID, lambda.AwsRequestID))
+	}
+	logutil.DebugCtx(ctx, "Starting LambdaHandler")
 
-	switchableReq := *core.NewSwitchableAPIGatewayRequestV1(&req)
-	resp, err := r.adapter.Proxy(switchableReq)
+	shape, err := DetectEventShape(payload)
 	if err != nil {
-		logutil.Error("Error proxying request", zap.Error(err))
-		return events.APIGatewayProxyResponse{}, err
+		logutil.ErrorCtx(ctx, "Unsupported Lambda event", zap.Error(err))
+		return nil, err
 	}
+	logutil.DebugCtx(ctx, "Request", zap.String("event_shape", shape), zap.ByteString("request", payload))
+
+	switch shape {
+	case EventALB:
+		var req events.ALBTargetGroupRequest
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, fmt.Errorf("decode ALB event: %w", err)
+		}
+		resp, err := r.adapterALB.ProxyWithContext(ctx, req)
+		if err != nil {
+			logutil.ErrorCtx(ctx, "Error proxying request", zap.Error(err))
+			return events.ALBTargetGroupResponse{}, err
+		}
+		logutil.InfoCtx(ctx, "Response", zap.String("event_shape", shape), zap.Any("response", resp))
+		return resp, nil
 
-	// Convert to Version1 before logging to see the actual response contents
-	v1Response := resp.Version1()
-	logutil.Info("Response", zap.Any("response", *v1Response))
+	case EventAPIGatewayV2, EventFunctionURL:
+		// Function URL events and responses have the same format as the HTTP API payload v2
+		var req events.APIGatewayV2HTTPRequest
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, fmt.Errorf("decode %s event: %w", shape, err)
+		}
+		resp, err := r.adapterV2.ProxyWithContext(ctx, req)
+		if err != nil {
+			logutil.ErrorCtx(ctx, "Error proxying request", zap.Error(err))
+			return events.APIGatewayV2HTTPResponse{}, err
+		}
+		logutil.InfoCtx(ctx, "Response", zap.String("event_shape", shape), zap.Any("response", resp))
+		return resp, nil
 
-	return *v1Response, nil
+	default:
+		var req events.APIGatewayProxyRequest
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, fmt.Errorf("decode API Gateway event: %w", err)
+		}
+		switchableReq := *core.NewSwitchableAPIGatewayRequestV1(&req)
+		resp, err := r.adapter.ProxyWithContext(ctx, switchableReq)
+		if err != nil {
+			logutil.ErrorCtx(ctx, "Error proxying request", zap.Error(err))
+			return events.APIGatewayProxyResponse{}, err
+		}
+
+		// Convert to Version1 before logging to see the actual response contents
+		v1Response := resp.Version1()
+		logutil.InfoCtx(ctx, "Response", zap.String("event_shape", shape), zap.Any("response", *v1Response))
+		return *v1Response, nil
+	}
 }
@@ -0,0 +1,215 @@
+package router
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+	"github.com/syltek/oncall-incident-reporter/internal/health"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const (
+	testSigningSecret = "test-signing-secret"
+	testBody          = "command=%2Fincident&trigger_id=123"
+)
+
+// echoHandler answers slash commands with the trigger ID of the request
+type echoHandler struct{}
+
+func (echoHandler) HandleCommand(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("trigger " + r.FormValue("trigger_id")))
+}
+
+func (echoHandler) HandleModalSubmission(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func newTestRouter() *Router {
+	return NewRouter(echoHandler{}, &config.Config{
+		SlackConfig: &config.SlackConfig{SigningSecret: testSigningSecret},
+		Endpoints: &config.Endpoints{
+			SlackCommand:     "/incident",
+			SlackModalParser: "/modal",
+		},
+	})
+}
+
+// loadEvent reads an event fixture, signed for the current time
+func loadEvent(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name+".json"))
+	require.NoError(t, err)
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(testSigningSecret))
+	mac.Write([]byte("v0:" + timestamp + ":" + testBody))
+
+	return []byte(strings.NewReplacer(
+		"__TIMESTAMP__", timestamp,
+		"__SIGNATURE__", "v0="+hex.EncodeToString(mac.Sum(nil)),
+		"__BASE64_BODY__", base64.StdEncoding.EncodeToString([]byte(testBody)),
+		"__BODY__", testBody,
+	).Replace(string(data)))
+}
+
+func TestDetectEventShape(t *testing.T) {
+	for _, shape := range []string{EventAPIGatewayV1, EventAPIGatewayV2, EventFunctionURL, EventALB} {
+		t.Run(shape, func(t *testing.T) {
+			got, err := DetectEventShape(loadEvent(t, shape))
+			require.NoError(t, err)
+			assert.Equal(t, shape, got)
+		})
+	}
+
+	_, err := DetectEventShape([]byte(`{"Records":[{"eventSource":"aws:sqs"}]}`))
+	assert.Error(t, err)
+}
+
+func TestLambdaHandler(t *testing.T) {
+	tests := []struct {
+		shape  string
+		status func(resp interface{}) (int, string)
+	}{
+		{EventAPIGatewayV1, func(resp interface{}) (int, string) {
+			v1 := resp.(events.APIGatewayProxyResponse)
+			return v1.StatusCode, v1.Body
+		}},
+		{EventAPIGatewayV2, func(resp interface{}) (int, string) {
+			v2 := resp.(events.APIGatewayV2HTTPResponse)
+			return v2.StatusCode, v2.Body
+		}},
+		{EventFunctionURL, func(resp interface{}) (int, string) {
+			v2 := resp.(events.APIGatewayV2HTTPResponse)
+			return v2.StatusCode, v2.Body
+		}},
+		{EventALB, func(resp interface{}) (int, string) {
+			alb := resp.(events.ALBTargetGroupResponse)
+			return alb.StatusCode, alb.Body
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.shape, func(t *testing.T) {
+			// Each router has its own replay cache, the fixtures carry the same signature
+			r := newTestRouter()
+			resp, err := r.LambdaHandler(context.Background(), loadEvent(t, tt.shape))
+			require.NoError(t, err)
+			status, body := tt.status(resp)
+			assert.Equal(t, http.StatusOK, status)
+			assert.Equal(t, "trigger 123", body)
+		})
+	}
+}
+
+func TestLambdaHandlerRejectsUnsignedRequests(t *testing.T) {
+	r := newTestRouter()
+	payload := strings.ReplaceAll(string(loadEvent(t, EventALB)), "x-slack-signature", "x-other")
+
+	resp, err := r.LambdaHandler(context.Background(), []byte(payload))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.(events.ALBTargetGroupResponse).StatusCode)
+}
+
+func TestHealthRoutesAreNotSigned(t *testing.T) {
+	r := newTestRouter()
+	r.HandleHealthChecks(health.NewHandler())
+
+	for _, path := range []string{HealthPath, ReadyPath, VersionPath} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+	}
+
+	// Slack routes still require a signature
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/incident", strings.NewReader(testBody)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestLivenessChecksLeaveOutReadiness(t *testing.T) {
+	r := newTestRouter()
+	r.HandleLivenessChecks(health.NewHandler())
+
+	for path, want := range map[string]int{HealthPath: http.StatusOK, VersionPath: http.StatusOK, ReadyPath: http.StatusNotFound} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, want, rec.Code, path)
+	}
+}
+
+func TestRoutesAreTraced(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	r := newTestRouter()
+	r.HandleHealthChecks(health.NewHandler())
+
+	// The trace started by the caller is continued
+	req := httptest.NewRequest(http.MethodGet, HealthPath, nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, HealthPath, spans[0].Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+}
+
+func TestApplyConfigRotatesSigningSecret(t *testing.T) {
+	signedRequest := func(secret string) *http.Request {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte("v0:" + timestamp + ":" + testBody))
+		req := httptest.NewRequest(http.MethodPost, "/incident", strings.NewReader(testBody))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+		req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+		return req
+	}
+	serve := func(r *Router, req *http.Request) int {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	r := newTestRouter()
+	require.NoError(t, r.ApplyConfig(&config.Config{
+		SlackConfig: &config.SlackConfig{SigningSecret: "new-signing-secret"},
+		Endpoints:   &config.Endpoints{SlackCommand: "/incident", SlackModalParser: "/modal"},
+	}))
+	assert.Equal(t, http.StatusOK, serve(r, signedRequest("new-signing-secret")))
+	assert.Equal(t, http.StatusUnauthorized, serve(r, signedRequest(testSigningSecret)))
+
+	// Routes are set up at startup only
+	err := r.ApplyConfig(&config.Config{
+		SlackConfig: &config.SlackConfig{SigningSecret: testSigningSecret},
+		Endpoints:   &config.Endpoints{SlackCommand: "/report", SlackModalParser: "/modal"},
+	})
+	assert.ErrorContains(t, err, "restart")
+	assert.Equal(t, http.StatusUnauthorized, serve(r, signedRequest(testSigningSecret)))
+}
@@ -0,0 +1,189 @@
+// Package server runs the application as a long-running HTTP server, for container deployments
+// and local development.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+	"github.com/syltek/oncall-incident-reporter/pkg/logutil"
+	"go.uber.org/zap"
+)
+
+// Server serves the application and, optionally, the admin endpoints on a separate listener
+type Server struct {
+	config *config.Server
+	http   *http.Server
+	admin  *http.Server
+	certs  *CertReloader
+	hooks  []func() error
+
+	listener      net.Listener
+	adminListener net.Listener
+}
+
+// New creates a Server serving handler on the configured address and adminHandler on the admin
+// address, if both are set
+func New(cfg *config.Server, handler, adminHandler http.Handler) (*Server, error) {
+	s := &Server{
+		config: cfg,
+		http:   newHTTPServer(cfg, cfg.Address, handler),
+	}
+
+	if cfg.TLS != nil && cfg.TLS.Enabled {
+		certs, err := NewCertReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		s.certs = certs
+		s.http.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
+		}
+	}
+
+	// The admin listener is for probes inside the cluster, it is not served over TLS
+	if cfg.AdminAddress != "" && adminHandler != nil {
+		s.admin = newHTTPServer(cfg, cfg.AdminAddress, adminHandler)
+	}
+	return s, nil
+}
+
+func newHTTPServer(cfg *config.Server, addr string, handler http.Handler) *http.Server {
+	readHeaderTimeout := cfg.ReadHeaderTimeout
+	if readHeaderTimeout == 0 {
+		readHeaderTimeout = cfg.ReadTimeout
+	}
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       time.Duration(cfg.ReadTimeout) * time.Second,
+		ReadHeaderTimeout: time.Duration(readHeaderTimeout) * time.Second,
+		WriteTimeout:      time.Duration(cfg.WriteTimeout) * time.Second,
+		IdleTimeout:       time.Duration(cfg.IdleTimeout) * time.Second,
+	}
+}
+
+// OnReload adds a function called when the server receives SIGHUP, after the TLS certificate
+// is reloaded
+func (s *Server) OnReload(hook func() error) {
+	s.hooks = append(s.hooks, hook)
+}
+
+// Run serves until the context is cancelled, then shuts the listeners down gracefully
+func (s *Server) Run(ctx context.Context) error {
+	if err := s.listen(); err != nil {
+		return err
+	}
+	return s.serve(ctx)
+}
+
+// Reload reloads the TLS certificate and calls the reload hooks. Failures are logged, the
+// server keeps running with what it had.
+func (s *Server) Reload(ctx context.Context) {
+	logutil.InfoCtx(ctx, "Reloading")
+	if s.certs != nil {
+		if err := s.certs.Reload(); err != nil {
+			logutil.ErrorCtx(ctx, "Failed to reload TLS certificate", zap.Error(err))
+		}
+	}
+	for _, hook := range s.hooks {
+		if err := hook(); err != nil {
+			logutil.ErrorCtx(ctx, "Failed to reload", zap.Error(err))
+		}
+	}
+}
+
+func (s *Server) listen() error {
+	var err error
+	if s.listener, err = net.Listen("tcp", s.http.Addr); err != nil {
+		return fmt.Errorf("listen on %s: %w", s.http.Addr, err)
+	}
+	if s.admin != nil {
+		if s.adminListener, err = net.Listen("tcp", s.admin.Addr); err != nil {
+			s.listener.Close()
+			return fmt.Errorf("listen on admin address %s: %w", s.admin.Addr, err)
+		}
+	}
+	return nil
+}
+
+func (s *Server) serve(ctx context.Context) error {
+	errs := make(chan error, 2)
+	go func() {
+		logutil.InfoCtx(ctx, "Starting server",
+			zap.String("address", s.listener.Addr().String()),
+			zap.Bool("tls", s.certs != nil))
+		var err error
+		if s.certs != nil {
+			err = s.http.ServeTLS(s.listener, "", "")
+		} else {
+			err = s.http.Serve(s.listener)
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			errs <- fmt.Errorf("server error: %w", err)
+		}
+	}()
+	if s.admin != nil {
+		go func() {
+			logutil.InfoCtx(ctx, "Starting admin server", zap.String("address", s.adminListener.Addr().String()))
+			if err := s.admin.Serve(s.adminListener); !errors.Is(err, http.ErrServerClosed) {
+				errs <- fmt.Errorf("admin server error: %w", err)
+			}
+		}()
+	}
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+
+	var certCheck <-chan time.Time
+	if s.certs != nil && s.config.TLS.ReloadInterval > 0 {
+		ticker := time.NewTicker(time.Duration(s.config.TLS.ReloadInterval) * time.Second)
+		defer ticker.Stop()
+		certCheck = ticker.C
+	}
+
+	for {
+		select {
+		case err := <-errs:
+			s.shutdown()
+			return err
+		case <-reload:
+			s.Reload(ctx)
+		case <-certCheck:
+			if err := s.certs.ReloadIfChanged(); err != nil {
+				logutil.ErrorCtx(ctx, "Failed to reload TLS certificate", zap.Error(err))
+			}
+		case <-ctx.Done():
+			logutil.InfoCtx(ctx, "Starting shutdown")
+			return s.shutdown()
+		}
+	}
+}
+
+// shutdown gives outstanding requests until the shutdown timeout to complete
+func (s *Server) shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.config.ShutdownTimeout)*time.Second)
+	defer cancel()
+
+	var errs []error
+	if err := s.http.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("graceful shutdown failed: %w", err))
+	}
+	if s.admin != nil {
+		if err := s.admin.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("admin graceful shutdown failed: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+)
+
+// writeCert writes a self-signed certificate for localhost with the given common name
+func writeCert(t *testing.T, dir, commonName string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, "tls.crt")
+	keyFile = filepath.Join(dir, "tls.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func commonName(t *testing.T, c *CertReloader) string {
+	t.Helper()
+	cert, err := c.GetCertificate(nil)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "first")
+
+	certs, err := NewCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, "first", commonName(t, certs))
+
+	// Unchanged files are not reloaded
+	require.NoError(t, certs.ReloadIfChanged())
+	assert.Equal(t, "first", commonName(t, certs))
+
+	writeCert(t, dir, "second")
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+	require.NoError(t, certs.ReloadIfChanged())
+	assert.Equal(t, "second", commonName(t, certs))
+
+	// A broken certificate keeps the current one
+	require.NoError(t, os.WriteFile(certFile, []byte("not a certificate"), 0o600))
+	assert.Error(t, certs.Reload())
+	assert.Equal(t, "second", commonName(t, certs))
+}
+
+func TestNewWithMissingCertificate(t *testing.T) {
+	_, err := New(&config.Server{
+		Address: "127.0.0.1:0",
+		TLS:     &config.TLS{Enabled: true, CertFile: "missing.crt", KeyFile: "missing.key"},
+	}, http.NotFoundHandler(), nil)
+	assert.Error(t, err)
+}
+
+func get(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+	resp, err := client.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestServerWithTLSAndAdminListener(t *testing.T) {
+	certFile, keyFile := writeCert(t, t.TempDir(), "localhost")
+	app := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.Write([]byte("app")) })
+	admin := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.Write([]byte("admin")) })
+
+	srv, err := New(&config.Server{
+		Address:         "127.0.0.1:0",
+		AdminAddress:    "127.0.0.1:0",
+		ReadTimeout:     5,
+		WriteTimeout:    5,
+		ShutdownTimeout: 5,
+		TLS:             &config.TLS{Enabled: true, CertFile: certFile, KeyFile: keyFile},
+	}, app, admin)
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, srv.http.ReadHeaderTimeout)
+
+	require.NoError(t, srv.listen())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.serve(ctx) }()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	assert.Equal(t, "app", get(t, client, "https://"+srv.listener.Addr().String()))
+	assert.Equal(t, "admin", get(t, http.DefaultClient, "http://"+srv.adminListener.Addr().String()))
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+}
+
+func TestReloadCallsHooks(t *testing.T) {
+	srv, err := New(&config.Server{Address: "127.0.0.1:0"}, http.NotFoundHandler(), nil)
+	require.NoError(t, err)
+
+	var calls int
+	srv.OnReload(func() error {
+		calls++
+		return errors.New("invalid configuration")
+	})
+	srv.OnReload(func() error {
+		calls++
+		return nil
+	})
+
+	srv.Reload(context.Background())
+	assert.Equal(t, 2, calls)
+}
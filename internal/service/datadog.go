@@ -6,24 +6,98 @@ import (
 	"net/http"
 
 	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+	"github.com/syltek/oncall-incident-reporter/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type IDatadogEventsAPI interface {
 	CreateEvent(ctx context.Context, body datadogV1.EventCreateRequest) (datadogV1.EventCreateResponse, *http.Response, error)
 }
 
+type IDatadogMonitorsAPI interface {
+	ListMonitors(ctx context.Context, o ...datadogV1.ListMonitorsOptionalParameters) ([]datadogV1.Monitor, *http.Response, error)
+}
+
+type IDatadogAuthenticationAPI interface {
+	Validate(ctx context.Context) (datadogV1.AuthenticationValidationResponse, *http.Response, error)
+}
+
 type DatadogService struct {
-	client IDatadogEventsAPI
+	client   IDatadogEventsAPI
+	monitors IDatadogMonitorsAPI
+	auth     IDatadogAuthenticationAPI
+	retry    RetryPolicy
+}
+
+func NewDatadogService(client IDatadogEventsAPI, monitors IDatadogMonitorsAPI, retry RetryPolicy) *DatadogService {
+	return &DatadogService{client: client, monitors: monitors, retry: retry}
 }
 
-func NewDatadogService(client IDatadogEventsAPI) *DatadogService {
-	return &DatadogService{client: client}
+// WithAuthentication lets the service validate its API key, see Validate
+func (c *DatadogService) WithAuthentication(auth IDatadogAuthenticationAPI) *DatadogService {
+	c.auth = auth
+	return c
+}
+
+// Validate checks that Datadog is reachable and accepts the API key of the service
+func (c *DatadogService) Validate(ctx context.Context) (err error) {
+	if c.auth == nil {
+		return fmt.Errorf("datadog authentication API not configured")
+	}
+	ctx, span := tracing.Start(ctx, "datadog.Validate")
+	defer func() { tracing.End(span, err) }()
+	resp, _, err := c.auth.Validate(ctx)
+	if err != nil {
+		return fmt.Errorf("datadog validate: %w", err)
+	}
+	if !resp.GetValid() {
+		return fmt.Errorf("datadog API key is not valid")
+	}
+	return nil
 }
 
+// CreateEvent creates a Datadog event, retrying on rate limiting and server errors
 func (c *DatadogService) CreateEvent(ctx context.Context, event datadogV1.EventCreateRequest) (*datadogV1.EventCreateResponse, error) {
-	resp, _, err := c.client.CreateEvent(ctx, event)
+	var resp datadogV1.EventCreateResponse
+	err := c.retry.Do(ctx, "datadog.CreateEvent", func(ctx context.Context, attempt int) (err error) {
+		ctx, span := tracing.Start(ctx, "datadog.CreateEvent", attribute.Int("retry.attempt", attempt))
+		defer func() { tracing.End(span, err) }()
+
+		var httpResp *http.Response
+		resp, httpResp, err = c.client.CreateEvent(ctx, event)
+		if err != nil {
+			return newStatusError(httpResp, err)
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create event: %w", err)
 	}
 	return &resp, nil
 }
+
+// ListAlertingMonitors returns the monitors tagged with monitorTag that are currently in Alert state
+func (c *DatadogService) ListAlertingMonitors(ctx context.Context, monitorTag string) (_ []datadogV1.Monitor, err error) {
+	if c.monitors == nil {
+		return nil, nil
+	}
+	ctx, span := tracing.Start(ctx, "datadog.ListMonitors", attribute.String("datadog.monitor_tag", monitorTag))
+	defer func() { tracing.End(span, err) }()
+
+	params := datadogV1.NewListMonitorsOptionalParameters().
+		WithMonitorTags(monitorTag).
+		WithGroupStates("alert")
+
+	monitors, _, err := c.monitors.ListMonitors(ctx, *params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list monitors: %w", err)
+	}
+
+	alerting := make([]datadogV1.Monitor, 0, len(monitors))
+	for _, monitor := range monitors {
+		if monitor.GetOverallState() == datadogV1.MONITOROVERALLSTATES_ALERT {
+			alerting = append(alerting, monitor)
+		}
+	}
+	return alerting, nil
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// monitorsAPI returns its monitors and records the filters it was called with
+type monitorsAPI struct {
+	monitors []datadogV1.Monitor
+	err      error
+	params   []datadogV1.ListMonitorsOptionalParameters
+}
+
+func (m *monitorsAPI) ListMonitors(_ context.Context, o ...datadogV1.ListMonitorsOptionalParameters) ([]datadogV1.Monitor, *http.Response, error) {
+	m.params = append(m.params, o...)
+	return m.monitors, nil, m.err
+}
+
+func newMonitor(id int64, name string, state datadogV1.MonitorOverallStates) datadogV1.Monitor {
+	monitor := datadogV1.Monitor{}
+	monitor.SetId(id)
+	monitor.SetName(name)
+	monitor.SetOverallState(state)
+	return monitor
+}
+
+func TestListAlertingMonitors(t *testing.T) {
+	api := &monitorsAPI{monitors: []datadogV1.Monitor{
+		newMonitor(1, "Payments error rate", datadogV1.MONITOROVERALLSTATES_ALERT),
+		newMonitor(2, "Payments latency", datadogV1.MONITOROVERALLSTATES_WARN),
+		newMonitor(3, "Payments saturation", datadogV1.MONITOROVERALLSTATES_OK),
+	}}
+	svc := NewDatadogService(nil, api, NoRetryPolicy())
+
+	monitors, err := svc.ListAlertingMonitors(context.Background(), "domain:payments")
+	require.NoError(t, err)
+	require.Len(t, monitors, 1)
+	assert.Equal(t, "Payments error rate", monitors[0].GetName())
+
+	// Datadog is asked for the tagged monitors with a group in Alert
+	require.Len(t, api.params, 1)
+	assert.Equal(t, "domain:payments", *api.params[0].MonitorTags)
+	assert.Equal(t, "alert", *api.params[0].GroupStates)
+
+	api.err = errors.New("forbidden")
+	_, err = svc.ListAlertingMonitors(context.Background(), "domain:payments")
+	assert.ErrorContains(t, err, "forbidden")
+
+	// Without a monitors API there is nothing to look up
+	monitors, err = NewDatadogService(nil, nil, NoRetryPolicy()).ListAlertingMonitors(context.Background(), "domain:payments")
+	require.NoError(t, err)
+	assert.Empty(t, monitors)
+}
@@ -0,0 +1,220 @@
+// Package fake provides Slack and Datadog clients that record what they are sent instead of
+// calling the APIs, to run the application without credentials, e.g. in tests or to simulate
+// the submission of an incident.
+package fake
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+	"github.com/slack-go/slack"
+)
+
+// Message is a message sent to Slack
+type Message struct {
+	Channel string
+	// User is the recipient of an ephemeral message
+	User      string
+	Timestamp string
+	Text      string
+	// Blocks is the JSON of the message blocks, if any
+	Blocks string
+}
+
+// SlackClient is a Slack client recording the views opened and the messages posted, updated or
+// sent as ephemeral messages. It implements service.ISlackClient.
+type SlackClient struct {
+	// UserGroups are the members of the user groups, keyed by user group ID
+	UserGroups map[string][]string
+	// Err, if set, is returned by every call
+	Err error
+
+	mu         sync.Mutex
+	views      []slack.ModalViewRequest
+	messages   []Message
+	updates    []Message
+	ephemerals []Message
+	sequence   int
+}
+
+// NewSlackClient creates a SlackClient
+func NewSlackClient() *SlackClient {
+	return &SlackClient{}
+}
+
+func (c *SlackClient) OpenViewContext(_ context.Context, _ string, view slack.ModalViewRequest) (*slack.ViewResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	c.views = append(c.views, view)
+	return &slack.ViewResponse{}, nil
+}
+
+func (c *SlackClient) PostMessageContext(_ context.Context, channelID string, options ...slack.MsgOption) (string, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return "", "", c.Err
+	}
+	message, err := c.message(channelID, "", options)
+	if err != nil {
+		return "", "", err
+	}
+	c.messages = append(c.messages, message)
+	return channelID, message.Timestamp, nil
+}
+
+func (c *SlackClient) UpdateMessageContext(_ context.Context, channelID, timestamp string, options ...slack.MsgOption) (string, string, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return "", "", "", c.Err
+	}
+	message, err := c.message(channelID, "", options)
+	if err != nil {
+		return "", "", "", err
+	}
+	message.Timestamp = timestamp
+	c.updates = append(c.updates, message)
+	return channelID, timestamp, message.Text, nil
+}
+
+// GetConversationHistoryContext returns no messages, the posted messages are never looked up
+func (c *SlackClient) GetConversationHistoryContext(context.Context, *slack.GetConversationHistoryParameters) (*slack.GetConversationHistoryResponse, error) {
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	return &slack.GetConversationHistoryResponse{}, nil
+}
+
+func (c *SlackClient) PostEphemeralContext(_ context.Context, channelID, userID string, options ...slack.MsgOption) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return "", c.Err
+	}
+	message, err := c.message(channelID, userID, options)
+	if err != nil {
+		return "", err
+	}
+	c.ephemerals = append(c.ephemerals, message)
+	return message.Timestamp, nil
+}
+
+func (c *SlackClient) GetUserGroupMembersContext(_ context.Context, userGroup string) ([]string, error) {
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	return c.UserGroups[userGroup], nil
+}
+
+func (c *SlackClient) AuthTestContext(context.Context) (*slack.AuthTestResponse, error) {
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	return &slack.AuthTestResponse{Team: "fake", User: "fake"}, nil
+}
+
+// Views returns the views opened
+func (c *SlackClient) Views() []slack.ModalViewRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]slack.ModalViewRequest(nil), c.views...)
+}
+
+// Messages returns the messages posted, direct messages included
+func (c *SlackClient) Messages() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Message(nil), c.messages...)
+}
+
+// Updates returns the messages updated, with their new content
+func (c *SlackClient) Updates() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Message(nil), c.updates...)
+}
+
+// Ephemerals returns the ephemeral messages sent
+func (c *SlackClient) Ephemerals() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Message(nil), c.ephemerals...)
+}
+
+// message decodes the options of a message the way the Slack client would send them
+func (c *SlackClient) message(channelID, userID string, options []slack.MsgOption) (Message, error) {
+	_, values, err := slack.UnsafeApplyMsgOptions("", channelID, "", options...)
+	if err != nil {
+		return Message{}, fmt.Errorf("invalid message options: %w", err)
+	}
+	c.sequence++
+	return Message{
+		Channel:   channelID,
+		User:      userID,
+		Timestamp: fmt.Sprintf("1700000000.%06d", c.sequence),
+		Text:      values.Get("text"),
+		Blocks:    values.Get("blocks"),
+	}, nil
+}
+
+// DatadogClient is a Datadog client recording the events created. It implements the events,
+// monitors and authentication APIs of service.DatadogService.
+type DatadogClient struct {
+	// Monitors are returned by ListMonitors, whatever the filters
+	Monitors []datadogV1.Monitor
+	// Err, if set, is returned by every call
+	Err error
+
+	mu     sync.Mutex
+	events []datadogV1.EventCreateRequest
+}
+
+// NewDatadogClient creates a DatadogClient
+func NewDatadogClient() *DatadogClient {
+	return &DatadogClient{}
+}
+
+func (c *DatadogClient) CreateEvent(_ context.Context, body datadogV1.EventCreateRequest) (datadogV1.EventCreateResponse, *http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Err != nil {
+		return datadogV1.EventCreateResponse{}, nil, c.Err
+	}
+	c.events = append(c.events, body)
+
+	id := int64(len(c.events))
+	event := datadogV1.Event{Id: &id}
+	event.SetUrl(fmt.Sprintf("https://app.datadoghq.com/event/event?id=%d", id))
+	response := datadogV1.EventCreateResponse{Event: &event}
+	response.SetStatus("ok")
+	return response, nil, nil
+}
+
+func (c *DatadogClient) ListMonitors(context.Context, ...datadogV1.ListMonitorsOptionalParameters) ([]datadogV1.Monitor, *http.Response, error) {
+	if c.Err != nil {
+		return nil, nil, c.Err
+	}
+	return c.Monitors, nil, nil
+}
+
+func (c *DatadogClient) Validate(context.Context) (datadogV1.AuthenticationValidationResponse, *http.Response, error) {
+	if c.Err != nil {
+		return datadogV1.AuthenticationValidationResponse{}, nil, c.Err
+	}
+	valid := true
+	return datadogV1.AuthenticationValidationResponse{Valid: &valid}, nil, nil
+}
+
+// Events returns the events created
+func (c *DatadogClient) Events() []datadogV1.EventCreateRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]datadogV1.EventCreateRequest(nil), c.events...)
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// idempotencyCache remembers the result of operations by idempotency key for a limited time
+type idempotencyCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]idempotencyEntry
+}
+
+type idempotencyEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+func newIdempotencyCache(ttl time.Duration) *idempotencyCache {
+	return &idempotencyCache{
+		ttl:     ttl,
+		entries: make(map[string]idempotencyEntry),
+	}
+}
+
+func (c *idempotencyCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return "", false
+	}
+	return entry.value, true
+}
+
+func (c *idempotencyCache) put(key, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = idempotencyEntry{value: value, expiresAt: now.Add(c.ttl)}
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/syltek/oncall-incident-reporter/pkg/logutil"
+	"go.uber.org/zap"
+)
+
+// Default retry policy values
+const (
+	DefaultMaxAttempts    = 3
+	DefaultInitialBackoff = 200 * time.Millisecond
+	DefaultMaxBackoff     = 5 * time.Second
+)
+
+// slackRetryableErrors are the Slack API error codes worth retrying
+var slackRetryableErrors = map[string]bool{
+	"rate_limited":        true,
+	"ratelimited":         true,
+	"internal_error":      true,
+	"fatal_error":         true,
+	"service_unavailable": true,
+	"request_timeout":     true,
+}
+
+// RetryPolicy retries an operation with exponential backoff and full jitter
+// when it fails with a retryable error.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// sleep waits for d or until ctx is done, it is replaced in tests
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// DefaultRetryPolicy returns the policy used when none is configured
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    DefaultMaxAttempts,
+		InitialBackoff: DefaultInitialBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+	}
+}
+
+// NoRetryPolicy returns a policy that makes a single attempt
+func NoRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 1}
+}
+
+// StatusError carries the HTTP status of a failed call to an API whose client does not
+// expose it in the returned error, such as the Datadog API client.
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status %d: %v", e.StatusCode, e.Err)
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// newStatusError wraps err with the status and retry delay of resp, if any
+func newStatusError(resp *http.Response, err error) error {
+	if resp == nil {
+		return err
+	}
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: retryAfter(resp.Header),
+		Err:        err,
+	}
+}
+
+// retryAfter reads the delay requested by the server. Datadog uses X-RateLimit-Reset,
+// Slack and most other APIs use Retry-After. Both are expressed in seconds.
+func retryAfter(header http.Header) time.Duration {
+	for _, name := range []string{"Retry-After", "X-RateLimit-Reset"} {
+		if seconds, err := strconv.Atoi(header.Get(name)); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return 0
+}
+
+// IsRetryable classifies err and returns whether it is transient, along with the delay
+// requested by the server before retrying, if any.
+func IsRetryable(err error) (bool, time.Duration) {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false, 0
+	}
+
+	var rateLimited *slack.RateLimitedError
+	if errors.As(err, &rateLimited) {
+		return true, rateLimited.RetryAfter
+	}
+
+	var slackStatus slack.StatusCodeError
+	if errors.As(err, &slackStatus) {
+		return slackStatus.Retryable(), 0
+	}
+
+	var slackErr slack.SlackErrorResponse
+	if errors.As(err, &slackErr) {
+		return slackRetryableErrors[slackErr.Err], 0
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		retryable := statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= http.StatusInternalServerError
+		return retryable, statusErr.RetryAfter
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true, 0
+	}
+
+	return false, 0
+}
+
+// Do calls op with the attempt number, starting at 1, until it succeeds, fails with a
+// non-retryable error, the attempts are exhausted or ctx is done. A delay requested by the
+// server longer than MaxBackoff, or than the time left before the deadline of ctx, is not
+// waited for: the error is returned at once.
+func (p RetryPolicy) Do(ctx context.Context, operation string, op func(ctx context.Context, attempt int) error) error {
+	attempts := max(p.MaxAttempts, 1)
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = op(ctx, attempt)
+		if err == nil {
+			return nil
+		}
+
+		retryable, delay := IsRetryable(err)
+		if !retryable || attempt == attempts {
+			break
+		}
+
+		// Waiting longer than the backoff allows, or past the deadline, would hold the caller for
+		// nothing: the call fails now and is retried later, e.g. by the incident dispatcher
+		if delay > p.maxBackoff() || exceedsDeadline(ctx, delay) {
+			logutil.InfoCtx(ctx, "Not retrying failed call, the requested delay is too long",
+				zap.String("operation", operation),
+				zap.Int("attempt", attempt),
+				zap.Duration("delay", delay),
+				zap.Error(err))
+			break
+		}
+		if delay == 0 {
+			delay = p.backoff(attempt)
+		}
+
+		logutil.InfoCtx(ctx, "Retrying failed call",
+			zap.String("operation", operation),
+			zap.Int("attempt", attempt),
+			zap.Duration("delay", delay),
+			zap.Error(err))
+
+		if sleepErr := p.wait(ctx, delay); sleepErr != nil {
+			return fmt.Errorf("%s: %w (gave up waiting to retry: %v)", operation, err, sleepErr)
+		}
+	}
+
+	return err
+}
+
+// backoff returns a random delay between zero and the exponential backoff for the attempt
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = DefaultInitialBackoff
+	}
+	maxBackoff := p.maxBackoff()
+
+	backoff := initial << (attempt - 1)
+	if backoff <= 0 || backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return rand.N(backoff) + 1
+}
+
+// maxBackoff is the longest wait between two attempts
+func (p RetryPolicy) maxBackoff() time.Duration {
+	if p.MaxBackoff <= 0 {
+		return DefaultMaxBackoff
+	}
+	return p.MaxBackoff
+}
+
+// exceedsDeadline reports whether ctx is done before waiting for d
+func exceedsDeadline(ctx context.Context, d time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return ok && time.Until(deadline) < d
+}
+
+func (p RetryPolicy) wait(ctx context.Context, d time.Duration) error {
+	if p.sleep != nil {
+		return p.sleep(ctx, d)
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		wantRetryable bool
+		wantDelay     time.Duration
+	}{
+		{"slack rate limited", &slack.RateLimitedError{RetryAfter: 3 * time.Second}, true, 3 * time.Second},
+		{"slack rate_limited error code", slack.SlackErrorResponse{Err: "rate_limited"}, true, 0},
+		{"slack channel_not_found", slack.SlackErrorResponse{Err: "channel_not_found"}, false, 0},
+		{"slack 503", slack.StatusCodeError{Code: http.StatusServiceUnavailable}, true, 0},
+		{"slack 400", slack.StatusCodeError{Code: http.StatusBadRequest}, false, 0},
+		{"datadog 429", &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Second}, true, time.Second},
+		{"datadog 500", &StatusError{StatusCode: http.StatusInternalServerError}, true, 0},
+		{"datadog 403", &StatusError{StatusCode: http.StatusForbidden}, false, 0},
+		{"context canceled", context.Canceled, false, 0},
+		{"unknown", errors.New("boom"), false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retryable, delay := IsRetryable(tt.err)
+			assert.Equal(t, tt.wantRetryable, retryable)
+			assert.Equal(t, tt.wantDelay, delay)
+		})
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	var delays []time.Duration
+	policy := RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		sleep: func(_ context.Context, d time.Duration) error {
+			delays = append(delays, d)
+			return nil
+		},
+	}
+
+	t.Run("retries until success", func(t *testing.T) {
+		delays = nil
+		calls := 0
+		err := policy.Do(context.Background(), "test", func(context.Context, int) error {
+			calls++
+			if calls < 3 {
+				return &StatusError{StatusCode: http.StatusBadGateway}
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, calls)
+		assert.Len(t, delays, 2)
+		assert.LessOrEqual(t, delays[0], 100*time.Millisecond)
+		assert.LessOrEqual(t, delays[1], 200*time.Millisecond)
+	})
+
+	t.Run("honours retry after", func(t *testing.T) {
+		delays = nil
+		_ = policy.Do(context.Background(), "test", func(context.Context, int) error {
+			return &slack.RateLimitedError{RetryAfter: 500 * time.Millisecond}
+		})
+		assert.Equal(t, []time.Duration{500 * time.Millisecond, 500 * time.Millisecond}, delays)
+	})
+
+	t.Run("gives up when the retry after exceeds the max backoff", func(t *testing.T) {
+		delays = nil
+		calls := 0
+		err := policy.Do(context.Background(), "test", func(context.Context, int) error {
+			calls++
+			return &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 30 * time.Second}
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+		assert.Empty(t, delays)
+	})
+
+	t.Run("gives up when the retry after exceeds the deadline", func(t *testing.T) {
+		delays = nil
+		calls := 0
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		err := policy.Do(ctx, "test", func(context.Context, int) error {
+			calls++
+			return &slack.RateLimitedError{RetryAfter: 500 * time.Millisecond}
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+		assert.Empty(t, delays)
+	})
+
+	t.Run("does not retry permanent errors", func(t *testing.T) {
+		calls := 0
+		err := policy.Do(context.Background(), "test", func(context.Context, int) error {
+			calls++
+			return slack.SlackErrorResponse{Err: "invalid_auth"}
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+	})
+}
@@ -1,24 +1,247 @@
 package service
 
-import "github.com/slack-go/slack"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/syltek/oncall-incident-reporter/internal/installation"
+	"github.com/syltek/oncall-incident-reporter/internal/tracing"
+	"github.com/syltek/oncall-incident-reporter/pkg/logutil"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// IdempotencyEventType is the Slack message metadata event type carrying the idempotency key
+// of messages posted with PostMessageIdempotent
+const IdempotencyEventType = "oncall_incident_reported"
+
+const idempotencyKeyField = "idempotency_key"
 
 type ISlackClient interface {
-	OpenView(triggerID string, view slack.ModalViewRequest) (*slack.ViewResponse, error)
-	PostMessage(channelID string, options ...slack.MsgOption) (string, string, error)
+	OpenViewContext(ctx context.Context, triggerID string, view slack.ModalViewRequest) (*slack.ViewResponse, error)
+	PostMessageContext(ctx context.Context, channelID string, options ...slack.MsgOption) (string, string, error)
+	UpdateMessageContext(ctx context.Context, channelID, timestamp string, options ...slack.MsgOption) (string, string, string, error)
+	GetConversationHistoryContext(ctx context.Context, params *slack.GetConversationHistoryParameters) (*slack.GetConversationHistoryResponse, error)
+	PostEphemeralContext(ctx context.Context, channelID, userID string, options ...slack.MsgOption) (string, error)
+	GetUserGroupMembersContext(ctx context.Context, userGroup string) ([]string, error)
+	AuthTestContext(ctx context.Context) (*slack.AuthTestResponse, error)
 }
 
 type SlackService struct {
 	client ISlackClient
+	retry  RetryPolicy
+	posted *idempotencyCache
+
+	// Workspaces installed through OAuth, see WithInstallations
+	installations installation.Store
+	newClient     func(token string) ISlackClient
+	mu            sync.Mutex
+	// workspaces are the services of the installations, keyed by installation key
+	workspaces map[string]workspaceService
+}
+
+// workspaceService is the service of an installation, calling Slack with its bot token
+type workspaceService struct {
+	token   string
+	service *SlackService
+}
+
+func NewSlackService(client ISlackClient, retry RetryPolicy) *SlackService {
+	return &SlackService{
+		client: client,
+		retry:  retry,
+		posted: newIdempotencyCache(time.Hour),
+	}
+}
+
+// WithInstallations makes the service serve the workspaces the app was installed to through
+// OAuth. newClient creates the client of a workspace from its bot token.
+func (c *SlackService) WithInstallations(store installation.Store, newClient func(token string) ISlackClient) *SlackService {
+	c.installations = store
+	c.newClient = newClient
+	c.workspaces = make(map[string]workspaceService)
+	return c
+}
+
+// ForTeam returns the service calling Slack on behalf of the given workspace. Workspaces
+// without an OAuth installation are served by the client the service was created with, if any.
+func (c *SlackService) ForTeam(ctx context.Context, enterpriseID, teamID string) (*SlackService, error) {
+	if c.installations == nil || (teamID == "" && enterpriseID == "") {
+		return c, nil
+	}
+
+	inst, err := c.installations.Find(ctx, enterpriseID, teamID)
+	if errors.Is(err, installation.ErrNotFound) {
+		// The installation is deleted when the app is uninstalled or its token revoked, the
+		// service of the token must not be used anymore
+		c.forget(enterpriseID, teamID)
+		if c.client != nil {
+			return c, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find installation of team %s: %w", teamID, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Reinstalling the app issues a new token, the service of the previous one is replaced
+	if workspace, ok := c.workspaces[inst.Key()]; ok && workspace.token == inst.BotToken {
+		return workspace.service, nil
+	}
+	workspace := &SlackService{
+		client: c.newClient(inst.BotToken),
+		retry:  c.retry,
+		posted: c.posted,
+	}
+	c.workspaces[inst.Key()] = workspaceService{token: inst.BotToken, service: workspace}
+	return workspace, nil
+}
+
+// forget drops the services of the installations that could serve the workspace
+func (c *SlackService) forget(enterpriseID, teamID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range installation.Keys(enterpriseID, teamID) {
+		delete(c.workspaces, key)
+	}
+}
+
+func (c *SlackService) OpenView(ctx context.Context, triggerID string, view slack.ModalViewRequest) (_ *slack.ViewResponse, err error) {
+	ctx, span := tracing.Start(ctx, "slack.OpenView")
+	defer func() { tracing.End(span, err) }()
+	return c.client.OpenViewContext(ctx, triggerID, view)
+}
+
+func (c *SlackService) PostMessage(ctx context.Context, channelID string, options ...slack.MsgOption) (_, _ string, err error) {
+	ctx, span := tracing.Start(ctx, "slack.PostMessage", attribute.String("slack.channel_id", channelID))
+	defer func() { tracing.End(span, err) }()
+	return c.client.PostMessageContext(ctx, channelID, options...)
+}
+
+func (c *SlackService) UpdateMessage(ctx context.Context, channelID, timestamp string, options ...slack.MsgOption) (_, _, _ string, err error) {
+	ctx, span := tracing.Start(ctx, "slack.UpdateMessage", attribute.String("slack.channel_id", channelID))
+	defer func() { tracing.End(span, err) }()
+	return c.client.UpdateMessageContext(ctx, channelID, timestamp, options...)
+}
+
+func (c *SlackService) GetConversationHistory(ctx context.Context, params *slack.GetConversationHistoryParameters) (_ *slack.GetConversationHistoryResponse, err error) {
+	ctx, span := tracing.Start(ctx, "slack.GetConversationHistory", attribute.String("slack.channel_id", params.ChannelID))
+	defer func() { tracing.End(span, err) }()
+	return c.client.GetConversationHistoryContext(ctx, params)
+}
+
+func (c *SlackService) PostEphemeral(ctx context.Context, channelID, userID string, options ...slack.MsgOption) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "slack.PostEphemeral", attribute.String("slack.channel_id", channelID))
+	defer func() { tracing.End(span, err) }()
+	return c.client.PostEphemeralContext(ctx, channelID, userID, options...)
 }
 
-func NewSlackService(client ISlackClient) *SlackService {
-	return &SlackService{client: client}
+func (c *SlackService) GetUserGroupMembers(ctx context.Context, userGroup string) (_ []string, err error) {
+	ctx, span := tracing.Start(ctx, "slack.GetUserGroupMembers", attribute.String("slack.user_group", userGroup))
+	defer func() { tracing.End(span, err) }()
+	return c.client.GetUserGroupMembersContext(ctx, userGroup)
 }
 
-func (c *SlackService) OpenView(triggerID string, view slack.ModalViewRequest) (*slack.ViewResponse, error) {
-	return c.client.OpenView(triggerID, view)
+// AuthTest checks that Slack is reachable and accepts the token of the service
+func (c *SlackService) AuthTest(ctx context.Context) (err error) {
+	if c.client == nil {
+		return errors.New("no Slack token configured")
+	}
+	ctx, span := tracing.Start(ctx, "slack.AuthTest")
+	defer func() { tracing.End(span, err) }()
+	if _, err := c.client.AuthTestContext(ctx); err != nil {
+		return fmt.Errorf("slack auth.test: %w", err)
+	}
+	return nil
 }
 
-func (c *SlackService) PostMessage(channelID string, options ...slack.MsgOption) (string, string, error) {
-	return c.client.PostMessage(channelID, options...)
+// PostMessageIdempotent posts a message, retrying transient failures, and guarantees at most one
+// message is posted per idempotency key. The key is attached to the message metadata so that,
+// before retrying, a message posted by a previous attempt whose response was lost is found in
+// the channel history instead of being posted again. When an earlier call may have used the key,
+// e.g. an earlier delivery of the same incident, usedSince is when the key was first used and
+// the history is also looked up before the first attempt; it is zero otherwise. Reading the
+// history needs the channels:history scope; without it the lookup fails and the post is retried
+// anyway.
+func (c *SlackService) PostMessageIdempotent(ctx context.Context, idempotencyKey string, usedSince time.Time, channelID string, options ...slack.MsgOption) (string, string, error) {
+	if idempotencyKey == "" {
+		var respChannel, respTimestamp string
+		err := c.retry.Do(ctx, "slack.PostMessage", func(ctx context.Context, _ int) error {
+			var err error
+			respChannel, respTimestamp, err = c.PostMessage(ctx, channelID, options...)
+			return err
+		})
+		return respChannel, respTimestamp, err
+	}
+
+	if timestamp, ok := c.posted.get(idempotencyKey); ok {
+		logutil.InfoCtx(ctx, "Message already posted, skipping",
+			zap.String("idempotency_key", idempotencyKey),
+			zap.String("timestamp", timestamp))
+		return channelID, timestamp, nil
+	}
+
+	options = append(options, slack.MsgOptionMetadata(slack.SlackMetadata{
+		EventType:    IdempotencyEventType,
+		EventPayload: map[string]interface{}{idempotencyKeyField: idempotencyKey},
+	}))
+
+	startedAt := time.Now()
+	if !usedSince.IsZero() {
+		startedAt = usedSince
+	}
+	var respChannel, respTimestamp string
+	err := c.retry.Do(ctx, "slack.PostMessage", func(ctx context.Context, attempt int) error {
+		if attempt > 1 || !usedSince.IsZero() {
+			if timestamp, ok := c.findPostedMessage(ctx, channelID, idempotencyKey, startedAt); ok {
+				respChannel, respTimestamp = channelID, timestamp
+				return nil
+			}
+		}
+
+		var err error
+		respChannel, respTimestamp, err = c.PostMessage(ctx, channelID, options...)
+		return err
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	c.posted.put(idempotencyKey, respTimestamp)
+	return respChannel, respTimestamp, nil
+}
+
+// findPostedMessage looks for a message carrying idempotencyKey posted since the given time
+func (c *SlackService) findPostedMessage(ctx context.Context, channelID, idempotencyKey string, since time.Time) (string, bool) {
+	history, err := c.GetConversationHistory(ctx, &slack.GetConversationHistoryParameters{
+		ChannelID:          channelID,
+		Oldest:             strconv.FormatInt(since.Add(-time.Minute).Unix(), 10),
+		Limit:              100,
+		IncludeAllMetadata: true,
+	})
+	if err != nil {
+		logutil.ErrorCtx(ctx, "Failed to look up previously posted message, retrying anyway",
+			zap.String("idempotency_key", idempotencyKey),
+			zap.Error(err))
+		return "", false
+	}
+
+	for _, message := range history.Messages {
+		if message.Metadata.EventType != IdempotencyEventType {
+			continue
+		}
+		if fmt.Sprint(message.Metadata.EventPayload[idempotencyKeyField]) == idempotencyKey {
+			logutil.InfoCtx(ctx, "Found message posted by a previous attempt",
+				zap.String("idempotency_key", idempotencyKey),
+				zap.String("timestamp", message.Timestamp))
+			return message.Timestamp, true
+		}
+	}
+	return "", false
 }
@@ -1,12 +1,13 @@
 package slackmodal
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"slices"
 
 	"github.com/slack-go/slack"
-	"github.com/syltek/oncall-incident-reporter/internal/service"
 	"github.com/syltek/oncall-incident-reporter/pkg/errors"
 )
 
@@ -20,11 +21,19 @@ type Modal struct {
 // ModalPayload is the payload received when the modal is submitted.
 type ModalPayload struct {
 	User struct {
+		ID       string `json:"id"`
 		Username string `json:"username"`
 	} `json:"user"`
+	Team struct {
+		ID string `json:"id"`
+	} `json:"team"`
+	Enterprise *struct {
+		ID string `json:"id"`
+	} `json:"enterprise"`
 	View struct {
-		ID    string `json:"id"`
-		State struct {
+		ID              string `json:"id"`
+		PrivateMetadata string `json:"private_metadata"`
+		State           struct {
 			Values map[string]map[string]struct {
 				Type           string `json:"type"`
 				Value          string `json:"value"`
@@ -60,6 +69,12 @@ func NewModal(title, triggerID string) *Modal {
 	}
 }
 
+// SetPrivateMetadata sets the data Slack sends back, untouched, when the modal is submitted
+func (m *Modal) SetPrivateMetadata(metadata string) *Modal {
+	m.View.PrivateMetadata = metadata
+	return m
+}
+
 // AddTextInput adds a simple text input field to the modal.
 func (m *Modal) AddTextInput(blockID, label, placeholder string, multiline bool) *Modal {
 	inputBlock := slack.NewInputBlock(
@@ -114,9 +129,14 @@ func (m *Modal) AddDateInput(blockID, label string) *Modal {
 	return m
 }
 
+// IViewOpener opens views in Slack, see service.SlackService
+type IViewOpener interface {
+	OpenView(ctx context.Context, triggerID string, view slack.ModalViewRequest) (*slack.ViewResponse, error)
+}
+
 // SendModal sends the modal using the Slack API.
-func (m *Modal) SendModal(api service.ISlackClient) error {
-	_, err := api.OpenView(m.TriggerID, m.View)
+func (m *Modal) SendModal(ctx context.Context, api IViewOpener) error {
+	_, err := api.OpenView(ctx, m.TriggerID, m.View)
 	if err != nil {
 		return fmt.Errorf("failed to send modal with trigger ID %s: %w", m.TriggerID, err)
 	}
@@ -128,7 +148,7 @@ func (m *Modal) SendModal(api service.ISlackClient) error {
 func (m *Modal) ParsePayload(payloadStr string) error {
 	payload := ModalPayload{}
 	if err := json.Unmarshal([]byte(payloadStr), &payload); err != nil {
-		return errors.New(http.StatusBadRequest, "Invalid payload format", errors.CategoryClient, err)
+		return errors.ErrInvalidPayload.WithMessage("Invalid payload format").Wrap(err)
 	}
 
 	m.Payload = payload
@@ -145,13 +165,42 @@ func (m *Modal) ParseField(blockID string) (string, error) {
 			return field.Value, nil
 		}
 	}
-	return "", errors.New(http.StatusBadRequest, fmt.Sprintf("Field %s not found", blockID), errors.CategoryClient, nil)
+	return "", errors.ErrInvalidField.WithMessage(fmt.Sprintf("Field %s not found", blockID)).WithField(blockID)
 }
 
 func (m *Modal) GetUsername() string {
 	return m.Payload.User.Username
 }
 
+// GetUserID returns the Slack ID of the user who submitted the modal
+func (m *Modal) GetUserID() string {
+	return m.Payload.User.ID
+}
+
+// GetTeamID returns the ID of the workspace the modal was submitted from
+func (m *Modal) GetTeamID() string {
+	return m.Payload.Team.ID
+}
+
+// GetEnterpriseID returns the ID of the Enterprise Grid organization the modal was submitted
+// from, if any
+func (m *Modal) GetEnterpriseID() string {
+	if m.Payload.Enterprise == nil {
+		return ""
+	}
+	return m.Payload.Enterprise.ID
+}
+
+// GetViewID returns the ID of the submitted view, which is unique per modal submission
+func (m *Modal) GetViewID() string {
+	return m.Payload.View.ID
+}
+
+// GetPrivateMetadata returns the private metadata of the submitted view
+func (m *Modal) GetPrivateMetadata() string {
+	return m.Payload.View.PrivateMetadata
+}
+
 // ParseAllFields retrieves all the field values from the parsed modal payload.
 func (m *Modal) ParseAllFields() (map[string]string, error) {
 	// Create a map to store field values
@@ -178,3 +227,76 @@ func (m *Modal) ParseAllFields() (map[string]string, error) {
 	// Return the parsed field values
 	return fields, nil
 }
+
+// Submitter is the user submitting a modal
+type Submitter struct {
+	UserID   string
+	Username string
+	TeamID   string
+}
+
+// SubmissionPayload builds the payload Slack sends when the user submits the modal with the
+// values, keyed by block ID, e.g. to simulate a submission. Inputs without a value are left
+// empty. A value of a select must be one of its options.
+func (m *Modal) SubmissionPayload(submitter Submitter, viewID string, values map[string]string) (string, error) {
+	type selectedOption struct {
+		Value string `json:"value"`
+	}
+	type elementState struct {
+		Type           string          `json:"type"`
+		Value          string          `json:"value,omitempty"`
+		SelectedOption *selectedOption `json:"selected_option,omitempty"`
+	}
+
+	state := make(map[string]map[string]elementState)
+	used := make(map[string]bool)
+	for _, block := range m.View.Blocks.BlockSet {
+		input, ok := block.(*slack.InputBlock)
+		if !ok {
+			continue
+		}
+		value, ok := values[input.BlockID]
+		if !ok {
+			continue
+		}
+		used[input.BlockID] = true
+
+		switch element := input.Element.(type) {
+		case *slack.SelectBlockElement:
+			if !slices.ContainsFunc(element.Options, func(option *slack.OptionBlockObject) bool { return option.Value == value }) {
+				return "", fmt.Errorf("%q is not an option of %s", value, input.BlockID)
+			}
+			state[input.BlockID] = map[string]elementState{
+				element.ActionID: {Type: element.Type, SelectedOption: &selectedOption{Value: value}},
+			}
+		case *slack.PlainTextInputBlockElement:
+			state[input.BlockID] = map[string]elementState{
+				element.ActionID: {Type: string(element.Type), Value: value},
+			}
+		default:
+			return "", fmt.Errorf("the input %s cannot be filled in", input.BlockID)
+		}
+	}
+	for blockID := range values {
+		if !used[blockID] {
+			return "", fmt.Errorf("the modal has no input %s", blockID)
+		}
+	}
+
+	payload := map[string]interface{}{
+		"type": slack.InteractionTypeViewSubmission,
+		"user": map[string]string{"id": submitter.UserID, "username": submitter.Username},
+		"team": map[string]string{"id": submitter.TeamID},
+		"view": map[string]interface{}{
+			"id":               viewID,
+			"callback_id":      m.View.CallbackID,
+			"private_metadata": m.View.PrivateMetadata,
+			"state":            map[string]interface{}{"values": state},
+		},
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,218 @@
+// Package socket receives Slack requests over a Socket Mode websocket instead of HTTP, so the
+// app can run without a public URL, and dispatches them to the same handlers as the router.
+package socket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/socketmode"
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+	"github.com/syltek/oncall-incident-reporter/internal/metrics"
+	"github.com/syltek/oncall-incident-reporter/internal/middleware"
+	"github.com/syltek/oncall-incident-reporter/internal/router"
+	"github.com/syltek/oncall-incident-reporter/pkg/logutil"
+	"go.uber.org/zap"
+)
+
+// Runner receives slash commands and interactions over Socket Mode
+type Runner struct {
+	client    *socketmode.Client
+	handler   router.Handler
+	endpoints *config.Endpoints
+	metrics   metrics.Recorder
+	// inflight tracks the requests being handled
+	inflight sync.WaitGroup
+}
+
+// NewRunner creates a Runner connecting with the app-level token (xapp-...) and dispatching
+// requests to the handler
+func NewRunner(appToken, botToken string, handler router.Handler, endpoints *config.Endpoints) *Runner {
+	api := slack.New(botToken, slack.OptionAppLevelToken(appToken))
+	return &Runner{
+		client:    socketmode.New(api),
+		handler:   handler,
+		endpoints: endpoints,
+		metrics:   metrics.NewNoopRecorder(),
+	}
+}
+
+// WithMetrics records the count and latency of the requests, as the router does over HTTP
+func (r *Runner) WithMetrics(recorder metrics.Recorder) *Runner {
+	r.metrics = recorder
+	return r
+}
+
+// Run connects to Slack and processes requests until the context is cancelled. It returns once
+// the requests being handled are acknowledged.
+func (r *Runner) Run(ctx context.Context) error {
+	defer r.inflight.Wait()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- r.client.RunContext(ctx)
+	}()
+
+	for {
+		select {
+		case err := <-errs:
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("socket mode connection: %w", err)
+		case evt := <-r.client.Events:
+			r.handleEvent(ctx, evt)
+		}
+	}
+}
+
+func (r *Runner) handleEvent(ctx context.Context, evt socketmode.Event) {
+	switch evt.Type {
+	case socketmode.EventTypeConnecting:
+		logutil.InfoCtx(ctx, "Connecting to Slack with Socket Mode")
+	case socketmode.EventTypeConnected:
+		logutil.InfoCtx(ctx, "Connected to Slack with Socket Mode")
+	case socketmode.EventTypeConnectionError, socketmode.EventTypeInvalidAuth:
+		logutil.ErrorCtx(ctx, "Socket Mode connection failed", zap.Any("error", evt.Data))
+	case socketmode.EventTypeSlashCommand:
+		r.serve(func() {
+			payload, err := dispatchSlashCommand(ctx, r.middleware(r.handler.HandleCommand), r.endpoints.SlackCommand, evt.Request)
+			r.ack(ctx, evt.Request, payload, err)
+		})
+	case socketmode.EventTypeInteractive:
+		r.serve(func() {
+			payload, err := dispatchInteraction(ctx, r.middleware(r.handler.HandleModalSubmission), r.endpoints.SlackModalParser, evt.Request)
+			r.ack(ctx, evt.Request, payload, err)
+		})
+	default:
+		logutil.DebugCtx(ctx, "Ignoring Socket Mode event", zap.String("type", string(evt.Type)))
+	}
+}
+
+// middleware wraps the handler in the middleware of the router that applies without HTTP: a
+// panicking handler answers an error instead of stopping the process, and the requests are
+// recorded in the metrics
+func (r *Runner) middleware(handler http.HandlerFunc) http.HandlerFunc {
+	return middleware.Recovery(middleware.Metrics(r.metrics)(handler)).ServeHTTP
+}
+
+// serve handles a request in its own goroutine, so a slow request does not hold back the
+// acknowledgement of the next ones beyond the 3 seconds Slack waits for. The request is
+// acknowledged once handled, as the handler response is the payload of the acknowledgement.
+func (r *Runner) serve(handle func()) {
+	r.inflight.Add(1)
+	go func() {
+		defer r.inflight.Done()
+		handle()
+	}()
+}
+
+// ack acknowledges the request, with the handler response as payload. Slack shows an error to
+// the user if the request is acknowledged without the expected payload.
+func (r *Runner) ack(ctx context.Context, req *socketmode.Request, payload json.RawMessage, err error) {
+	if req == nil {
+		return
+	}
+	if err != nil {
+		logutil.ErrorCtx(ctx, "Failed to handle Socket Mode request",
+			zap.String("envelope_id", req.EnvelopeID),
+			zap.Error(err))
+		r.client.Ack(*req)
+		return
+	}
+	if len(payload) == 0 {
+		r.client.Ack(*req)
+		return
+	}
+	r.client.Ack(*req, payload)
+}
+
+// dispatchSlashCommand calls the handler with the slash command as the form Slack would POST
+// over HTTP. The payload of a slash command is a JSON object of the same fields.
+func dispatchSlashCommand(ctx context.Context, handler http.HandlerFunc, path string, req *socketmode.Request) (json.RawMessage, error) {
+	if req == nil {
+		return nil, fmt.Errorf("slash command without request")
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(req.Payload, &fields); err != nil {
+		return nil, fmt.Errorf("decode slash command: %w", err)
+	}
+	form := url.Values{}
+	for key, value := range fields {
+		form.Set(key, fmt.Sprint(value))
+	}
+	return dispatch(ctx, handler, path, form, req)
+}
+
+// dispatchInteraction calls the handler with the interaction as the payload form field Slack
+// would POST over HTTP
+func dispatchInteraction(ctx context.Context, handler http.HandlerFunc, path string, req *socketmode.Request) (json.RawMessage, error) {
+	if req == nil {
+		return nil, fmt.Errorf("interaction without request")
+	}
+	return dispatch(ctx, handler, path, url.Values{"payload": {string(req.Payload)}}, req)
+}
+
+func dispatch(ctx context.Context, handler http.HandlerFunc, path string, form url.Values, req *socketmode.Request) (json.RawMessage, error) {
+	// The request does not go through the router middleware, the envelope identifies it
+	ctx = middleware.WithRequestID(ctx, req.EnvelopeID)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if req.RetryAttempt > 0 {
+		httpReq.Header.Set("X-Slack-Retry-Num", strconv.Itoa(req.RetryAttempt))
+		httpReq.Header.Set("X-Slack-Retry-Reason", req.RetryReason)
+	}
+
+	rec := newResponse()
+	handler(rec, httpReq)
+
+	if rec.code >= http.StatusBadRequest {
+		return nil, fmt.Errorf("handler responded %d: %s", rec.code, strings.TrimSpace(rec.body.String()))
+	}
+	body := rec.body.Bytes()
+	if len(body) == 0 || !json.Valid(body) {
+		return nil, nil
+	}
+	return json.RawMessage(body), nil
+}
+
+// response keeps the response of a handler, the payload of the acknowledgement
+type response struct {
+	header      http.Header
+	code        int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func newResponse() *response {
+	return &response{header: make(http.Header), code: http.StatusOK}
+}
+
+func (r *response) Header() http.Header {
+	return r.header
+}
+
+func (r *response) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.body.Write(b)
+}
+
+// WriteHeader keeps the first status code written, as net/http does
+func (r *response) WriteHeader(code int) {
+	if r.wroteHeader {
+		return
+	}
+	r.code, r.wroteHeader = code, true
+}
@@ -0,0 +1,144 @@
+// Package tracing sets up OpenTelemetry tracing and provides helpers to trace calls to Slack,
+// Datadog and the incident sinks.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+	"github.com/syltek/oncall-incident-reporter/pkg/buildinfo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// InstrumentationName identifies the spans created by the application
+const InstrumentationName = "github.com/syltek/oncall-incident-reporter"
+
+// Provider creates the tracers of the application and flushes the spans they record to the
+// exporter
+type Provider interface {
+	trace.TracerProvider
+	// ForceFlush exports the pending spans, e.g. before a Lambda execution environment is frozen
+	ForceFlush(ctx context.Context) error
+	// Shutdown exports the pending spans and stops the provider
+	Shutdown(ctx context.Context) error
+}
+
+type noopProvider struct {
+	noop.TracerProvider
+}
+
+func (noopProvider) ForceFlush(context.Context) error { return nil }
+func (noopProvider) Shutdown(context.Context) error   { return nil }
+
+// Setup creates the tracer provider described by the configuration. It is not installed
+// globally, it is passed to the router and in the context of the work done outside of requests
+// with WithProvider. The provider must be shut down before exiting. Without tracing enabled,
+// spans are not recorded.
+func Setup(ctx context.Context, cfg *config.Tracing, metadata *config.Metadata) (Provider, error) {
+	if cfg == nil || !cfg.Enabled {
+		return noopProvider{}, nil
+	}
+
+	exporter, err := newExporter(ctx, cfg, os.Stdout)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewProvider(exporter, cfg.SampleRatio, metadata), nil
+}
+
+// Propagator reads and writes the trace context and the baggage of the W3C headers
+func Propagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+}
+
+type providerKey struct{}
+
+// WithProvider returns a copy of ctx carrying the tracer provider, which the spans started with
+// the context are recorded by
+func WithProvider(ctx context.Context, provider trace.TracerProvider) context.Context {
+	if provider == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, providerKey{}, provider)
+}
+
+// providerFrom returns the tracer provider carried by ctx, the one of the span in ctx if there
+// is none, e.g. the span of the request, or the global one
+func providerFrom(ctx context.Context) trace.TracerProvider {
+	if provider, ok := ctx.Value(providerKey{}).(trace.TracerProvider); ok {
+		return provider
+	}
+	if span := trace.SpanFromContext(ctx); span.SpanContext().IsValid() {
+		return span.TracerProvider()
+	}
+	return otel.GetTracerProvider()
+}
+
+// NewProvider creates a tracer provider exporting the sampled spans in batches
+func NewProvider(exporter sdktrace.SpanExporter, sampleRatio float64, metadata *config.Metadata) *sdktrace.TracerProvider {
+	attrs := []attribute.KeyValue{semconv.ServiceVersion(buildinfo.Get().Version)}
+	if metadata != nil {
+		attrs = append(attrs,
+			semconv.ServiceName(metadata.Service),
+			semconv.DeploymentEnvironment(metadata.Environment),
+			attribute.String("team", metadata.Team))
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, attrs...)),
+		// Follow the decision of the caller, so traces started upstream are complete
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+}
+
+func newExporter(ctx context.Context, cfg *config.Tracing, stdout io.Writer) (sdktrace.SpanExporter, error) {
+	switch cfg.Exporter {
+	case config.TRACING_EXPORTER_STDOUT:
+		return stdouttrace.New(stdouttrace.WithWriter(stdout))
+	case config.TRACING_EXPORTER_OTLP, "":
+		// Without an endpoint, the OTEL_EXPORTER_OTLP_* environment variables are used
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("create OTLP exporter: %w", err)
+		}
+		return exporter, nil
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+}
+
+// Start starts a span named after the traced operation, e.g. "slack.PostMessage"
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return providerFrom(ctx).Tracer(InstrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends the span, marking it failed if err is not nil
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,79 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syltek/oncall-incident-reporter/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestStdoutExporter(t *testing.T) {
+	var out bytes.Buffer
+	exporter, err := newExporter(context.Background(), &config.Tracing{Exporter: config.TRACING_EXPORTER_STDOUT}, &out)
+	require.NoError(t, err)
+
+	provider := NewProvider(exporter, 1, &config.Metadata{Service: "oncall-incident-reporter", Environment: "test"})
+	_, span := provider.Tracer(InstrumentationName).Start(context.Background(), "slack.PostMessage")
+	span.End()
+	require.NoError(t, provider.Shutdown(context.Background()))
+
+	assert.Contains(t, out.String(), `"Name":"slack.PostMessage"`)
+	assert.Contains(t, out.String(), `"Value":"oncall-incident-reporter"`)
+}
+
+func TestUnknownExporter(t *testing.T) {
+	_, err := newExporter(context.Background(), &config.Tracing{Exporter: "zipkin"}, nil)
+	assert.Error(t, err)
+}
+
+func TestSetupDisabled(t *testing.T) {
+	provider, err := Setup(context.Background(), &config.Tracing{Enabled: false}, nil)
+	require.NoError(t, err)
+	assert.NoError(t, provider.ForceFlush(context.Background()))
+	assert.NoError(t, provider.Shutdown(context.Background()))
+}
+
+func TestStartAndEnd(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	ctx, parent := Start(context.Background(), "route")
+	_, child := Start(ctx, "datadog.CreateEvent")
+	End(child, errors.New("rate limited"))
+	End(parent, nil)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "datadog.CreateEvent", spans[0].Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, codes.Unset, spans[1].Status().Code)
+}
+
+func TestStartWithProvider(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	ctx := WithProvider(context.Background(), sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	// The spans are recorded by the provider of the context, not the global one
+	ctx, parent := Start(ctx, "incident.retry")
+	_, child := Start(trace.ContextWithSpan(context.Background(), parent), "slack.PostMessage")
+	End(child, nil)
+	End(parent, nil)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "slack.PostMessage", spans[0].Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.True(t, trace.SpanFromContext(ctx).SpanContext().IsValid())
+}
@@ -1,8 +1,10 @@
 package errors
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 )
 
 // AppError defines a custom error type with categorization and error wrapping
@@ -11,6 +13,16 @@ type AppError struct {
 	Message    string // Default user-friendly error message
 	Category   string // Error category: "client" or "server"
 	WrappedErr error  // Optional wrapped error
+	// Reason is the machine-readable code of the error, e.g. "store_unavailable". Errors with the
+	// same reason match with errors.Is. It is set on the predefined errors, and on the errors
+	// derived from them, only.
+	Reason string
+	// Retryable tells the same request may succeed later
+	Retryable bool
+	// Hint tells the user what to do about the error
+	Hint string
+	// Field is the ID of the modal input block the error is about, if any
+	Field string
 }
 
 // Constants for error categories
@@ -19,12 +31,45 @@ const (
 	CategoryClient = "client"
 )
 
-// Predefined Errors
+// Machine-readable error codes
+const (
+	ReasonBadRequest         = "bad_request"
+	ReasonUnauthorized       = "unauthorized"
+	ReasonForbidden          = "forbidden"
+	ReasonNotFound           = "not_found"
+	ReasonRateLimited        = "rate_limited"
+	ReasonInternal           = "internal"
+	ReasonInvalidPayload     = "invalid_payload"
+	ReasonInvalidField       = "invalid_field"
+	ReasonNotInstalled       = "not_installed"
+	ReasonUpstreamFailure    = "upstream_failure"
+	ReasonStoreUnavailable   = "store_unavailable"
+	ReasonServiceUnavailable = "service_unavailable"
+)
+
+// Predefined Errors. Use Wrap to return them with their cause and errors.Is to recognize them.
 var (
-	ErrBadRequest     = New(http.StatusBadRequest, "Bad request", "client", nil)
-	ErrUnauthorized   = New(http.StatusUnauthorized, "Unauthorized", "client", nil)
-	ErrForbidden      = New(http.StatusForbidden, "Forbidden", "client", nil)
-	ErrInternalServer = New(http.StatusInternalServerError, "Internal server error", "server", nil)
+	ErrBadRequest     = New(http.StatusBadRequest, "Bad request", "client", nil).WithReason(ReasonBadRequest)
+	ErrUnauthorized   = New(http.StatusUnauthorized, "Unauthorized", "client", nil).WithReason(ReasonUnauthorized)
+	ErrForbidden      = New(http.StatusForbidden, "Forbidden", "client", nil).WithReason(ReasonForbidden)
+	ErrInternalServer = New(http.StatusInternalServerError, "Internal server error", "server", nil).WithReason(ReasonInternal)
+	ErrNotFound       = New(http.StatusNotFound, "Not found", "client", nil).WithReason(ReasonNotFound)
+	ErrRateLimited    = New(http.StatusTooManyRequests, "Too many requests", CategoryClient, nil).
+				WithReason(ReasonRateLimited)
+
+	ErrInvalidPayload = New(http.StatusBadRequest, "Invalid Slack payload", CategoryClient, nil).
+				WithReason(ReasonInvalidPayload)
+	ErrInvalidField = New(http.StatusBadRequest, "Invalid value", CategoryClient, nil).
+			WithReason(ReasonInvalidField)
+	ErrNotInstalled = New(http.StatusInternalServerError, "The app is not installed to this workspace", CategoryServer, nil).
+			WithReason(ReasonNotInstalled).
+			WithHint("Ask a workspace admin to install the app again.")
+	ErrUpstreamFailure = New(http.StatusBadGateway, "Slack or Datadog did not answer as expected", CategoryServer, nil).
+				WithReason(ReasonUpstreamFailure).
+				AsRetryable()
+	ErrStoreUnavailable = New(http.StatusServiceUnavailable, "Incidents cannot be recorded right now", CategoryServer, nil).
+				WithReason(ReasonStoreUnavailable).
+				AsRetryable()
 )
 
 // Error implements the error interface
@@ -35,12 +80,132 @@ func (e *AppError) Error() string {
 	return fmt.Sprintf("%d (%s): %s", e.Code, e.Category, e.Message)
 }
 
-// New creates a new AppError
+// Unwrap returns the wrapped error
+func (e *AppError) Unwrap() error {
+	return e.WrappedErr
+}
+
+// Is reports whether the target is an AppError with the same reason, so that the errors
+// derived from a predefined error match it
+func (e *AppError) Is(target error) bool {
+	t, ok := target.(*AppError)
+	return ok && e.Reason != "" && e.Reason == t.Reason
+}
+
+// ErrorCode is the machine-readable code of the error: its reason, or the code of its HTTP
+// status if it has none
+func (e *AppError) ErrorCode() string {
+	if e.Reason != "" {
+		return e.Reason
+	}
+	return reasonForStatus(e.Code)
+}
+
+// UserMessage is the message shown to the user: the message and, if any, the hint
+func (e *AppError) UserMessage() string {
+	message := e.Message
+	if e.Hint != "" {
+		message = strings.TrimSuffix(message, ".") + ". " + e.Hint
+	} else if e.Retryable {
+		message = strings.TrimSuffix(message, ".") + ". Please try again in a moment."
+	}
+	return message
+}
+
+// New creates a new AppError without reason, it matches no predefined error. Errors with the
+// 503 and 429 status codes are retryable.
 func New(code int, message string, category string, wrappedErr error) *AppError {
 	return &AppError{
 		Code:       code,
 		Message:    message,
 		Category:   category,
 		WrappedErr: wrappedErr,
+		Retryable:  code == http.StatusServiceUnavailable || code == http.StatusTooManyRequests,
+	}
+}
+
+// The methods below return a copy of the error, the predefined errors are never changed
+
+// Wrap returns a copy of the error wrapping err
+func (e *AppError) Wrap(err error) *AppError {
+	c := *e
+	c.WrappedErr = err
+	return &c
+}
+
+// WithMessage returns a copy of the error with the message
+func (e *AppError) WithMessage(message string) *AppError {
+	c := *e
+	c.Message = message
+	return &c
+}
+
+// WithReason returns a copy of the error with the machine-readable code
+func (e *AppError) WithReason(reason string) *AppError {
+	c := *e
+	c.Reason = reason
+	return &c
+}
+
+// WithHint returns a copy of the error with the hint
+func (e *AppError) WithHint(hint string) *AppError {
+	c := *e
+	c.Hint = hint
+	return &c
+}
+
+// WithField returns a copy of the error about the modal input block
+func (e *AppError) WithField(blockID string) *AppError {
+	c := *e
+	c.Field = blockID
+	return &c
+}
+
+// AsRetryable returns a copy of the error marked as retryable: the request that failed may
+// succeed if sent again
+func (e *AppError) AsRetryable() *AppError {
+	c := *e
+	c.Retryable = true
+	return &c
+}
+
+// As returns the AppError in the chain of err, or an internal server error wrapping err if
+// there is none
+func As(err error) *AppError {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	return ErrInternalServer.Wrap(err)
+}
+
+// IsRetryable reports whether err, or the AppError it wraps, is retryable: the request that
+// failed may succeed if sent again
+func IsRetryable(err error) bool {
+	var appErr *AppError
+	return errors.As(err, &appErr) && appErr.Retryable
+}
+
+func reasonForStatus(code int) string {
+	switch code {
+	case http.StatusBadRequest:
+		return ReasonBadRequest
+	case http.StatusUnauthorized:
+		return ReasonUnauthorized
+	case http.StatusForbidden:
+		return ReasonForbidden
+	case http.StatusNotFound:
+		return ReasonNotFound
+	case http.StatusTooManyRequests:
+		return ReasonRateLimited
+	case http.StatusBadGateway:
+		return ReasonUpstreamFailure
+	case http.StatusServiceUnavailable:
+		return ReasonServiceUnavailable
+	default:
+		if code >= http.StatusInternalServerError {
+			return ReasonInternal
+		}
+		return ReasonBadRequest
 	}
 }
@@ -0,0 +1,62 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPredefinedErrorsMatchWithIs(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := fmt.Errorf("report incident: %w", ErrStoreUnavailable.WithMessage("Failed to record the incident").Wrap(cause))
+
+	assert.ErrorIs(t, err, ErrStoreUnavailable)
+	assert.ErrorIs(t, err, cause)
+	assert.NotErrorIs(t, err, ErrUpstreamFailure)
+	assert.True(t, IsRetryable(err))
+
+	// Errors created from a status code only match the predefined errors they are derived from
+	assert.NotErrorIs(t, New(http.StatusBadRequest, "Failed to parse form data", CategoryClient, nil), ErrBadRequest)
+	assert.NotErrorIs(t, New(http.StatusInternalServerError, "Failed to encode response", CategoryServer, nil), ErrInternalServer)
+	assert.ErrorIs(t, ErrBadRequest.WithMessage("Failed to parse form data"), ErrBadRequest)
+	assert.NotErrorIs(t, ErrInvalidPayload, ErrBadRequest)
+}
+
+func TestErrorCode(t *testing.T) {
+	rateLimited := New(http.StatusTooManyRequests, "Slow down", CategoryClient, nil)
+	assert.Equal(t, ReasonRateLimited, rateLimited.ErrorCode())
+	assert.True(t, rateLimited.Retryable)
+	assert.Empty(t, rateLimited.Reason)
+	assert.True(t, IsRetryable(ErrRateLimited))
+
+	assert.Equal(t, ReasonBadRequest, New(http.StatusConflict, "Already resolved", CategoryClient, nil).ErrorCode())
+	assert.Equal(t, ReasonStoreUnavailable, ErrStoreUnavailable.ErrorCode())
+}
+
+func TestDerivedErrorsLeavePredefinedErrorsUnchanged(t *testing.T) {
+	err := ErrInvalidField.WithMessage("Pick a severity").WithField("input_severity")
+
+	assert.Equal(t, "input_severity", err.Field)
+	assert.Equal(t, "Invalid value", ErrInvalidField.Message)
+	assert.Empty(t, ErrInvalidField.Field)
+}
+
+func TestUserMessage(t *testing.T) {
+	assert.Equal(t, "The app is not installed to this workspace. Ask a workspace admin to install the app again.",
+		ErrNotInstalled.UserMessage())
+	assert.Equal(t, "Failed to record the incident. Please try again in a moment.",
+		ErrStoreUnavailable.WithMessage("Failed to record the incident").UserMessage())
+	assert.Equal(t, "Bad request", ErrBadRequest.UserMessage())
+}
+
+func TestAs(t *testing.T) {
+	assert.Same(t, ErrForbidden, As(fmt.Errorf("wrapped: %w", ErrForbidden)))
+
+	appErr := As(errors.New("boom"))
+	assert.Equal(t, http.StatusInternalServerError, appErr.Code)
+	assert.Equal(t, ReasonInternal, appErr.Reason)
+	assert.False(t, appErr.Retryable)
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package fileutil
+
+// Lock does not lock the file on the platforms without flock, the callers still serialize the
+// writes of their process
+func Lock(string) (func(), error) {
+	return func() {}, nil
+}
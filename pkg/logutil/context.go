@@ -0,0 +1,106 @@
+package logutil
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// Keys of the request fields carried by contexts, so every log line of a request can be
+// correlated with the others
+const (
+	FieldRequestID  = "request_id"
+	FieldTraceID    = "trace_id"
+	FieldTriggerID  = "trigger_id"
+	FieldViewID     = "view_id"
+	FieldTeamID     = "team_id"
+	FieldUser       = "user"
+	FieldIncidentID = "incident_id"
+)
+
+type fieldsKey struct{}
+
+type loggerKey struct{}
+
+// WithLogger returns a copy of ctx carrying the logger. The lines logged with the context are
+// written to it instead of the Logger, so that applications running side by side, e.g. in
+// tests, each log with their own logger.
+func WithLogger(ctx context.Context, logger *zap.Logger) context.Context {
+	if logger == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// loggerFrom returns the logger carried by ctx, or the Logger
+func loggerFrom(ctx context.Context) *zap.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok {
+			return logger
+		}
+	}
+	return Logger
+}
+
+// WithFields returns a copy of ctx carrying the fields, in addition to the fields it already
+// carries, replacing those with the same key. The fields are added to every line logged with
+// the context.
+func WithFields(ctx context.Context, fields ...zap.Field) context.Context {
+	if len(fields) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, fieldsKey{}, withContextFields(ctx, fields))
+}
+
+// ContextFields returns the fields carried by ctx
+func ContextFields(ctx context.Context) []zap.Field {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey{}).([]zap.Field)
+	return fields
+}
+
+// FromContext returns the logger carried by ctx, or the Logger, with the fields carried by ctx
+func FromContext(ctx context.Context) *zap.Logger {
+	return loggerFrom(ctx).With(ContextFields(ctx)...)
+}
+
+// InfoCtx logs at info level with the fields carried by ctx
+func InfoCtx(ctx context.Context, msg string, fields ...zap.Field) {
+	fields = withContextFields(ctx, fields)
+	loggerFrom(ctx).WithOptions(zap.AddCallerSkip(1)).Info(msg, fields...)
+}
+
+// DebugCtx logs at debug level with the fields carried by ctx
+func DebugCtx(ctx context.Context, msg string, fields ...zap.Field) {
+	fields = withContextFields(ctx, fields)
+	loggerFrom(ctx).WithOptions(zap.AddCallerSkip(1)).Debug(msg, fields...)
+}
+
+// ErrorCtx logs at error level with the fields carried by ctx
+func ErrorCtx(ctx context.Context, msg string, fields ...zap.Field) {
+	fields = withContextFields(ctx, fields)
+	loggerFrom(ctx).WithOptions(zap.AddCallerSkip(1)).Error(msg, fields...)
+}
+
+// withContextFields prepends the fields carried by ctx. A field given explicitly with the same
+// key as a carried one wins, zap would otherwise log the key twice.
+func withContextFields(ctx context.Context, fields []zap.Field) []zap.Field {
+	carried := ContextFields(ctx)
+	if len(carried) == 0 {
+		return fields
+	}
+
+	explicit := make(map[string]struct{}, len(fields))
+	for _, field := range fields {
+		explicit[field.Key] = struct{}{}
+	}
+	merged := make([]zap.Field, 0, len(carried)+len(fields))
+	for _, field := range carried {
+		if _, ok := explicit[field.Key]; !ok {
+			merged = append(merged, field)
+		}
+	}
+	return append(merged, fields...)
+}
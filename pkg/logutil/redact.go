@@ -0,0 +1,266 @@
+package logutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Redacted replaces the sensitive data in the logs
+const Redacted = `"[REDACTED]"`
+
+// redactedValue replaces the sensitive strings of the logged objects, which are already quoted
+// when encoded as JSON
+const redactedValue = "[REDACTED]"
+
+// defaultPatterns match the secrets the application handles, whatever the configuration
+var defaultPatterns = []string{
+	`(?i)Bearer\s+[\w\.-]+`,                    // Bearer tokens
+	`(?i)password\s*[=:]\s*["']?[\w\.-]+["']?`, // password=secret or "password": "secret"
+	`(?i)token\s*[=:]\s*["']?[\w\.-]+["']?`,    // token=secret or "token": "secret"
+	`(?i)"Token"\s*:\s*"(xoxb-[0-9A-Za-z-]+)"`, // Slack tokens in config JSON
+	`(?i)xoxb-[0-9A-Za-z-]+`,                   // Raw Slack bot tokens
+	`(?i)"SlackToken"\s*:\s*"[^"]*"`,           // Slack tokens in JSON format
+	`(?i)"access_token"\s*:\s*"[^"]*"`,         // Access tokens in JSON
+	`(?i)"refresh_token"\s*:\s*"[^"]*"`,        // Refresh tokens in JSON
+	`(?i)"signing_secret"\s*:\s*"[^"]*"`,       // Signing secrets in JSON
+	`(?i)"X-Slack-Signature"\s*:\s*"[^"]*"`,    // Slack signature in JSON
+}
+
+// jsonStringOrArray matches a JSON string, or an array of strings such as form values
+const jsonStringOrArray = `(?:"(?:[^"\\]|\\.)*"|\[\s*(?:"(?:[^"\\]|\\.)*"\s*,?\s*)*\])`
+
+// Redactor masks sensitive data in log messages and fields. Its rules can be changed while
+// logging, e.g. when the configuration is reloaded.
+type Redactor struct {
+	rules atomic.Pointer[redactionRules]
+}
+
+type redactionRules struct {
+	// patterns matches any of the sensitive patterns in a single pass
+	patterns *regexp.Regexp
+	// fields are the lowercased names of the fields whose value is always redacted
+	fields map[string]struct{}
+	// fieldValues matches the denied fields in JSON-encoded objects, nil without denied fields
+	fieldValues *regexp.Regexp
+}
+
+// redactor is the Redactor of the Logger
+var redactor = mustRedactor()
+
+func mustRedactor() *Redactor {
+	r, err := NewRedactor(nil, nil)
+	if err != nil {
+		panic("Failed to compile default redaction patterns: " + err.Error())
+	}
+	return r
+}
+
+// NewRedactor creates a Redactor masking the default patterns, the given ones and the values of
+// the given fields. Patterns are regular expressions, field names are case-insensitive.
+func NewRedactor(patterns, fields []string) (*Redactor, error) {
+	r := &Redactor{}
+	if err := r.Configure(patterns, fields); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Configure replaces the custom patterns and fields. The rules are left unchanged on error.
+func (r *Redactor) Configure(patterns, fields []string) error {
+	rules, err := compileRules(patterns, fields)
+	if err != nil {
+		return err
+	}
+	r.rules.Store(rules)
+	return nil
+}
+
+func compileRules(patterns, fields []string) (*redactionRules, error) {
+	all := make([]string, 0, len(defaultPatterns)+len(patterns))
+	for _, pattern := range defaultPatterns {
+		all = append(all, "(?:"+pattern+")")
+	}
+	for _, pattern := range patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		all = append(all, "(?:"+pattern+")")
+	}
+
+	rules := &redactionRules{
+		patterns: regexp.MustCompile(strings.Join(all, "|")),
+		fields:   make(map[string]struct{}, len(fields)),
+	}
+	if len(fields) > 0 {
+		quoted := make([]string, len(fields))
+		for i, field := range fields {
+			rules.fields[strings.ToLower(field)] = struct{}{}
+			quoted[i] = regexp.QuoteMeta(field)
+		}
+		rules.fieldValues = regexp.MustCompile(`(?i)"(` + strings.Join(quoted, "|") + `)"\s*:\s*` + jsonStringOrArray)
+	}
+	return rules, nil
+}
+
+// Redact masks the sensitive data in s
+func (r *Redactor) Redact(s string) string {
+	return r.rules.Load().redact(s)
+}
+
+func (rules *redactionRules) redact(s string) string {
+	if rules.fieldValues != nil {
+		s = rules.fieldValues.ReplaceAllString(s, `"${1}":`+Redacted)
+	}
+	return rules.patterns.ReplaceAllLiteralString(s, Redacted)
+}
+
+func (rules *redactionRules) denied(key string) bool {
+	if len(rules.fields) == 0 {
+		return false
+	}
+	_, ok := rules.fields[strings.ToLower(key)]
+	return ok
+}
+
+// RedactFields masks the sensitive data in the fields. Objects and arrays are encoded as JSON,
+// keeping their structure, and redacted as such.
+func (r *Redactor) RedactFields(fields []zap.Field) []zap.Field {
+	if len(fields) == 0 {
+		return fields
+	}
+	rules := r.rules.Load()
+	redacted := make([]zap.Field, len(fields))
+	for i, field := range fields {
+		redacted[i] = rules.redactField(field)
+	}
+	return redacted
+}
+
+func (rules *redactionRules) redactField(field zap.Field) zap.Field {
+	if rules.denied(field.Key) {
+		return zap.String(field.Key, Redacted)
+	}
+
+	switch field.Type {
+	case zapcore.StringType:
+		field.String = rules.redact(field.String)
+	case zapcore.ByteStringType, zapcore.BinaryType:
+		return zap.String(field.Key, rules.redact(string(field.Interface.([]byte))))
+	case zapcore.StringerType:
+		return zap.String(field.Key, rules.redact(field.Interface.(fmt.Stringer).String()))
+	case zapcore.ErrorType:
+		if err, ok := field.Interface.(error); ok && err != nil {
+			return zap.String(field.Key, rules.redact(err.Error()))
+		}
+	case zapcore.ReflectType, zapcore.ObjectMarshalerType, zapcore.ArrayMarshalerType:
+		return rules.redactObject(field)
+	}
+	return field
+}
+
+// redactObject encodes the field as JSON and redacts the values of the decoded object, so that
+// the logged JSON keeps its structure and stays valid
+func (rules *redactionRules) redactObject(field zap.Field) zap.Field {
+	enc := zapcore.NewMapObjectEncoder()
+	field.AddTo(enc)
+
+	encoded, err := json.Marshal(enc.Fields[field.Key])
+	if err != nil {
+		return zap.String(field.Key, rules.redact(fmt.Sprintf("%+v", field.Interface)))
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return zap.String(field.Key, rules.redact(string(encoded)))
+	}
+	redacted, err := json.Marshal(rules.redactValue(field.Key, value))
+	if err != nil {
+		return zap.String(field.Key, rules.redact(string(encoded)))
+	}
+	return zap.Reflect(field.Key, json.RawMessage(redacted))
+}
+
+// redactValue redacts the denied keys and the strings of a decoded JSON value. key is the name
+// of the object field holding the value.
+func (rules *redactionRules) redactValue(key string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			if rules.denied(k) {
+				v[k] = redactedValue
+				continue
+			}
+			v[k] = rules.redactValue(k, field)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = rules.redactValue(key, item)
+		}
+	case string:
+		return rules.redactString(key, v)
+	}
+	return value
+}
+
+// redactString masks the secrets in a string of a JSON object. The whole string is masked when
+// a pattern only matches along with its key, e.g. "token": "secret".
+func (rules *redactionRules) redactString(key, s string) string {
+	if rules.patterns.MatchString(s) {
+		return rules.patterns.ReplaceAllLiteralString(s, redactedValue)
+	}
+	pair, err := json.Marshal(map[string]string{key: s})
+	if err == nil && rules.patterns.Match(pair) {
+		return redactedValue
+	}
+	return s
+}
+
+// Wrap returns a core redacting the messages and fields before writing them to core
+func (r *Redactor) Wrap(core zapcore.Core) zapcore.Core {
+	return &redactingCore{Core: core, redactor: r}
+}
+
+type redactingCore struct {
+	zapcore.Core
+	redactor *Redactor
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(c.redactor.RedactFields(fields)), redactor: c.redactor}
+}
+
+func (c *redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = c.redactor.Redact(entry.Message)
+	return c.Core.Write(entry, c.redactor.RedactFields(fields))
+}
+
+// ConfigureRedaction adds patterns and denied fields to the redaction of the Logger, replacing
+// those configured before
+func ConfigureRedaction(patterns, fields []string) error {
+	return redactor.Configure(patterns, fields)
+}
+
+// RedactSensitiveInfo masks sensitive information in log messages.
+func RedactSensitiveInfo(msg string) string {
+	return redactor.Redact(msg)
+}
+
+// RedactFields processes zap.Fields to redact sensitive data.
+func RedactFields(fields []zap.Field) []zap.Field {
+	return redactor.RedactFields(fields)
+}
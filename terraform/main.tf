@@ -16,6 +16,26 @@ resource "aws_lambda_function" "lambda" {
     variables = var.environment_variables
   }
 
+  # Mount the EFS file system of the incident store, see storage.tf
+  dynamic "vpc_config" {
+    for_each = local.efs_enabled ? [1] : []
+    content {
+      subnet_ids         = var.efs_subnet_ids
+      security_group_ids = [aws_security_group.lambda[0].id]
+    }
+  }
+
+  dynamic "file_system_config" {
+    for_each = local.efs_enabled ? [1] : []
+    content {
+      arn              = aws_efs_access_point.incidents[0].arn
+      local_mount_path = var.efs_mount_path
+    }
+  }
+
+  # The file system can only be mounted once a mount target is available
+  depends_on = [aws_efs_mount_target.incidents]
+
   tags = local.common_tags
 }
 
@@ -38,6 +58,20 @@ resource "aws_iam_role_policy" "lambda_access_logs" {
   policy = data.aws_iam_policy_document.cloudwatch_logs.json
 }
 
+resource "aws_iam_role_policy" "lambda_read_secrets" {
+  count  = length(var.secret_arns) + length(var.ssm_parameter_arns) > 0 ? 1 : 0
+  name   = "${local.base_name}-allow-read-secrets"
+  role   = aws_iam_role.lambda_permissions.id
+  policy = data.aws_iam_policy_document.read_secrets.json
+}
+
+resource "aws_iam_role_policy" "lambda_read_config" {
+  count  = length(var.config_object_arns) > 0 ? 1 : 0
+  name   = "${local.base_name}-allow-read-config"
+  role   = aws_iam_role.lambda_permissions.id
+  policy = data.aws_iam_policy_document.read_config.json
+}
+
 data "aws_iam_policy_document" "assume_role_policy" {
   statement {
     effect  = "Allow"
@@ -68,3 +102,72 @@ data "aws_iam_policy_document" "cloudwatch_logs" {
     resources = ["arn:aws:logs:*:*:*"]
   }
 }
+
+data "aws_iam_policy_document" "read_config" {
+  # Allow fetching the configuration kept in S3 (CONFIG_FILE=s3://bucket/key), reloaded
+  # without a redeploy
+  statement {
+    effect    = "Allow"
+    actions   = ["s3:GetObject"]
+    resources = var.config_object_arns
+  }
+}
+
+data "aws_iam_policy_document" "read_secrets" {
+  # Allow resolving the secret references of the configuration, so secrets are not set
+  # as plain environment variables
+  dynamic "statement" {
+    for_each = length(var.secret_arns) > 0 ? [1] : []
+    content {
+      effect    = "Allow"
+      actions   = ["secretsmanager:GetSecretValue"]
+      resources = var.secret_arns
+    }
+  }
+
+  dynamic "statement" {
+    for_each = length(var.ssm_parameter_arns) > 0 ? [1] : []
+    content {
+      effect    = "Allow"
+      actions   = ["ssm:GetParameter"]
+      resources = var.ssm_parameter_arns
+    }
+  }
+}
+
+# The incidents reported are delivered in asynchronous invocations of the function itself, so
+# that Slack is answered without waiting for Slack and Datadog
+resource "aws_iam_role_policy" "lambda_invoke_self" {
+  name   = "${local.base_name}-allow-invoke-self"
+  role   = aws_iam_role.lambda_permissions.id
+  policy = data.aws_iam_policy_document.invoke_self.json
+}
+
+data "aws_iam_policy_document" "invoke_self" {
+  statement {
+    effect  = "Allow"
+    actions = ["lambda:InvokeFunction"]
+    # Built from the name, the function cannot refer to its own ARN
+    resources = ["arn:aws:lambda:${var.aws_region}:${var.aws_account}:function:${var.service_name}"]
+  }
+}
+
+# Scheduled invocations retry the failed deliveries and reload a remote configuration
+resource "aws_cloudwatch_event_rule" "maintenance" {
+  name                = "${local.base_name}-maintenance"
+  schedule_expression = var.maintenance_schedule
+  tags                = local.common_tags
+}
+
+resource "aws_cloudwatch_event_target" "maintenance" {
+  rule = aws_cloudwatch_event_rule.maintenance.name
+  arn  = aws_lambda_function.lambda.arn
+}
+
+resource "aws_lambda_permission" "maintenance" {
+  statement_id  = "AllowMaintenanceSchedule"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.lambda.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.maintenance.arn
+}
@@ -0,0 +1,111 @@
+# EFS file system keeping the incident store (incidents.store: file) across Lambda execution
+# environments, so failed deliveries are still retried once an environment is discarded.
+# Created when efs_subnet_ids is set, the function then runs in the VPC of the subnets.
+locals {
+  efs_enabled = length(var.efs_subnet_ids) > 0
+}
+
+data "aws_subnet" "efs" {
+  count = local.efs_enabled ? 1 : 0
+  id    = var.efs_subnet_ids[0]
+}
+
+resource "aws_efs_file_system" "incidents" {
+  count          = local.efs_enabled ? 1 : 0
+  creation_token = local.base_name
+  encrypted      = true
+  tags           = merge(local.common_tags, { "Name" = local.base_name })
+}
+
+resource "aws_efs_access_point" "incidents" {
+  count          = local.efs_enabled ? 1 : 0
+  file_system_id = aws_efs_file_system.incidents[0].id
+
+  posix_user {
+    uid = 1000
+    gid = 1000
+  }
+
+  root_directory {
+    path = "/${var.service_name}"
+    creation_info {
+      owner_uid   = 1000
+      owner_gid   = 1000
+      permissions = "750"
+    }
+  }
+
+  tags = local.common_tags
+}
+
+resource "aws_security_group" "lambda" {
+  count       = local.efs_enabled ? 1 : 0
+  name        = "${local.base_name}-lambda"
+  description = "Lambda function of ${local.base_name}"
+  vpc_id      = data.aws_subnet.efs[0].vpc_id
+
+  # Slack, Datadog and the AWS APIs are called over HTTPS, the file system over NFS
+  egress {
+    from_port   = 0
+    to_port     = 0
+    protocol    = "-1"
+    cidr_blocks = ["0.0.0.0/0"]
+  }
+
+  tags = local.common_tags
+}
+
+resource "aws_security_group" "efs" {
+  count       = local.efs_enabled ? 1 : 0
+  name        = "${local.base_name}-efs"
+  description = "EFS mount targets of ${local.base_name}"
+  vpc_id      = data.aws_subnet.efs[0].vpc_id
+
+  ingress {
+    from_port       = 2049
+    to_port         = 2049
+    protocol        = "tcp"
+    security_groups = [aws_security_group.lambda[0].id]
+  }
+
+  tags = local.common_tags
+}
+
+resource "aws_efs_mount_target" "incidents" {
+  for_each        = toset(var.efs_subnet_ids)
+  file_system_id  = aws_efs_file_system.incidents[0].id
+  subnet_id       = each.value
+  security_groups = [aws_security_group.efs[0].id]
+}
+
+resource "aws_iam_role_policy_attachment" "lambda_vpc_access" {
+  count      = local.efs_enabled ? 1 : 0
+  role       = aws_iam_role.lambda_permissions.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaVPCAccessExecutionRole"
+}
+
+resource "aws_iam_role_policy" "lambda_mount_efs" {
+  count  = local.efs_enabled ? 1 : 0
+  name   = "${local.base_name}-allow-mount-efs"
+  role   = aws_iam_role.lambda_permissions.id
+  policy = data.aws_iam_policy_document.mount_efs[0].json
+}
+
+data "aws_iam_policy_document" "mount_efs" {
+  count = local.efs_enabled ? 1 : 0
+  # Allow reading and writing the incident store through the access point
+  statement {
+    effect = "Allow"
+    actions = [
+      "elasticfilesystem:ClientMount",
+      "elasticfilesystem:ClientWrite",
+    ]
+    resources = [aws_efs_file_system.incidents[0].arn]
+
+    condition {
+      test     = "StringEquals"
+      variable = "elasticfilesystem:AccessPointArn"
+      values   = [aws_efs_access_point.incidents[0].arn]
+    }
+  }
+}
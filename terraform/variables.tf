@@ -48,6 +48,42 @@ variable "environment_variables" {
   default     = {}
 }
 
+variable "secret_arns" {
+  type        = list(string)
+  description = "ARNs of the Secrets Manager secrets referenced by the configuration (secretsmanager://name#key)"
+  default     = []
+}
+
+variable "config_object_arns" {
+  type        = list(string)
+  description = "ARNs of the S3 objects the configuration is fetched from (CONFIG_FILE=s3://bucket/key)"
+  default     = []
+}
+
+variable "ssm_parameter_arns" {
+  type        = list(string)
+  description = "ARNs of the SSM parameters referenced by the configuration (ssm:///path)"
+  default     = []
+}
+
+variable "maintenance_schedule" {
+  type        = string
+  description = "How often the function is invoked to retry the failed incident deliveries and reload a remote configuration"
+  default     = "rate(1 minute)"
+}
+
+variable "efs_subnet_ids" {
+  type        = list(string)
+  description = "Private subnets to mount the EFS file system of the incident store from, none to keep the function out of a VPC and without file system. The subnets need a NAT gateway to reach Slack and Datadog"
+  default     = []
+}
+
+variable "efs_mount_path" {
+  type        = string
+  description = "Where the EFS file system is mounted in the function, under /mnt. Set incidents.store_path to a file in it"
+  default     = "/mnt/incidents"
+}
+
 variable "alert_destination" {
   type        = string
   description = "The destination of the alert"